@@ -20,6 +20,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"os"
 	"path/filepath"
 
@@ -53,6 +54,19 @@ var buildCmd = &cli.Command{
 			Aliases: []string{"c"},
 			Usage:   "Build package from scratch even if there's an already built package available",
 		},
+		&cli.StringFlag{
+			Name:  "sbom",
+			Usage: "Write a software bill of materials in this format next to each built package (cyclonedx or spdx)",
+		},
+		&cli.StringSliceFlag{
+			Name:    "format",
+			Aliases: []string{"f"},
+			Usage:   "Package formats to build, each optionally followed by the distro to target (example: deb,rpm:opensuse-leap,apk)",
+		},
+		&cli.StringFlag{
+			Name:  "target-arch",
+			Usage: "CPU architecture to build the package for, if it's different from the system's (example: arm64)",
+		},
 	},
 	Action: func(ctx context.Context, c *cli.Command) error {
 		log := loggerctx.From(ctx)
@@ -77,8 +91,13 @@ var buildCmd = &cli.Command{
 			Manager:     mgr,
 			Clean:       c.Bool("clean"),
 			Interactive: c.Bool("interactive"),
+			SBOM:        c.String("sbom"),
+			Formats:     c.StringSlice("format"),
+			TargetArch:  c.String("target-arch"),
 		})
-		if err != nil {
+		if errors.Is(err, build.ErrUserAborted) {
+			log.Fatal("User chose not to continue after reading script").Send()
+		} else if err != nil {
 			log.Fatal("Error building package").Err(err).Send()
 		}
 
@@ -88,10 +107,13 @@ var buildCmd = &cli.Command{
 		}
 
 		for _, pkgPath := range pkgPaths {
-			name := filepath.Base(pkgPath)
-			err = osutils.Move(pkgPath, filepath.Join(wd, name))
-			if err != nil {
-				log.Fatal("Error moving the package").Err(err).Send()
+			// Move the package along with its SBOM
+			// and signature, if it has them
+			for _, path := range build.PackageFiles(pkgPath) {
+				err = osutils.Move(path, filepath.Join(wd, filepath.Base(path)))
+				if err != nil {
+					log.Fatal("Error moving the package").Err(err).Send()
+				}
 			}
 		}
 
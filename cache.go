@@ -0,0 +1,219 @@
+/*
+ * LURE - Linux User REpository
+ * Copyright (C) 2023 Elara Musayelyan
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/dustin/go-humanize"
+	"github.com/sintan1729/lure/internal/dl"
+	"github.com/sintan1729/lure/internal/dlcache"
+	"github.com/sintan1729/lure/pkg/loggerctx"
+	"github.com/urfave/cli/v3"
+	"golang.org/x/exp/slices"
+)
+
+var cacheCmd = &cli.Command{
+	Name:  "cache",
+	Usage: "Manage the download cache",
+	Commands: []*cli.Command{
+		cacheListCmd,
+		cacheInfoCmd,
+		cachePruneCmd,
+		cacheRemoveCmd,
+	},
+}
+
+var cacheListCmd = &cli.Command{
+	Name:    "list",
+	Usage:   "List all the sources in the download cache",
+	Aliases: []string{"ls"},
+	Action: func(ctx context.Context, c *cli.Command) error {
+		log := loggerctx.From(ctx)
+
+		entries, err := dl.CacheEntries(ctx)
+		if err != nil {
+			log.Fatal("Error reading download cache").Err(err).Send()
+		}
+
+		// Show the most recently used entries first
+		slices.SortFunc(entries, func(a, b dl.CacheEntry) int {
+			return b.LastAccess.Compare(a.LastAccess)
+		})
+
+		for _, entry := range entries {
+			fmt.Println(formatCacheEntry(entry))
+		}
+
+		return nil
+	},
+}
+
+var cacheInfoCmd = &cli.Command{
+	Name:      "info",
+	Usage:     "Show information about the download cache or a single source in it",
+	ArgsUsage: "[url]",
+	Action: func(ctx context.Context, c *cli.Command) error {
+		log := loggerctx.From(ctx)
+
+		if c.NArg() > 0 {
+			entry, err := dl.GetCacheEntry(ctx, c.Args().First())
+			if err != nil {
+				log.Fatal("Error getting cache entry").Err(err).Send()
+			}
+
+			fmt.Println("URL:", entry.URL)
+			fmt.Println("Path:", entry.Path)
+			fmt.Println("Type:", entry.Type)
+			fmt.Println("Name:", entry.Name)
+			fmt.Println("Size:", humanize.Bytes(uint64(entry.Size)))
+			fmt.Println("Last access:", entry.LastAccess.Format("2006-01-02 15:04:05"))
+			fmt.Println("Valid:", entry.Valid)
+			return nil
+		}
+
+		entries, err := dl.CacheEntries(ctx)
+		if err != nil {
+			log.Fatal("Error reading download cache").Err(err).Send()
+		}
+
+		var total int64
+		invalid := 0
+		for _, entry := range entries {
+			total += entry.Size
+			if !entry.Valid {
+				invalid++
+			}
+		}
+
+		maxSize, limited, err := dl.MaxCacheSize(ctx)
+		if err != nil {
+			log.Fatal("Invalid maximum cache size in config").Err(err).Send()
+		}
+
+		fmt.Println("Path:", dlcache.BasePath(ctx))
+		fmt.Println("Entries:", len(entries))
+		fmt.Println("Invalid entries:", invalid)
+		fmt.Println("Total size:", humanize.Bytes(uint64(total)))
+		if limited {
+			fmt.Println("Maximum size:", humanize.Bytes(uint64(maxSize)))
+		} else {
+			fmt.Println("Maximum size: unlimited")
+		}
+
+		return nil
+	},
+}
+
+var cachePruneCmd = &cli.Command{
+	Name:  "prune",
+	Usage: "Remove old or least recently used sources from the download cache",
+	Flags: []cli.Flag{
+		&cli.DurationFlag{
+			Name:  "older-than",
+			Usage: "Remove sources that haven't been used for this long (example: 720h)",
+		},
+		&cli.StringFlag{
+			Name:  "max-size",
+			Usage: "Remove the least recently used sources until the cache is at most this size (example: 5GB)",
+		},
+	},
+	Action: func(ctx context.Context, c *cli.Command) error {
+		log := loggerctx.From(ctx)
+
+		if !c.IsSet("older-than") && !c.IsSet("max-size") {
+			log.Fatal("At least one of --older-than or --max-size must be provided").Send()
+		}
+
+		var removed []dl.CacheEntry
+
+		if c.IsSet("older-than") {
+			pruned, err := dl.PruneOlderThan(ctx, c.Duration("older-than"))
+			if err != nil {
+				log.Fatal("Error pruning download cache").Err(err).Send()
+			}
+			removed = append(removed, pruned...)
+		}
+
+		if c.IsSet("max-size") {
+			maxSize, err := humanize.ParseBytes(c.String("max-size"))
+			if err != nil {
+				log.Fatal("Invalid maximum cache size").Err(err).Send()
+			}
+
+			pruned, err := dl.PruneToSize(ctx, int64(maxSize))
+			if err != nil {
+				log.Fatal("Error pruning download cache").Err(err).Send()
+			}
+			removed = append(removed, pruned...)
+		}
+
+		var freed int64
+		for _, entry := range removed {
+			freed += entry.Size
+			fmt.Println(formatCacheEntry(entry))
+		}
+
+		log.Info("Pruned download cache").Int("removed", len(removed)).Str("freed", humanize.Bytes(uint64(freed))).Send()
+		return nil
+	},
+}
+
+var cacheRemoveCmd = &cli.Command{
+	Name:      "remove",
+	Usage:     "Remove a source from the download cache",
+	Aliases:   []string{"rm"},
+	ArgsUsage: "<url>",
+	Action: func(ctx context.Context, c *cli.Command) error {
+		log := loggerctx.From(ctx)
+
+		if c.NArg() < 1 {
+			log.Fatalf("Command remove expected at least 1 argument, got %d", c.NArg()).Send()
+		}
+
+		for _, u := range c.Args().Slice() {
+			err := dl.RemoveCacheEntry(ctx, u)
+			if errors.Is(err, dl.ErrNotInCache) {
+				log.Warn("Source is not in the download cache").Str("url", u).Send()
+			} else if err != nil {
+				log.Fatal("Error removing source from download cache").Str("url", u).Err(err).Send()
+			}
+		}
+
+		return nil
+	},
+}
+
+// formatCacheEntry formats a cache entry as a single line for display
+func formatCacheEntry(entry dl.CacheEntry) string {
+	url := entry.URL
+	if !entry.Valid {
+		url = "<invalid manifest>"
+	}
+
+	return fmt.Sprintf(
+		"%s %8s %-4s %s",
+		entry.LastAccess.Format("2006-01-02 15:04"),
+		humanize.Bytes(uint64(entry.Size)),
+		entry.Type,
+		url,
+	)
+}
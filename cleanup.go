@@ -0,0 +1,114 @@
+/*
+ * LURE - Linux User REpository
+ * Copyright (C) 2023 Elara Musayelyan
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/sintan1729/lure/internal/cliutils"
+	"github.com/sintan1729/lure/internal/installed"
+	"github.com/sintan1729/lure/internal/journal"
+	"github.com/sintan1729/lure/pkg/loggerctx"
+	"github.com/sintan1729/lure/pkg/manager"
+	"github.com/urfave/cli/v3"
+)
+
+var cleanupCmd = &cli.Command{
+	Name:  "cleanup",
+	Usage: "Remove build dependencies left installed by interrupted builds",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "noconfirm",
+			Usage: "Don't ask before removing the build dependencies",
+		},
+	},
+	Action: func(ctx context.Context, c *cli.Command) error {
+		log := loggerctx.From(ctx)
+
+		mgr := manager.Detect()
+		if mgr == nil {
+			log.Fatal("Unable to detect a supported package manager on the system").Send()
+		}
+
+		leftovers, err := journal.Leftovers(ctx)
+		if err != nil {
+			log.Fatal("Error reading the build dependency journal").Err(err).Send()
+		}
+
+		installedPkgs, err := mgr.ListInstalled(nil)
+		if err != nil {
+			log.Fatal("Error listing installed packages").Err(err).Send()
+		}
+
+		record, err := installed.Packages(ctx)
+		if err != nil {
+			log.Fatal("Error reading the record of installed packages").Err(err).Send()
+		}
+
+		var ids, names []string
+		for _, entry := range leftovers {
+			ids = append(ids, entry.ID)
+			for _, name := range entry.Packages {
+				// Packages that were already removed by
+				// something else don't need to be removed
+				if _, ok := installedPkgs[name]; !ok || slices.Contains(names, name) {
+					continue
+				}
+
+				// Packages the user has installed explicitly
+				// since the build are no longer leftovers
+				if pkg, ok := record[name]; ok && !pkg.Dependency {
+					continue
+				}
+
+				names = append(names, name)
+			}
+		}
+
+		if len(names) == 0 {
+			log.Info("There is nothing to do.").Send()
+		} else {
+			log.Info("These build dependencies were left installed by interrupted builds").
+				Str("names", strings.Join(names, ", ")).
+				Send()
+
+			remove, err := cliutils.YesNoPrompt(ctx, "Remove them?", c.Bool("interactive") && !c.Bool("noconfirm"), true)
+			if err != nil {
+				log.Fatal("Error prompting the user").Err(err).Send()
+			}
+
+			// Keep the journal entries so that
+			// they can be cleaned up later
+			if !remove {
+				return nil
+			}
+
+			removePkgs(ctx, mgr, names)
+		}
+
+		err = journal.Finish(ctx, ids...)
+		if err != nil {
+			log.Fatal("Error updating the build dependency journal").Err(err).Send()
+		}
+
+		return nil
+	},
+}
@@ -0,0 +1,82 @@
+/*
+ * LURE - Linux User REpository
+ * Copyright (C) 2023 Elara Musayelyan
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/sintan1729/lure/internal/doctor"
+	"github.com/sintan1729/lure/pkg/loggerctx"
+	"github.com/sintan1729/lure/pkg/manager"
+	"github.com/urfave/cli/v3"
+)
+
+var doctorCmd = &cli.Command{
+	Name:  "doctor",
+	Usage: "Check for problems with LURE and suggest how to fix them",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "json",
+			Usage: "Print the findings as JSON",
+		},
+	},
+	Action: func(ctx context.Context, c *cli.Command) error {
+		log := loggerctx.From(ctx)
+
+		findings, err := doctor.Run(ctx, manager.Detect())
+		if err != nil {
+			log.Fatal("Error checking for problems").Err(err).Send()
+		}
+
+		if c.Bool("json") {
+			if findings == nil {
+				findings = []doctor.Finding{}
+			}
+
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			err := enc.Encode(findings)
+			if err != nil {
+				log.Fatal("Error encoding findings").Err(err).Send()
+			}
+		} else {
+			for _, finding := range findings {
+				fmt.Println(finding)
+			}
+		}
+
+		errCount := 0
+		for _, finding := range findings {
+			if finding.Severity == doctor.SeverityError {
+				errCount++
+			}
+		}
+
+		if errCount > 0 {
+			log.Fatal("Found problems that prevent LURE from working").Int("problems", len(findings)).Int("errors", errCount).Send()
+		} else if len(findings) == 0 && !c.Bool("json") {
+			log.Info("No problems found").Send()
+		}
+
+		return nil
+	},
+}
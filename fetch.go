@@ -0,0 +1,119 @@
+/*
+ * LURE - Linux User REpository
+ * Copyright (C) 2023 Elara Musayelyan
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"context"
+
+	"github.com/sintan1729/lure/internal/cliutils"
+	"github.com/sintan1729/lure/internal/config"
+	"github.com/sintan1729/lure/internal/types"
+	"github.com/sintan1729/lure/pkg/build"
+	"github.com/sintan1729/lure/pkg/loggerctx"
+	"github.com/sintan1729/lure/pkg/repos"
+	"github.com/urfave/cli/v3"
+)
+
+var fetchCmd = &cli.Command{
+	Name:      "fetch",
+	Usage:     "Download the sources of packages and their dependencies without building them",
+	Aliases:   []string{"download-sources"},
+	ArgsUsage: "<package...>",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:    "script",
+			Aliases: []string{"s"},
+			Usage:   "Path to a build script to fetch the sources of, in addition to any packages",
+		},
+		&cli.StringFlag{
+			Name:    "output",
+			Aliases: []string{"o"},
+			Usage:   "Copy the sources of each package into a subdirectory of this directory",
+		},
+		&cli.BoolFlag{
+			Name:  "no-deps",
+			Usage: "Don't fetch the sources of the packages' dependencies",
+		},
+		&cli.StringFlag{
+			Name:  "target-arch",
+			Usage: "CPU architecture whose sources should be fetched, if it's different from the system's (example: arm64)",
+		},
+		&cli.StringFlag{
+			Name:  "distro",
+			Usage: "Distro whose sources should be fetched, optionally followed by its version or codename (example: ubuntu:22.04)",
+		},
+	},
+	Action: func(ctx context.Context, c *cli.Command) error {
+		log := loggerctx.From(ctx)
+
+		args := c.Args()
+		if args.Len() < 1 && c.String("script") == "" {
+			log.Fatalf("Command fetch expected at least 1 argument, got %d", args.Len()).Send()
+		}
+
+		// Sources can still be copied out of the cache in offline mode,
+		// but there's nothing else to do without network access.
+		if config.Config(ctx).Offline && c.String("output") == "" {
+			log.Fatal("Sources can't be fetched in offline mode").Send()
+		}
+
+		err := repos.Pull(ctx, config.Config(ctx).Repos)
+		if err != nil {
+			log.Fatal("Error pulling repositories").Err(err).Send()
+		}
+
+		var scripts []string
+		if c.String("script") != "" {
+			scripts = append(scripts, c.String("script"))
+		}
+
+		if args.Len() > 0 {
+			found, notFound, err := repos.FindPkgs(ctx, args.Slice())
+			if err != nil {
+				log.Fatal("Error finding packages").Err(err).Send()
+			}
+
+			for _, name := range notFound {
+				log.Warn("Package not found in any LURE repo").Str("name", name).Send()
+			}
+
+			pkgs, err := cliutils.FlattenPkgs(ctx, found, "fetch", c.Bool("interactive"))
+			if err != nil {
+				log.Fatal("Error prompting for choice of package").Err(err).Send()
+			}
+
+			scripts = append(scripts, build.GetScriptPaths(ctx, pkgs)...)
+		}
+
+		err = build.FetchSources(ctx, types.FetchOpts{
+			Scripts:     scripts,
+			Destination: c.String("output"),
+			Deps:        !c.Bool("no-deps"),
+			Interactive: c.Bool("interactive"),
+			TargetArch:  c.String("target-arch"),
+			Distro:      c.String("distro"),
+		})
+		if err != nil {
+			log.Fatal("Error fetching sources").Err(err).Send()
+		}
+
+		log.Info("Done").Send()
+		return nil
+	},
+}
@@ -20,10 +20,15 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
 
 	"github.com/sintan1729/lure/internal/config"
 	"github.com/sintan1729/lure/internal/db"
+	"github.com/sintan1729/lure/internal/dlcache"
+	"github.com/sintan1729/lure/internal/flock"
 	"github.com/sintan1729/lure/pkg/loggerctx"
 	"github.com/sintan1729/lure/pkg/repos"
 	"github.com/urfave/cli/v3"
@@ -38,9 +43,19 @@ var fixCmd = &cli.Command{
 		db.Close()
 		paths := config.GetPaths(ctx)
 
+		// The lock files are in the cache directory, so other LURE processes
+		// holding them would keep using the deleted files while new ones lock
+		// new files. Make sure nothing else is using the cache first.
+		locks, err := lockCache(ctx)
+		if errors.Is(err, flock.ErrLocked) {
+			log.Fatal("Another LURE process is using the cache, try again once it's done").Err(err).Send()
+		} else if err != nil {
+			log.Fatal("Unable to lock the cache").Err(err).Send()
+		}
+
 		log.Info("Removing cache directory").Send()
 
-		err := os.RemoveAll(paths.CacheDir)
+		err = os.RemoveAll(paths.CacheDir)
 		if err != nil {
 			log.Fatal("Unable to remove cache directory").Err(err).Send()
 		}
@@ -52,6 +67,8 @@ var fixCmd = &cli.Command{
 			log.Fatal("Unable to create new cache directory").Err(err).Send()
 		}
 
+		releaseLocks(locks)
+
 		err = repos.Pull(ctx, config.Config(ctx).Repos)
 		if err != nil {
 			log.Fatal("Error pulling repos").Err(err).Send()
@@ -62,3 +79,59 @@ var fixCmd = &cli.Command{
 		return nil
 	},
 }
+
+// lockCache takes the locks on the repos, the database, the download cache
+// entries and the build directories. It waits for other processes to finish
+// with the repos and the database, but if a cache entry or build directory
+// is in use, it releases the locks it took and returns flock.ErrLocked.
+func lockCache(ctx context.Context) ([]*flock.Lock, error) {
+	var locks []*flock.Lock
+
+	lock, err := repos.LockRepos(ctx)
+	if err != nil {
+		return nil, err
+	}
+	locks = append(locks, lock)
+
+	lock, err = db.Lock(ctx)
+	if err != nil {
+		releaseLocks(locks)
+		return nil, err
+	}
+	locks = append(locks, lock)
+
+	// The locks of cache entries and build directories are kept next to them
+	patterns := []string{
+		filepath.Join(dlcache.BasePath(ctx), "*.lock"),
+		filepath.Join(config.GetPaths(ctx).PkgsDir, "*.lock"),
+	}
+
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			releaseLocks(locks)
+			return nil, err
+		}
+
+		for _, path := range matches {
+			lock, err := flock.TryLock(path)
+			if errors.Is(err, flock.ErrLocked) {
+				releaseLocks(locks)
+				return nil, fmt.Errorf("%w: %s", err, path)
+			} else if err != nil {
+				releaseLocks(locks)
+				return nil, err
+			}
+			locks = append(locks, lock)
+		}
+	}
+
+	return locks, nil
+}
+
+// releaseLocks releases all the given locks
+func releaseLocks(locks []*flock.Lock) {
+	for _, lock := range locks {
+		lock.Release()
+	}
+}
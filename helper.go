@@ -55,7 +55,7 @@ var helperCmd = &cli.Command{
 				"pkgdir="+c.String("dest-dir"),
 				"DISTRO_ID="+info.ID,
 				"DISTRO_ID_LIKE="+strings.Join(info.Like, " "),
-				"ARCH="+cpu.Arch(),
+				"ARCH="+cpu.BaseArch(cpu.Arch()),
 			),
 			Dir:    wd,
 			Stdin:  os.Stdin,
@@ -65,7 +65,10 @@ var infoCmd = &cli.Command{
 			os.Exit(1)
 		}
 
-		pkgs := cliutils.FlattenPkgs(ctx, found, "show", c.Bool("interactive"))
+		pkgs, err := cliutils.FlattenPkgs(ctx, found, "show", c.Bool("interactive"))
+		if err != nil {
+			log.Fatal("Error prompting for choice of package").Err(err).Send()
+		}
 
 		var names []string
 		all := c.Bool("all")
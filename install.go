@@ -20,6 +20,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"github.com/sintan1729/lure/internal/cliutils"
@@ -67,12 +68,22 @@ var installCmd = &cli.Command{
 			log.Fatal("Error finding packages").Err(err).Send()
 		}
 
-		pkgs := cliutils.FlattenPkgs(ctx, found, "install", c.Bool("interactive"))
-		build.InstallPkgs(ctx, pkgs, notFound, types.BuildOpts{
+		pkgs, err := cliutils.FlattenPkgs(ctx, found, "install", c.Bool("interactive"))
+		if err != nil {
+			log.Fatal("Error prompting for choice of package").Err(err).Send()
+		}
+
+		err = build.InstallPkgs(ctx, pkgs, notFound, types.BuildOpts{
 			Manager:     mgr,
 			Clean:       c.Bool("clean"),
 			Interactive: c.Bool("interactive"),
 		})
+		if errors.Is(err, build.ErrUserAborted) {
+			log.Fatal("User chose not to continue after reading script").Send()
+		} else if err != nil {
+			log.Fatal("Error installing packages").Err(err).Send()
+		}
+
 		return nil
 	},
 	ShellComplete: func(ctx context.Context, c *cli.Command) {
@@ -94,29 +105,3 @@ var installCmd = &cli.Command{
 		}
 	},
 }
-
-var removeCmd = &cli.Command{
-	Name:    "remove",
-	Usage:   "Remove an installed package",
-	Aliases: []string{"rm"},
-	Action: func(ctx context.Context, c *cli.Command) error {
-		log := loggerctx.From(ctx)
-
-		args := c.Args()
-		if args.Len() < 1 {
-			log.Fatalf("Command remove expected at least 1 argument, got %d", args.Len()).Send()
-		}
-
-		mgr := manager.Detect()
-		if mgr == nil {
-			log.Fatal("Unable to detect a supported package manager on the system").Send()
-		}
-
-		err := mgr.Remove(nil, c.Args().Slice()...)
-		if err != nil {
-			log.Fatal("Error removing packages").Err(err).Send()
-		}
-
-		return nil
-	},
-}
@@ -20,6 +20,7 @@ package cliutils
 
 import (
 	"context"
+	"errors"
 	"os"
 	"strings"
 
@@ -28,9 +29,11 @@ import (
 	"github.com/sintan1729/lure/internal/db"
 	"github.com/sintan1729/lure/internal/pager"
 	"github.com/sintan1729/lure/internal/translations"
-	"github.com/sintan1729/lure/pkg/loggerctx"
 )
 
+// ErrUserAborted is returned when the user chooses not to continue
+var ErrUserAborted = errors.New("user chose not to continue")
+
 // YesNoPrompt asks the user a yes or no question, using def as the default answer
 func YesNoPrompt(ctx context.Context, msg string, interactive, def bool) (bool, error) {
 	if interactive {
@@ -50,10 +53,8 @@ func YesNoPrompt(ctx context.Context, msg string, interactive, def bool) (bool,
 
 // PromptViewScript asks the user if they'd like to see a script,
 // shows it if they answer yes, then asks if they'd still like to
-// continue, and exits if they answer no.
+// continue, and returns ErrUserAborted if they answer no.
 func PromptViewScript(ctx context.Context, script, name, style string, interactive bool) error {
-	log := loggerctx.From(ctx)
-
 	if !interactive {
 		return nil
 	}
@@ -76,7 +77,7 @@ func PromptViewScript(ctx context.Context, script, name, style string, interacti
 		}
 
 		if !cont {
-			log.Fatal(translations.Translator(ctx).TranslateTo("User chose not to continue after reading script", config.Language(ctx))).Send()
+			return ErrUserAborted
 		}
 	}
 
@@ -103,21 +104,26 @@ func ShowScript(path, name, style string) error {
 
 // FlattenPkgs attempts to flatten the a map of slices of packages into a single slice
 // of packages by prompting the user if multiple packages match.
-func FlattenPkgs(ctx context.Context, found map[string][]db.Package, verb string, interactive bool) []db.Package {
-	log := loggerctx.From(ctx)
+func FlattenPkgs(ctx context.Context, found map[string][]db.Package, verb string, interactive bool) ([]db.Package, error) {
 	var outPkgs []db.Package
 	for _, pkgs := range found {
+		// Packages whose candidates were all filtered out,
+		// for example because they're installed, are skipped
+		if len(pkgs) == 0 {
+			continue
+		}
+
 		if len(pkgs) > 1 && interactive {
 			choice, err := PkgPrompt(ctx, pkgs, verb, interactive)
 			if err != nil {
-				log.Fatal("Error prompting for choice of package").Send()
+				return nil, err
 			}
 			outPkgs = append(outPkgs, choice)
 		} else if len(pkgs) == 1 || !interactive {
 			outPkgs = append(outPkgs, pkgs[0])
 		}
 	}
-	return outPkgs
+	return outPkgs, nil
 }
 
 // PkgPrompt asks the user to choose between multiple packages.
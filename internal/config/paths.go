@@ -36,6 +36,10 @@ type Paths struct {
 	RepoDir    string
 	PkgsDir    string
 	DBPath     string
+	// StateDir contains information about the system that
+	// has to persist, such as which packages LURE installed.
+	// Unlike CacheDir, it's kept when the cache is cleared.
+	StateDir string
 }
 
 var (
@@ -103,6 +107,32 @@ func GetPaths(ctx context.Context) *Paths {
 		}
 
 		paths.DBPath = filepath.Join(paths.CacheDir, "db")
+
+		stateDir, err := userStateDir()
+		if err != nil {
+			log.Fatal("Unable to detect state directory").Err(err).Send()
+		}
+
+		paths.StateDir = filepath.Join(stateDir, "lure")
+
+		err = os.MkdirAll(paths.StateDir, 0o755)
+		if err != nil {
+			log.Fatal("Unable to create LURE state directory").Err(err).Send()
+		}
 	}
 	return paths
 }
+
+// userStateDir returns the directory for user-specific state data,
+// which is $XDG_STATE_HOME, or ~/.local/state if that isn't set.
+func userStateDir() (string, error) {
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return dir, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "state"), nil
+}
@@ -28,6 +28,73 @@ import (
 	"golang.org/x/sys/cpu"
 )
 
+// Arches contains all the CPU architectures supported by LURE. These
+// are the values that can be used in the architectures array and in
+// override names, in addition to "all" for architecture-independent
+// packages. amd64v2, amd64v3 and amd64v4 are the x86-64 microarchitecture
+// levels, which fall back to amd64 (the baseline level).
+var Arches = []string{
+	"386",
+	"amd64",
+	"amd64v2",
+	"amd64v3",
+	"amd64v4",
+	"arm5",
+	"arm6",
+	"arm7",
+	"arm64",
+	"loong64",
+	"mips",
+	"mipsle",
+	"mips64",
+	"mips64le",
+	"ppc64",
+	"ppc64le",
+	"riscv64",
+	"s390x",
+}
+
+// archAliases maps names that other tools commonly use for
+// CPU architectures to the equivalent names used by LURE
+var archAliases = map[string]string{
+	"i386":      "386",
+	"i686":      "386",
+	"x86":       "386",
+	"x86_64":    "amd64",
+	"amd64v1":   "amd64",
+	"x86_64_v2": "amd64v2",
+	"x86_64_v3": "amd64v3",
+	"x86_64_v4": "amd64v4",
+	"x86-64-v2": "amd64v2",
+	"x86-64-v3": "amd64v3",
+	"x86-64-v4": "amd64v4",
+	"aarch64":   "arm64",
+	"arm":       "arm5",
+	"armel":     "arm5",
+	"armv5":     "arm5",
+	"armv6":     "arm6",
+	"armv6h":    "arm6",
+	"armhf":     "arm7",
+	"armv7":     "arm7",
+	"armv7h":    "arm7",
+	"armv7l":    "arm7",
+	"ppc64el":   "ppc64le",
+	"riscv":     "riscv64",
+}
+
+// IsKnown returns true if arch is one of the architectures
+// supported by LURE, or "all"
+func IsKnown(arch string) bool {
+	return arch == "all" || slices.Contains(Arches, arch)
+}
+
+// Suggest returns the architecture supported by LURE that's equivalent
+// to arch, such as amd64 for x86_64. It returns false if there is none.
+func Suggest(arch string) (string, bool) {
+	out, ok := archAliases[arch]
+	return out, ok
+}
+
 // armVariant checks which variant of ARM lure is running
 // on, by using the same detection method as Go itself
 func armVariant() string {
@@ -46,11 +113,131 @@ func armVariant() string {
 	}
 }
 
-// Arch returns the canonical CPU architecture of the system
+// cpuinfoPath is the file the kernel reports the CPU's feature flags in
+var cpuinfoPath = "/proc/cpuinfo"
+
+// amd64LevelFeatures contains the CPU features required by each x86-64
+// microarchitecture level above the baseline, as defined by the x86-64
+// psABI. They use the flag names from /proc/cpuinfo, where abm is LZCNT,
+// lahf_lm is LAHF-SAHF and pni is SSE3.
+var amd64LevelFeatures = [][]string{
+	{"cx16", "lahf_lm", "popcnt", "pni", "ssse3", "sse4_1", "sse4_2"},
+	{"abm", "avx", "avx2", "bmi1", "bmi2", "f16c", "fma", "movbe", "osxsave"},
+	{"avx512bw", "avx512cd", "avx512dq", "avx512f", "avx512vl"},
+}
+
+// detectAMD64Level checks which x86-64 microarchitecture level
+// the CPU supports. golang.org/x/sys/cpu doesn't expose LZCNT,
+// MOVBE, F16C and LAHF-SAHF, so those are read from /proc/cpuinfo.
+// If it can't be read, they're assumed to be present, which makes
+// the result approximate.
+func detectAMD64Level() int {
+	x := cpu.X86
+	features := map[string]bool{
+		"cx16":     x.HasCX16,
+		"popcnt":   x.HasPOPCNT,
+		"pni":      x.HasSSE3,
+		"ssse3":    x.HasSSSE3,
+		"sse4_1":   x.HasSSE41,
+		"sse4_2":   x.HasSSE42,
+		"avx":      x.HasAVX,
+		"avx2":     x.HasAVX2,
+		"bmi1":     x.HasBMI1,
+		"bmi2":     x.HasBMI2,
+		"fma":      x.HasFMA,
+		"osxsave":  x.HasOSXSAVE,
+		"avx512f":  x.HasAVX512F,
+		"avx512bw": x.HasAVX512BW,
+		"avx512cd": x.HasAVX512CD,
+		"avx512dq": x.HasAVX512DQ,
+		"avx512vl": x.HasAVX512VL,
+	}
+
+	flags, err := readCPUFlags(cpuinfoPath)
+	for _, name := range []string{"abm", "f16c", "lahf_lm", "movbe"} {
+		features[name] = err != nil || flags[name]
+	}
+
+	return amd64Level(features)
+}
+
+// amd64Level returns the highest x86-64 microarchitecture
+// level whose required features are all in features
+func amd64Level(features map[string]bool) int {
+	level := 1
+	for _, required := range amd64LevelFeatures {
+		for _, name := range required {
+			if !features[name] {
+				return level
+			}
+		}
+		level++
+	}
+	return level
+}
+
+// readCPUFlags reads the feature flags of the first CPU
+// listed in the cpuinfo file at path
+func readCPUFlags(path string) (map[string]bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseCPUFlags(string(data)), nil
+}
+
+// parseCPUFlags parses the feature flags of the first
+// CPU listed in the contents of a cpuinfo file
+func parseCPUFlags(cpuinfo string) map[string]bool {
+	flags := map[string]bool{}
+	for _, line := range strings.Split(cpuinfo, "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok || strings.TrimSpace(key) != "flags" {
+			continue
+		}
+		for _, flag := range strings.Fields(value) {
+			flags[flag] = true
+		}
+		break
+	}
+	return flags
+}
+
+// HostArch returns the canonical CPU architecture of the system
+// LURE is running on. On x86-64 systems, this includes the
+// microarchitecture level if it's higher than the baseline,
+// such as amd64v3.
+func HostArch() string {
+	arch := runtime.GOARCH
+	switch arch {
+	case "arm":
+		arch = armVariant()
+	case "amd64":
+		if level := detectAMD64Level(); level > 1 {
+			arch += "v" + strconv.Itoa(level)
+		}
+	}
+	return arch
+}
+
+// BaseArch returns arch without its x86-64 microarchitecture
+// level, such as amd64 for amd64v3. This is the architecture
+// used for package metadata, since package managers don't
+// distinguish between the levels.
+func BaseArch(arch string) string {
+	if _, ok := getAMD64Level(arch); ok {
+		return "amd64"
+	}
+	return arch
+}
+
+// Arch returns the canonical CPU architecture that packages are
+// built for by default. This is the architecture of the system,
+// unless it's been changed with the LURE_ARCH environment variable.
 func Arch() string {
 	arch := os.Getenv("LURE_ARCH")
 	if arch == "" {
-		arch = runtime.GOARCH
+		return HostArch()
 	}
 	if arch == "arm" {
 		arch = armVariant()
@@ -58,13 +245,66 @@ func Arch() string {
 	return arch
 }
 
+// archNames contains the names other tools use for each architecture:
+// the machine name reported by uname, which makepkg uses for CARCH,
+// and the GNU triplet that prefixes the names of its cross toolchain
+var archNames = map[string]struct{ machine, triplet string }{
+	"386":      {"i686", "i686-linux-gnu"},
+	"amd64":    {"x86_64", "x86_64-linux-gnu"},
+	"arm5":     {"armv5tel", "arm-linux-gnueabi"},
+	"arm6":     {"armv6l", "arm-linux-gnueabihf"},
+	"arm7":     {"armv7l", "arm-linux-gnueabihf"},
+	"arm64":    {"aarch64", "aarch64-linux-gnu"},
+	"loong64":  {"loongarch64", "loongarch64-linux-gnu"},
+	"mips":     {"mips", "mips-linux-gnu"},
+	"mipsle":   {"mipsel", "mipsel-linux-gnu"},
+	"mips64":   {"mips64", "mips64-linux-gnuabi64"},
+	"mips64le": {"mips64el", "mips64el-linux-gnuabi64"},
+	"ppc64":    {"ppc64", "powerpc64-linux-gnu"},
+	"ppc64le":  {"ppc64le", "powerpc64le-linux-gnu"},
+	"riscv64":  {"riscv64", "riscv64-linux-gnu"},
+	"s390x":    {"s390x", "s390x-linux-gnu"},
+}
+
+// Machine returns the name of arch as reported by uname,
+// such as x86_64 for amd64. Unknown architectures are
+// returned as-is.
+func Machine(arch string) string {
+	if names, ok := archNames[BaseArch(arch)]; ok {
+		return names.machine
+	}
+	return arch
+}
+
+// Triplet returns the GNU triplet of arch, such as aarch64-linux-gnu
+// for arm64. It returns an empty string for unknown architectures.
+func Triplet(arch string) string {
+	return archNames[BaseArch(arch)].triplet
+}
+
+// Is64Bit returns true if arch is a 64-bit architecture
+func Is64Bit(arch string) bool {
+	switch arch {
+	case "386", "arm5", "arm6", "arm7", "mips", "mipsle":
+		return false
+	default:
+		return true
+	}
+}
+
 func IsCompatibleWith(target string, list []string) bool {
 	if target == "all" || slices.Contains(list, "all") {
 		return true
 	}
 
 	for _, arch := range list {
-		if strings.HasPrefix(target, "arm") && strings.HasPrefix(arch, "arm") {
+		if targetLevel, ok := getAMD64Level(target); ok {
+			if archLevel, ok := getAMD64Level(arch); ok && targetLevel >= archLevel {
+				return true
+			}
+		}
+
+		if isARM32(target) && isARM32(arch) {
 			targetVer, err := getARMVersion(target)
 			if err != nil {
 				return false
@@ -89,7 +329,15 @@ func IsCompatibleWith(target string, list []string) bool {
 }
 
 func CompatibleArches(arch string) ([]string, error) {
-	if strings.HasPrefix(arch, "arm") {
+	if level, ok := getAMD64Level(arch); ok && level > 1 {
+		var out []string
+		for i := level; i > 1; i-- {
+			out = append(out, "amd64v"+strconv.Itoa(i))
+		}
+		return append(out, "amd64"), nil
+	}
+
+	if isARM32(arch) {
 		ver, err := getARMVersion(arch)
 		if err != nil {
 			return nil, err
@@ -107,6 +355,36 @@ func CompatibleArches(arch string) ([]string, error) {
 	return []string{arch}, nil
 }
 
+// AMD64Level returns the x86-64 microarchitecture level of arch, such
+// as v3 for amd64v3 and v1 for amd64. It returns an empty string if
+// arch isn't an x86-64 architecture.
+func AMD64Level(arch string) string {
+	level, ok := getAMD64Level(arch)
+	if !ok {
+		return ""
+	}
+	return "v" + strconv.Itoa(level)
+}
+
+// getAMD64Level returns the x86-64 microarchitecture level of arch,
+// and false if arch isn't an x86-64 architecture
+func getAMD64Level(arch string) (int, bool) {
+	switch arch {
+	case "amd64":
+		return 1, true
+	case "amd64v2", "amd64v3", "amd64v4":
+		return int(arch[len(arch)-1] - '0'), true
+	default:
+		return 0, false
+	}
+}
+
+// isARM32 returns true if arch is one of the 32-bit ARM variants,
+// which are compatible with older variants
+func isARM32(arch string) bool {
+	return strings.HasPrefix(arch, "arm") && arch != "arm64"
+}
+
 func getARMVersion(arch string) (int, error) {
 	// Extract the version number from ARM architecture
 	version := strings.TrimPrefix(arch, "arm")
@@ -0,0 +1,240 @@
+/*
+ * LURE - Linux User REpository
+ * Copyright (C) 2023 Elara Musayelyan
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cpu
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestBaseArch(t *testing.T) {
+	tests := map[string]string{
+		"amd64":   "amd64",
+		"amd64v2": "amd64",
+		"amd64v3": "amd64",
+		"amd64v4": "amd64",
+		"386":     "386",
+		"arm7":    "arm7",
+		"arm64":   "arm64",
+		"unknown": "unknown",
+	}
+
+	for arch, expected := range tests {
+		if base := BaseArch(arch); base != expected {
+			t.Errorf("%s: expected %s, got %s", arch, expected, base)
+		}
+	}
+}
+
+func TestAMD64Level(t *testing.T) {
+	tests := map[string]string{
+		"amd64":   "v1",
+		"amd64v2": "v2",
+		"amd64v4": "v4",
+		"arm64":   "",
+		"386":     "",
+	}
+
+	for arch, expected := range tests {
+		if level := AMD64Level(arch); level != expected {
+			t.Errorf("%s: expected %q, got %q", arch, expected, level)
+		}
+	}
+}
+
+func TestIsCompatibleWith(t *testing.T) {
+	type testCase struct {
+		name     string
+		target   string
+		list     []string
+		expected bool
+	}
+
+	for _, tc := range []testCase{
+		{"all target", "all", []string{"arm64"}, true},
+		{"all in list", "riscv64", []string{"all"}, true},
+		{"same arch", "arm64", []string{"amd64", "arm64"}, true},
+		{"different arch", "arm64", []string{"amd64"}, false},
+		{"baseline on higher level", "amd64v3", []string{"amd64"}, true},
+		{"lower level on higher level", "amd64v3", []string{"amd64v2"}, true},
+		{"same level", "amd64v3", []string{"amd64v3"}, true},
+		{"higher level on lower level", "amd64v2", []string{"amd64v3"}, false},
+		{"higher level on baseline", "amd64", []string{"amd64v2"}, false},
+		{"level on 386", "386", []string{"amd64"}, false},
+		{"older arm variant", "arm7", []string{"arm5"}, true},
+		{"newer arm variant", "arm6", []string{"arm7"}, false},
+		{"arm64 on arm7", "arm7", []string{"arm64"}, false},
+		{"empty list", "amd64", nil, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if ok := IsCompatibleWith(tc.target, tc.list); ok != tc.expected {
+				t.Errorf("Expected %t, got %t", tc.expected, ok)
+			}
+		})
+	}
+}
+
+func TestCompatibleArches(t *testing.T) {
+	tests := map[string][]string{
+		"amd64":   {"amd64"},
+		"amd64v2": {"amd64v2", "amd64"},
+		"amd64v4": {"amd64v4", "amd64v3", "amd64v2", "amd64"},
+		"arm5":    {"arm5"},
+		"arm7":    {"arm7", "arm6", "arm5"},
+		"arm64":   {"arm64"},
+		"riscv64": {"riscv64"},
+	}
+
+	for arch, expected := range tests {
+		arches, err := CompatibleArches(arch)
+		if err != nil {
+			t.Fatalf("%s: expected no error, got %s", arch, err)
+		}
+		if !reflect.DeepEqual(arches, expected) {
+			t.Errorf("%s: expected %v, got %v", arch, expected, arches)
+		}
+	}
+
+	if _, err := CompatibleArches("armfoo"); err == nil {
+		t.Error("Expected error for invalid ARM variant, got nil")
+	}
+}
+
+func TestMachineTriplet(t *testing.T) {
+	type testCase struct {
+		arch    string
+		machine string
+		triplet string
+	}
+
+	for _, tc := range []testCase{
+		{"amd64", "x86_64", "x86_64-linux-gnu"},
+		{"amd64v3", "x86_64", "x86_64-linux-gnu"},
+		{"386", "i686", "i686-linux-gnu"},
+		{"arm6", "armv6l", "arm-linux-gnueabihf"},
+		{"arm64", "aarch64", "aarch64-linux-gnu"},
+		{"ppc64le", "ppc64le", "powerpc64le-linux-gnu"},
+		{"unknown", "unknown", ""},
+	} {
+		if machine := Machine(tc.arch); machine != tc.machine {
+			t.Errorf("%s: expected machine %s, got %s", tc.arch, tc.machine, machine)
+		}
+		if triplet := Triplet(tc.arch); triplet != tc.triplet {
+			t.Errorf("%s: expected triplet %q, got %q", tc.arch, tc.triplet, triplet)
+		}
+	}
+}
+
+func TestAliases(t *testing.T) {
+	for alias, arch := range archAliases {
+		if !IsKnown(arch) {
+			t.Errorf("%s: alias target %s is not a known architecture", alias, arch)
+		}
+		if IsKnown(alias) {
+			t.Errorf("%s: alias is also a known architecture", alias)
+		}
+	}
+
+	tests := map[string]string{
+		"x86_64":    "amd64",
+		"x86-64-v3": "amd64v3",
+		"aarch64":   "arm64",
+		"armhf":     "arm7",
+		"i686":      "386",
+	}
+	for alias, expected := range tests {
+		arch, ok := Suggest(alias)
+		if !ok || arch != expected {
+			t.Errorf("%s: expected %s, got %q (%t)", alias, expected, arch, ok)
+		}
+	}
+
+	if arch, ok := Suggest("amd64"); ok {
+		t.Errorf("Expected no suggestion for amd64, got %s", arch)
+	}
+	if !IsKnown("all") {
+		t.Error("Expected all to be known")
+	}
+}
+
+// levelFeatures returns the features required by
+// every x86-64 microarchitecture level up to level
+func levelFeatures(level int) map[string]bool {
+	features := map[string]bool{}
+	for _, required := range amd64LevelFeatures[:level-1] {
+		for _, name := range required {
+			features[name] = true
+		}
+	}
+	return features
+}
+
+func TestAMD64LevelFeatures(t *testing.T) {
+	type testCase struct {
+		name     string
+		features map[string]bool
+		missing  string
+		expected int
+	}
+
+	for _, tc := range []testCase{
+		{"baseline", levelFeatures(1), "", 1},
+		{"v2", levelFeatures(2), "", 2},
+		{"v3", levelFeatures(3), "", 3},
+		{"v4", levelFeatures(4), "", 4},
+		{"v2 without lahf-sahf", levelFeatures(2), "lahf_lm", 1},
+		{"v3 without lzcnt", levelFeatures(3), "abm", 2},
+		{"v3 without movbe", levelFeatures(3), "movbe", 2},
+		{"v3 without f16c", levelFeatures(4), "f16c", 2},
+		{"v4 without v2", levelFeatures(4), "sse4_2", 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			delete(tc.features, tc.missing)
+			if level := amd64Level(tc.features); level != tc.expected {
+				t.Errorf("Expected level %d, got %d", tc.expected, level)
+			}
+		})
+	}
+}
+
+func TestReadCPUFlags(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cpuinfo")
+	cpuinfo := "processor\t: 0\nflags\t\t: fpu cx16 lahf_lm abm\n\nprocessor\t: 1\nflags\t\t: fpu movbe\n"
+	err := os.WriteFile(path, []byte(cpuinfo), 0o644)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	flags, err := readCPUFlags(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	expected := map[string]bool{"fpu": true, "cx16": true, "lahf_lm": true, "abm": true}
+	if !reflect.DeepEqual(flags, expected) {
+		t.Errorf("Expected %v, got %v", expected, flags)
+	}
+
+	_, err = readCPUFlags(filepath.Join(t.TempDir(), "missing"))
+	if err == nil {
+		t.Error("Expected error for missing cpuinfo, got nil")
+	}
+}
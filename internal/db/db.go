@@ -30,16 +30,21 @@ import (
 	"github.com/jmoiron/sqlx"
 	"golang.org/x/exp/slices"
 	"github.com/sintan1729/lure/internal/config"
+	"github.com/sintan1729/lure/internal/flock"
+	"github.com/sintan1729/lure/internal/pkgdep"
+	"github.com/sintan1729/lure/internal/spdx"
 	"github.com/sintan1729/lure/pkg/loggerctx"
 	"modernc.org/sqlite"
 )
 
 // CurrentVersion is the current version of the database.
 // The database is reset if its version doesn't match this.
-const CurrentVersion = 2
+const CurrentVersion = 3
 
 func init() {
 	sqlite.MustRegisterScalarFunction("json_array_contains", 2, jsonArrayContains)
+	sqlite.MustRegisterScalarFunction("provides_contains", 2, providesContains)
+	sqlite.MustRegisterScalarFunction("license_contains", 2, licenseContains)
 }
 
 // Package is a LURE package's database representation
@@ -53,6 +58,7 @@ type Package struct {
 	Maintainer    JSON[map[string]string]   `db:"maintainer"`
 	Architectures JSON[[]string]            `sh:"architectures" db:"architectures"`
 	Licenses      JSON[[]string]            `sh:"license" db:"licenses"`
+	License       string                    `db:"license"`
 	Provides      JSON[[]string]            `sh:"provides" db:"provides"`
 	Conflicts     JSON[[]string]            `sh:"conflicts" db:"conflicts"`
 	Replaces      JSON[[]string]            `sh:"replaces" db:"replaces"`
@@ -104,6 +110,12 @@ func Open(ctx context.Context, dsn string) (*sqlx.DB, error) {
 	closed = false
 	mu.Unlock()
 
+	lock, err := Lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Release()
+
 	err = initDB(ctx, dsn)
 	if err != nil {
 		return nil, err
@@ -122,6 +134,12 @@ func Close() error {
 	}
 }
 
+// Lock takes an exclusive lock that prevents other LURE processes
+// from writing to the database at the same time.
+func Lock(ctx context.Context) (*flock.Lock, error) {
+	return flock.Acquire(ctx, config.GetPaths(ctx).DBPath+".lock")
+}
+
 // initDB initializes the database
 func initDB(ctx context.Context, dsn string) error {
 	log := loggerctx.From(ctx)
@@ -138,6 +156,7 @@ func initDB(ctx context.Context, dsn string) error {
 			maintainer    TEXT CHECK(maintainer = 'null' OR (JSON_VALID(maintainer) AND JSON_TYPE(maintainer) = 'object')),
 			architectures TEXT CHECK(architectures = 'null' OR (JSON_VALID(architectures) AND JSON_TYPE(architectures) = 'array')),
 			licenses      TEXT CHECK(licenses = 'null' OR (JSON_VALID(licenses) AND JSON_TYPE(licenses) = 'array')),
+			license       TEXT NOT NULL DEFAULT '',
 			provides      TEXT CHECK(provides = 'null' OR (JSON_VALID(provides) AND JSON_TYPE(provides) = 'array')),
 			conflicts     TEXT CHECK(conflicts = 'null' OR (JSON_VALID(conflicts) AND JSON_TYPE(conflicts) = 'array')),
 			replaces      TEXT CHECK(replaces = 'null' OR (JSON_VALID(replaces) AND JSON_TYPE(replaces) = 'array')),
@@ -199,6 +218,32 @@ func GetVersion(ctx context.Context) (int, bool) {
 	return ver.Version, true
 }
 
+// FileVersion returns the version of the database file at path, and a
+// boolean indicating whether it contained a version number. Unlike
+// Open, it doesn't reset the database if the version doesn't match.
+func FileVersion(ctx context.Context, path string) (int, bool, error) {
+	fileDB, err := sqlx.Open("sqlite", "file:"+path+"?mode=ro")
+	if err != nil {
+		return 0, false, err
+	}
+	defer fileDB.Close()
+
+	var exists bool
+	err = fileDB.GetContext(ctx, &exists, "SELECT count(1) > 0 FROM sqlite_master WHERE type = 'table' AND name = 'lure_db_version';")
+	if err != nil || !exists {
+		return 0, false, err
+	}
+
+	var ver version
+	err = fileDB.GetContext(ctx, &ver, "SELECT * FROM lure_db_version LIMIT 1;")
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	} else if err != nil {
+		return 0, false, err
+	}
+	return ver.Version, true, nil
+}
+
 func addVersion(ctx context.Context, ver int) error {
 	_, err := DB(ctx).ExecContext(ctx, `INSERT INTO lure_db_version(version) VALUES (?);`, ver)
 	return err
@@ -206,7 +251,15 @@ func addVersion(ctx context.Context, ver int) error {
 
 // InsertPackage adds a package to the database
 func InsertPackage(ctx context.Context, pkg Package) error {
-	_, err := DB(ctx).NamedExecContext(ctx, `
+	db := DB(ctx)
+
+	lock, err := Lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	_, err = db.NamedExecContext(ctx, `
 		INSERT OR REPLACE INTO pkgs (
 			name,
 			repository,
@@ -218,6 +271,7 @@ func InsertPackage(ctx context.Context, pkg Package) error {
 			maintainer,
 			architectures,
 			licenses,
+			license,
 			provides,
 			conflicts,
 			replaces,
@@ -235,6 +289,7 @@ func InsertPackage(ctx context.Context, pkg Package) error {
 			:maintainer,
 			:architectures,
 			:licenses,
+			:license,
 			:provides,
 			:conflicts,
 			:replaces,
@@ -264,7 +319,15 @@ func GetPkg(ctx context.Context, where string, args ...any) (*Package, error) {
 
 // DeletePkgs deletes all packages matching the where conditions
 func DeletePkgs(ctx context.Context, where string, args ...any) error {
-	_, err := DB(ctx).ExecContext(ctx, "DELETE FROM pkgs WHERE "+where, args...)
+	db := DB(ctx)
+
+	lock, err := Lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	_, err = db.ExecContext(ctx, "DELETE FROM pkgs WHERE "+where, args...)
 	return err
 }
 
@@ -290,6 +353,59 @@ func jsonArrayContains(ctx *sqlite.FunctionContext, args []driver.Value) (driver
 	return slices.Contains(array, item), nil
 }
 
+// providesContains is an SQLite function that checks if a JSON array
+// of provides contains a name, ignoring any version constraints,
+// so that foo=1.2 matches foo
+func providesContains(ctx *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+	value, ok := args[0].(string)
+	if !ok {
+		return nil, errors.New("both arguments to provides_contains must be strings")
+	}
+
+	name, ok := args[1].(string)
+	if !ok {
+		return nil, errors.New("both arguments to provides_contains must be strings")
+	}
+
+	var array []string
+	err := json.Unmarshal([]byte(value), &array)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range array {
+		if pkgdep.Name(item) == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// licenseContains is an SQLite function that checks if a normalized
+// SPDX license expression in the database uses a given license
+func licenseContains(ctx *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+	value, ok := args[0].(string)
+	if !ok {
+		return nil, errors.New("both arguments to license_contains must be strings")
+	}
+
+	license, ok := args[1].(string)
+	if !ok {
+		return nil, errors.New("both arguments to license_contains must be strings")
+	}
+
+	if value == "" {
+		return false, nil
+	}
+
+	expr, err := spdx.Parse(value)
+	if err != nil {
+		return false, nil
+	}
+
+	return expr.Contains(license), nil
+}
+
 // JSON represents a JSON value in the database
 type JSON[T any] struct {
 	Val T
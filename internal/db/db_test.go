@@ -20,6 +20,7 @@ package db_test
 
 import (
 	"context"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
@@ -261,3 +262,38 @@ func TestJsonArrayContains(t *testing.T) {
 		t.Errorf("Expected x2 package, got %s", dbPkg.Name)
 	}
 }
+
+func TestFileVersion(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "db")
+
+	fileDB, err := sqlx.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	defer fileDB.Close()
+
+	_, err = fileDB.Exec("CREATE TABLE pkgs (name TEXT);")
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	_, ok, err := db.FileVersion(ctx, path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	} else if ok {
+		t.Errorf("Expected version to be missing")
+	}
+
+	_, err = fileDB.Exec("CREATE TABLE lure_db_version (version INT NOT NULL); INSERT INTO lure_db_version VALUES (1);")
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	ver, ok, err := db.FileVersion(ctx, path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	} else if !ok || ver != 1 {
+		t.Errorf("Expected version 1, got %d (present: %t)", ver, ok)
+	}
+}
@@ -0,0 +1,306 @@
+/*
+ * LURE - Linux User REpository
+ * Copyright (C) 2023 Elara Musayelyan
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package dl
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/sintan1729/lure/internal/config"
+	"github.com/sintan1729/lure/pkg/loggerctx"
+)
+
+// credentials contains the credentials for a single host
+type credentials struct {
+	username string
+	password string
+	token    string
+	headers  map[string]string
+}
+
+// hasLogin returns true if c contains a username, password or token
+func (c credentials) hasLogin() bool {
+	return c.username != "" || c.password != "" || c.token != ""
+}
+
+// getCredentials returns the credentials for the host of u. Credentials
+// embedded in the URL take precedence over the ones in the LURE config,
+// which take precedence over the ones in the netrc file.
+func getCredentials(ctx context.Context, u *url.URL) credentials {
+	var c credentials
+
+	for _, auth := range config.Config(ctx).Auth {
+		if auth.Host == u.Host || auth.Host == u.Hostname() {
+			c = credentials{
+				username: auth.Username,
+				password: auth.Password,
+				token:    auth.Token,
+				headers:  auth.Headers,
+			}
+			break
+		}
+	}
+
+	if u.User != nil {
+		c.username = u.User.Username()
+		c.password, _ = u.User.Password()
+		c.token = ""
+	}
+
+	if c.password == "" && c.token == "" {
+		entry, ok, err := lookupNetrc(u.Hostname())
+		if err != nil {
+			loggerctx.From(ctx).Warn("Error reading netrc file").Err(err).Send()
+		} else if ok && (c.username == "" || c.username == entry.login) {
+			c.username = entry.login
+			c.password = entry.password
+		}
+	}
+
+	return c
+}
+
+// newHTTPRequest creates a GET request for u with the given credentials.
+// Credentials in the URL itself are moved into the Authorization header.
+func newHTTPRequest(ctx context.Context, u *url.URL, c credentials) (*http.Request, error) {
+	reqURL := *u
+	reqURL.User = nil
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	} else if c.username != "" || c.password != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	for k, v := range c.headers {
+		req.Header.Set(k, v)
+	}
+
+	return req, nil
+}
+
+// newHTTPClient returns an HTTP client that doesn't send the
+// extra headers from c if it's redirected to a different host.
+// The net/http package already does this for the Authorization
+// header, but it can't know which custom headers are secret.
+func newHTTPClient(c credentials) *http.Client {
+	return &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+
+			if req.URL.Host != via[0].URL.Host {
+				for k := range c.headers {
+					req.Header.Del(k)
+				}
+			}
+
+			return nil
+		},
+	}
+}
+
+// gitAuth returns the authentication method that should be used
+// to access the git repo at u. If it returns nil, go-git's default
+// behavior is used.
+func gitAuth(ctx context.Context, u *url.URL) (transport.AuthMethod, error) {
+	switch u.Scheme {
+	case "ssh":
+		if os.Getenv("SSH_AUTH_SOCK") == "" {
+			return nil, nil
+		}
+
+		user := "git"
+		if u.User != nil && u.User.Username() != "" {
+			user = u.User.Username()
+		}
+		return gitssh.NewSSHAgentAuth(user)
+	case "http", "https":
+		c := getCredentials(ctx, u)
+		if !c.hasLogin() {
+			var err error
+			c, err = gitCredentialFill(ctx, u)
+			if err != nil {
+				loggerctx.From(ctx).Warn("Error getting credentials from git credential helper").Err(err).Send()
+				return nil, nil
+			}
+		}
+
+		if c.token != "" {
+			// Git forges accept tokens as the password for
+			// HTTP basic auth, with any non-empty username
+			if c.username == "" {
+				c.username = "lure"
+			}
+			return &githttp.BasicAuth{Username: c.username, Password: c.token}, nil
+		} else if c.hasLogin() {
+			return &githttp.BasicAuth{Username: c.username, Password: c.password}, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// gitCredentialFill asks the credential helpers configured for git
+// for the credentials for u. If git isn't installed or no credential
+// helper is configured for u, it returns empty credentials.
+func gitCredentialFill(ctx context.Context, u *url.URL) (credentials, error) {
+	if _, err := exec.LookPath("git"); err != nil {
+		return credentials{}, nil
+	}
+
+	// Only run credential fill if a helper is configured,
+	// since git would prompt for a password otherwise
+	helper, err := exec.CommandContext(ctx, "git", "config", "--get-urlmatch", "credential.helper", u.Redacted()).Output()
+	if err != nil || strings.TrimSpace(string(helper)) == "" {
+		return credentials{}, nil
+	}
+
+	input := fmt.Sprintf("protocol=%s\nhost=%s\npath=%s\n\n", u.Scheme, u.Host, strings.TrimPrefix(u.Path, "/"))
+
+	cmd := exec.CommandContext(ctx, "git", "credential", "fill")
+	cmd.Stdin = strings.NewReader(input)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	out, err := cmd.Output()
+	if err != nil {
+		return credentials{}, err
+	}
+
+	var c credentials
+	sc := bufio.NewScanner(strings.NewReader(string(out)))
+	for sc.Scan() {
+		key, val, _ := strings.Cut(sc.Text(), "=")
+		switch key {
+		case "username":
+			c.username = val
+		case "password":
+			c.password = val
+		}
+	}
+
+	return c, sc.Err()
+}
+
+// netrcEntry represents a single machine in a netrc file.
+// The default entry has an empty machine name.
+type netrcEntry struct {
+	machine  string
+	login    string
+	password string
+}
+
+// lookupNetrc finds the entry for the given host in the netrc file.
+// It returns false if the file or a matching entry doesn't exist.
+func lookupNetrc(host string) (netrcEntry, bool, error) {
+	path := os.Getenv("NETRC")
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return netrcEntry{}, false, nil
+		}
+		path = filepath.Join(home, ".netrc")
+	}
+
+	fl, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return netrcEntry{}, false, nil
+	} else if err != nil {
+		return netrcEntry{}, false, err
+	}
+	defer fl.Close()
+
+	entries, err := parseNetrc(fl)
+	if err != nil {
+		return netrcEntry{}, false, err
+	}
+
+	for _, entry := range entries {
+		if entry.machine == host || entry.machine == "" {
+			return entry, true, nil
+		}
+	}
+
+	return netrcEntry{}, false, nil
+}
+
+// parseNetrc parses the contents of a netrc file
+func parseNetrc(r io.Reader) ([]netrcEntry, error) {
+	var entries []netrcEntry
+	var cur *netrcEntry
+	inMacro := false
+
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := sc.Text()
+
+		// Macro definitions continue until an empty line
+		if inMacro {
+			inMacro = strings.TrimSpace(line) != ""
+			continue
+		}
+
+		fields := strings.Fields(line)
+		for i := 0; i < len(fields); i++ {
+			switch fields[i] {
+			case "machine":
+				if i+1 < len(fields) {
+					i++
+					entries = append(entries, netrcEntry{machine: fields[i]})
+					cur = &entries[len(entries)-1]
+				}
+			case "default":
+				entries = append(entries, netrcEntry{})
+				cur = &entries[len(entries)-1]
+			case "login":
+				if i+1 < len(fields) && cur != nil {
+					i++
+					cur.login = fields[i]
+				}
+			case "password":
+				if i+1 < len(fields) && cur != nil {
+					i++
+					cur.password = fields[i]
+				}
+			case "macdef":
+				inMacro = true
+				i = len(fields)
+			}
+		}
+	}
+
+	return entries, sc.Err()
+}
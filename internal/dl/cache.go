@@ -0,0 +1,295 @@
+/*
+ * LURE - Linux User REpository
+ * Copyright (C) 2023 Elara Musayelyan
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package dl
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/sintan1729/lure/internal/config"
+	"github.com/sintan1729/lure/internal/dlcache"
+	"github.com/sintan1729/lure/internal/flock"
+	"github.com/sintan1729/lure/pkg/loggerctx"
+	"golang.org/x/exp/slices"
+)
+
+// ErrNotInCache occurs when a URL that isn't in the
+// download cache is looked up or removed.
+var ErrNotInCache = errors.New("dl: source is not in the download cache")
+
+// CacheEntry represents a single item in the download cache
+type CacheEntry struct {
+	Path string
+	Size int64
+	// Valid is false if the entry's manifest is
+	// missing or can't be read
+	Valid bool
+	Manifest
+}
+
+// CacheEntries returns all the entries in the download cache
+func CacheEntries(ctx context.Context) ([]CacheEntry, error) {
+	paths, err := dlcache.Entries(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]CacheEntry, 0, len(paths))
+	for _, path := range paths {
+		entry, err := getCacheEntry(path)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, entry)
+	}
+
+	return out, nil
+}
+
+// GetCacheEntry returns the download cache entry for the given URL
+func GetCacheEntry(ctx context.Context, u string) (CacheEntry, error) {
+	normalized, err := cacheKey(u)
+	if err != nil {
+		return CacheEntry{}, err
+	}
+
+	cacheDir, ok := dlcache.Get(ctx, normalized)
+	if !ok {
+		return CacheEntry{}, ErrNotInCache
+	}
+
+	return getCacheEntry(cacheDir)
+}
+
+// IsCached returns true if the source at u is in the download cache
+func IsCached(ctx context.Context, u string) bool {
+	key, err := cacheKey(u)
+	if err != nil {
+		return false
+	}
+	_, ok := dlcache.Get(ctx, key)
+	return ok
+}
+
+// MissingOffline returns the sources in urls that can't be used in
+// offline mode, because they're neither local nor in the download cache.
+// Any credentials are removed from the returned URLs.
+func MissingOffline(ctx context.Context, urls []string) []string {
+	var missing []string
+	for _, u := range urls {
+		if isLocal(u) || IsCached(ctx, u) {
+			continue
+		}
+
+		key, err := cacheKey(u)
+		if err != nil {
+			key = "<invalid URL>"
+		}
+		missing = append(missing, key)
+	}
+	return missing
+}
+
+// isLocal returns true if u refers to a file next to the build script
+func isLocal(u string) bool {
+	return strings.HasPrefix(u, "local://")
+}
+
+// RemoveCacheEntry removes the download cache entry for the given URL
+func RemoveCacheEntry(ctx context.Context, u string) error {
+	normalized, err := cacheKey(u)
+	if err != nil {
+		return err
+	}
+
+	lock, err := dlcache.Lock(ctx, normalized)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	if _, ok := dlcache.Get(ctx, normalized); !ok {
+		return ErrNotInCache
+	}
+
+	return dlcache.Remove(ctx, normalized)
+}
+
+// PruneOlderThan removes all the cache entries that haven't been
+// accessed within the given duration. It returns the removed entries.
+func PruneOlderThan(ctx context.Context, d time.Duration) ([]CacheEntry, error) {
+	entries, err := CacheEntries(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := time.Now().Add(-d)
+
+	var removed []CacheEntry
+	for _, entry := range entries {
+		if entry.LastAccess.After(cutoff) {
+			continue
+		}
+
+		ok, err := removeEntry(entry)
+		if err != nil {
+			return removed, err
+		} else if ok {
+			removed = append(removed, entry)
+		}
+	}
+
+	return removed, nil
+}
+
+// PruneToSize removes the least recently used cache entries until the
+// total size of the cache is at most maxSize bytes. Entries whose paths
+// are in keep are never removed. It returns the removed entries.
+func PruneToSize(ctx context.Context, maxSize int64, keep ...string) ([]CacheEntry, error) {
+	entries, err := CacheEntries(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var total int64
+	for _, entry := range entries {
+		total += entry.Size
+	}
+
+	// Sort the entries so that the least recently used ones come first
+	slices.SortFunc(entries, func(a, b CacheEntry) int {
+		return a.LastAccess.Compare(b.LastAccess)
+	})
+
+	var removed []CacheEntry
+	for _, entry := range entries {
+		if total <= maxSize {
+			break
+		}
+
+		if slices.Contains(keep, entry.Path) {
+			continue
+		}
+
+		ok, err := removeEntry(entry)
+		if err != nil {
+			return removed, err
+		} else if ok {
+			total -= entry.Size
+			removed = append(removed, entry)
+		}
+	}
+
+	return removed, nil
+}
+
+// MaxCacheSize returns the maximum size of the download cache in bytes,
+// as set in the LURE config. It returns false if the size isn't limited.
+func MaxCacheSize(ctx context.Context) (int64, bool, error) {
+	maxSize := config.Config(ctx).Cache.MaxSize
+	if maxSize == "" {
+		return 0, false, nil
+	}
+
+	size, err := humanize.ParseBytes(maxSize)
+	if err != nil {
+		return 0, false, err
+	}
+
+	return int64(size), true, nil
+}
+
+// enforceCacheLimit evicts the least recently used entries from the
+// download cache if it's larger than the size limit in the LURE config.
+// The entry at keep is never evicted.
+func enforceCacheLimit(ctx context.Context, keep string) error {
+	log := loggerctx.From(ctx)
+
+	maxSize, ok, err := MaxCacheSize(ctx)
+	if err != nil {
+		log.Warn("Invalid maximum cache size in config, not limiting cache size").Err(err).Send()
+		return nil
+	} else if !ok {
+		return nil
+	}
+
+	removed, err := PruneToSize(ctx, maxSize, keep)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range removed {
+		log.Info("Evicted source from download cache").Str("url", entry.URL).Send()
+	}
+
+	return nil
+}
+
+// removeEntry removes a cache entry unless it's currently in use by
+// another process, in which case it's skipped and false is returned.
+func removeEntry(entry CacheEntry) (bool, error) {
+	lock, err := dlcache.TryLockEntry(entry.Path)
+	if errors.Is(err, flock.ErrLocked) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	defer lock.Release()
+
+	err = os.RemoveAll(entry.Path)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// getCacheEntry reads the information about the cache entry at path.
+func getCacheEntry(path string) (CacheEntry, error) {
+	size, err := dlcache.Size(path)
+	if err != nil {
+		return CacheEntry{}, err
+	}
+
+	entry := CacheEntry{Path: path, Size: size}
+
+	m, err := getManifest(path)
+	if err == nil {
+		entry.Valid = true
+		entry.Manifest = m
+	}
+
+	// Manifests written by older versions of LURE don't contain the
+	// last access time, so use the modification time of the entry instead.
+	if entry.LastAccess.IsZero() {
+		fi, err := os.Stat(filepath.Join(path, manifestFileName))
+		if err != nil {
+			fi, err = os.Stat(path)
+		}
+		if err == nil {
+			entry.LastAccess = fi.ModTime()
+		}
+	}
+
+	return entry, nil
+}
@@ -0,0 +1,296 @@
+/*
+ * LURE - Linux User REpository
+ * Copyright (C) 2023 Elara Musayelyan
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package dl
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/sintan1729/lure/internal/config"
+	"github.com/sintan1729/lure/internal/dlcache"
+)
+
+// setTestCache points the download cache to a new temporary directory
+// for the duration of the test
+func setTestCache(t *testing.T) context.Context {
+	t.Helper()
+	ctx := context.Background()
+
+	paths := config.GetPaths(ctx)
+	oldCacheDir := paths.CacheDir
+	paths.CacheDir = t.TempDir()
+	t.Cleanup(func() { paths.CacheDir = oldCacheDir })
+
+	return ctx
+}
+
+// writeTestEntry adds an entry for u to the download cache, containing
+// a file of the given size and a manifest with the given access time
+func writeTestEntry(t *testing.T, ctx context.Context, u string, size int, lastAccess time.Time) string {
+	t.Helper()
+
+	key, err := cacheKey(u)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	cacheDir, err := dlcache.New(ctx, key)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	err = os.WriteFile(filepath.Join(cacheDir, "file"), make([]byte, size), 0o644)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	err = writeManifest(cacheDir, Manifest{Type: TypeFile, Name: "file", URL: key, LastAccess: lastAccess})
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	return cacheDir
+}
+
+// lockTestEntry locks the cache entry for u as if it was
+// being used by another LURE process
+func lockTestEntry(t *testing.T, ctx context.Context, u string) {
+	t.Helper()
+
+	key, err := cacheKey(u)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	lock, err := dlcache.Lock(ctx, key)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	t.Cleanup(func() { lock.Release() })
+}
+
+// cacheSize returns the total size of the download cache
+func cacheSize(t *testing.T, ctx context.Context) int64 {
+	t.Helper()
+
+	entries, err := CacheEntries(ctx)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	var total int64
+	for _, entry := range entries {
+		total += entry.Size
+	}
+	return total
+}
+
+// expectEntries checks that exactly the given paths remain in the cache
+func expectEntries(t *testing.T, ctx context.Context, expected ...string) {
+	t.Helper()
+
+	paths, err := dlcache.Entries(ctx)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	slices.Sort(paths)
+	slices.Sort(expected)
+	if !slices.Equal(paths, expected) {
+		t.Errorf("Expected cache entries %v, got %v", expected, paths)
+	}
+}
+
+// removedPaths returns the paths of the removed entries
+func removedPaths(removed []CacheEntry) []string {
+	out := make([]string, len(removed))
+	for i, entry := range removed {
+		out[i] = entry.Path
+	}
+	return out
+}
+
+func TestPruneOlderThan(t *testing.T) {
+	ctx := setTestCache(t)
+	now := time.Now()
+
+	old := writeTestEntry(t, ctx, "https://example.com/old", 10, now.Add(-48*time.Hour))
+	recent := writeTestEntry(t, ctx, "https://example.com/recent", 10, now.Add(-time.Hour))
+
+	// Entries written by older versions of LURE have no access time
+	// in their manifest, so the modification time is used instead
+	legacy := writeTestEntry(t, ctx, "https://example.com/legacy", 10, time.Time{})
+	err := os.Chtimes(filepath.Join(legacy, manifestFileName), now, now.Add(-72*time.Hour))
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	removed, err := PruneOlderThan(ctx, 24*time.Hour)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	got := removedPaths(removed)
+	slices.Sort(got)
+	expected := []string{old, legacy}
+	slices.Sort(expected)
+	if !slices.Equal(got, expected) {
+		t.Errorf("Expected %v to be removed, got %v", expected, got)
+	}
+	expectEntries(t, ctx, recent)
+}
+
+func TestPruneOlderThanSkipsLocked(t *testing.T) {
+	ctx := setTestCache(t)
+	now := time.Now()
+
+	locked := writeTestEntry(t, ctx, "https://example.com/locked", 10, now.Add(-48*time.Hour))
+	writeTestEntry(t, ctx, "https://example.com/old", 10, now.Add(-48*time.Hour))
+	lockTestEntry(t, ctx, "https://example.com/locked")
+
+	removed, err := PruneOlderThan(ctx, 24*time.Hour)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	if len(removed) != 1 || removed[0].URL != "https://example.com/old" {
+		t.Errorf("Expected only the unlocked entry to be removed, got %v", removedPaths(removed))
+	}
+	expectEntries(t, ctx, locked)
+}
+
+func TestPruneToSize(t *testing.T) {
+	now := time.Now()
+
+	type testCase struct {
+		name string
+		// keep and locked contain indices of the entries,
+		// which are ordered from least to most recently used
+		keep     []int
+		locked   []int
+		excess   int64
+		expected []int
+	}
+
+	tests := []testCase{
+		{
+			name:     "least recently used",
+			excess:   1,
+			expected: []int{0},
+		},
+		{
+			name:     "several entries",
+			excess:   1500,
+			expected: []int{0, 1},
+		},
+		{
+			name:     "kept entry",
+			keep:     []int{0},
+			excess:   1,
+			expected: []int{1},
+		},
+		{
+			name:     "locked entry",
+			locked:   []int{0},
+			excess:   1,
+			expected: []int{1},
+		},
+		{
+			name:     "under the limit",
+			expected: nil,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := setTestCache(t)
+
+			// Write the entries out of order, so that the
+			// order of the directory doesn't matter
+			urls := []string{"https://example.com/a", "https://example.com/b", "https://example.com/c"}
+			ages := []time.Duration{3 * time.Hour, 2 * time.Hour, time.Hour}
+			paths := make([]string, len(urls))
+			for _, i := range []int{2, 0, 1} {
+				paths[i] = writeTestEntry(t, ctx, urls[i], 1000, now.Add(-ages[i]))
+			}
+
+			var keep []string
+			for _, i := range tc.keep {
+				keep = append(keep, paths[i])
+			}
+			for _, i := range tc.locked {
+				lockTestEntry(t, ctx, urls[i])
+			}
+
+			removed, err := PruneToSize(ctx, cacheSize(t, ctx)-tc.excess, keep...)
+			if err != nil {
+				t.Fatalf("Expected no error, got %s", err)
+			}
+
+			var expected, remaining []string
+			for i, path := range paths {
+				if slices.Contains(tc.expected, i) {
+					expected = append(expected, path)
+				} else {
+					remaining = append(remaining, path)
+				}
+			}
+
+			if got := removedPaths(removed); !slices.Equal(got, expected) {
+				t.Errorf("Expected %v to be removed, got %v", expected, got)
+			}
+			expectEntries(t, ctx, remaining...)
+		})
+	}
+}
+
+func TestEnforceCacheLimit(t *testing.T) {
+	ctx := setTestCache(t)
+	now := time.Now()
+
+	cfg := config.Config(ctx)
+	oldMaxSize := cfg.Cache.MaxSize
+	t.Cleanup(func() { cfg.Cache.MaxSize = oldMaxSize })
+
+	older := writeTestEntry(t, ctx, "https://example.com/older", 100, now.Add(-2*time.Hour))
+	old := writeTestEntry(t, ctx, "https://example.com/old", 100, now.Add(-time.Hour))
+	// The entry that was just downloaded is the oldest one here,
+	// but it must never be evicted
+	current := writeTestEntry(t, ctx, "https://example.com/current", 100, now.Add(-3*time.Hour))
+
+	// An invalid size doesn't limit the cache
+	cfg.Cache.MaxSize = "not a size"
+	err := enforceCacheLimit(ctx, current)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	expectEntries(t, ctx, older, old, current)
+
+	cfg.Cache.MaxSize = strconv.FormatInt(cacheSize(t, ctx)-1, 10)
+	err = enforceCacheLimit(ctx, current)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	expectEntries(t, ctx, old, current)
+}
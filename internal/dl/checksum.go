@@ -0,0 +1,80 @@
+/*
+ * LURE - Linux User REpository
+ * Copyright (C) 2023 Elara Musayelyan
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package dl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// ErrNoChecksum occurs when a checksum is requested for a source
+// that's downloaded as a directory, such as a git repo.
+var ErrNoChecksum = errors.New("dl: checksums can only be computed for files")
+
+// Checksum downloads the file at opts.URL into opts.Destination, without
+// extracting or caching it, and returns its checksum using the algorithm
+// in opts.HashAlgorithm. The checksum is computed over the downloaded file
+// itself, which is what's verified when the source is downloaded normally.
+func Checksum(ctx context.Context, opts Options) ([]byte, error) {
+	normalized, err := normalizeURL(opts.URL)
+	if err != nil {
+		return nil, err
+	}
+	opts.URL = normalized
+
+	d := getDownloader(opts.URL)
+	if _, ok := d.(FileDownloader); !ok {
+		return nil, fmt.Errorf("%w: %s downloader", ErrNoChecksum, d.Name())
+	}
+
+	if opts.Offline && !isLocal(opts.URL) {
+		key, _ := cacheKey(opts.URL)
+		return nil, fmt.Errorf("%w: %s", ErrOffline, key)
+	}
+
+	h, err := opts.NewHash()
+	if err != nil {
+		return nil, err
+	}
+
+	opts.Hash = nil
+	opts.PostprocDisabled = true
+
+	_, name, err := d.Download(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	fl, err := os.Open(filepath.Join(opts.Destination, name))
+	if err != nil {
+		return nil, err
+	}
+	defer fl.Close()
+
+	_, err = io.Copy(h, fl)
+	if err != nil {
+		return nil, err
+	}
+
+	return h.Sum(nil), nil
+}
@@ -30,9 +30,11 @@ import (
 	"fmt"
 	"hash"
 	"io"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/PuerkitoBio/purell"
 	"github.com/vmihailenco/msgpack/v5"
@@ -47,15 +49,26 @@ const manifestFileName = ".lure_cache_manifest"
 
 // ErrChecksumMismatch occurs when the checksum of a downloaded file
 // does not match the expected checksum provided in the Options struct.
+//
+// ErrUnsafePath occurs when a file name or archive entry would be
+// written outside of the destination directory.
+//
+// ErrOffline occurs when a source that isn't in the download cache
+// is requested in offline mode.
 var (
 	ErrChecksumMismatch = errors.New("dl: checksums did not match")
 	ErrNoSuchHashAlgo   = errors.New("dl: invalid hashing algorithm")
+	ErrUnsafePath       = errors.New("dl: path escapes the destination directory")
+	ErrOffline          = errors.New("dl: sources are not available offline")
 )
 
 // Downloaders contains all the downloaders in the order in which
 // they should be checked
 var Downloaders = []Downloader{
 	GitDownloader{},
+	HgDownloader{},
+	SvnDownloader{},
+	FossilDownloader{},
 	TorrentDownloader{},
 	FileDownloader{},
 }
@@ -88,8 +101,11 @@ type Options struct {
 	Destination      string
 	CacheDisabled    bool
 	PostprocDisabled bool
-	Progress         io.Writer
-	LocalDir         string
+	// Offline prevents any network access. Only local
+	// sources and sources in the cache can be used.
+	Offline  bool
+	Progress io.Writer
+	LocalDir string
 }
 
 func (opts Options) NewHash() (hash.Hash, error) {
@@ -125,6 +141,11 @@ func (opts Options) NewHash() (hash.Hash, error) {
 type Manifest struct {
 	Type Type
 	Name string
+	// URL is the normalized URL the entry was downloaded from
+	URL string
+	// LastAccess is the last time the entry was
+	// downloaded, updated, or linked from the cache
+	LastAccess time.Time
 }
 
 type Downloader interface {
@@ -137,8 +158,9 @@ type Downloader interface {
 	// provided in the options, to the destination
 	// given in the options. It returns a type,
 	// a name for the downloaded object (this may be empty),
-	// and an error.
-	Download(Options) (Type, string, error)
+	// and an error. The download should be stopped
+	// as soon as possible if the context is canceled.
+	Download(context.Context, Options) (Type, string, error)
 }
 
 // UpdatingDownloader extends the Downloader interface
@@ -151,7 +173,7 @@ type UpdatingDownloader interface {
 	// described in the options. It returns
 	// true if an update was performed, or
 	// false if no update was required.
-	Update(Options) (bool, error)
+	Update(context.Context, Options) (bool, error)
 }
 
 // Download downloads a file or directory using the specified options.
@@ -161,30 +183,51 @@ type UpdatingDownloader interface {
 // If the source is found in the cache, it links it to the destination
 // using hard links. If the source is not found in the cache,
 // it downloads the source to a new cache directory and links it
-// to the destination.
-func Download(ctx context.Context, opts Options) (err error) {
+// to the destination. It returns the name of the file or directory
+// that was created inside the destination.
+func Download(ctx context.Context, opts Options) (name string, err error) {
 	log := loggerctx.From(ctx)
 	normalized, err := normalizeURL(opts.URL)
 	if err != nil {
-		return err
+		return "", err
 	}
 	opts.URL = normalized
 
+	// The cache key is stored in the manifest, so it
+	// must not contain any credentials from the URL
+	key, err := cacheKey(opts.URL)
+	if err != nil {
+		return "", err
+	}
+
 	d := getDownloader(opts.URL)
 
 	if opts.CacheDisabled {
-		_, _, err = d.Download(opts)
-		return err
+		if opts.Offline && !isLocal(opts.URL) {
+			return "", fmt.Errorf("%w: %s", ErrOffline, key)
+		}
+
+		_, name, err = d.Download(ctx, opts)
+		return name, err
+	}
+
+	// Hold the lock for this cache entry until we're done with it,
+	// so that other LURE processes don't modify or delete it while
+	// it's being downloaded or linked.
+	lock, err := dlcache.Lock(ctx, key)
+	if err != nil {
+		return "", err
 	}
+	defer lock.Release()
 
 	var t Type
-	cacheDir, ok := dlcache.Get(ctx, opts.URL)
+	cacheDir, ok := dlcache.Get(ctx, key)
 	if ok {
 		var updated bool
-		if d, ok := d.(UpdatingDownloader); ok {
+		if d, ok := d.(UpdatingDownloader); ok && !opts.Offline {
 			log.Info("Source can be updated, updating if required").Str("source", opts.Name).Str("downloader", d.Name()).Send()
 
-			updated, err = d.Update(Options{
+			updated, err = d.Update(ctx, Options{
 				Hash:          opts.Hash,
 				HashAlgorithm: opts.HashAlgorithm,
 				Name:          opts.Name,
@@ -194,7 +237,12 @@ func Download(ctx context.Context, opts Options) (err error) {
 				LocalDir:      opts.LocalDir,
 			})
 			if err != nil {
-				return err
+				// If the update was interrupted, the cache entry may be
+				// left in an inconsistent state, so remove it.
+				if ctx.Err() != nil {
+					_ = os.RemoveAll(cacheDir)
+				}
+				return "", err
 			}
 		}
 
@@ -205,15 +253,23 @@ func Download(ctx context.Context, opts Options) (err error) {
 			dest := filepath.Join(opts.Destination, m.Name)
 			ok, err := handleCache(cacheDir, dest, m.Name, t)
 			if err != nil {
-				return err
+				return "", err
+			}
+
+			if ok {
+				m.LastAccess = time.Now()
+				err = writeManifest(cacheDir, m)
+				if err != nil {
+					return "", err
+				}
 			}
 
 			if ok && !updated {
 				log.Info("Source found in cache and linked to destination").Str("source", opts.Name).Stringer("type", t).Send()
-				return nil
+				return m.Name, nil
 			} else if ok {
 				log.Info("Source updated and linked to destination").Str("source", opts.Name).Stringer("type", t).Send()
-				return nil
+				return m.Name, nil
 			}
 		} else {
 			// If we cannot read the manifest,
@@ -221,19 +277,23 @@ func Download(ctx context.Context, opts Options) (err error) {
 			// the source must be re-downloaded.
 			err = os.RemoveAll(cacheDir)
 			if err != nil {
-				return err
+				return "", err
 			}
 		}
 	}
 
+	if opts.Offline && !isLocal(opts.URL) {
+		return "", fmt.Errorf("%w: %s", ErrOffline, key)
+	}
+
 	log.Info("Downloading source").Str("source", opts.Name).Str("downloader", d.Name()).Send()
 
-	cacheDir, err = dlcache.New(ctx, opts.URL)
+	cacheDir, err = dlcache.New(ctx, key)
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	t, name, err := d.Download(Options{
+	t, name, err = d.Download(ctx, Options{
 		Hash:          opts.Hash,
 		HashAlgorithm: opts.HashAlgorithm,
 		Name:          opts.Name,
@@ -243,17 +303,28 @@ func Download(ctx context.Context, opts Options) (err error) {
 		LocalDir:      opts.LocalDir,
 	})
 	if err != nil {
-		return err
+		// Don't leave half-written sources in the cache
+		_ = os.RemoveAll(cacheDir)
+		return "", err
 	}
 
-	err = writeManifest(cacheDir, Manifest{t, name})
+	err = writeManifest(cacheDir, Manifest{
+		Type:       t,
+		Name:       name,
+		URL:        key,
+		LastAccess: time.Now(),
+	})
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	dest := filepath.Join(opts.Destination, name)
 	_, err = handleCache(cacheDir, dest, name, t)
-	return err
+	if err != nil {
+		return "", err
+	}
+
+	return name, enforceCacheLimit(ctx, cacheDir)
 }
 
 // writeManifest writes the manifest to the specified cache directory.
@@ -313,6 +384,12 @@ func handleCache(cacheDir, dest, name string, t Type) (bool, error) {
 	return false, nil
 }
 
+// cacheOnlyFiles contains the files at the top of a cache entry that
+// are only needed to maintain the entry, so they're never linked into
+// the destination. This includes the checkout state of VCSes such as
+// fossil, which keep it outside the checkout's own directory.
+var cacheOnlyFiles = []string{manifestFileName, fossilRepoName, ".fslckout", "_FOSSIL_"}
+
 // linkDir recursively walks through a directory, creating
 // hard links for each file from the src directory to the
 // dest directory. If it encounters a directory, it will
@@ -325,15 +402,15 @@ func linkDir(src, dest string) error {
 			return err
 		}
 
-		if info.Name() == manifestFileName {
-			return nil
-		}
-
 		rel, err := filepath.Rel(src, path)
 		if err != nil {
 			return err
 		}
 
+		if slices.Contains(cacheOnlyFiles, rel) {
+			return nil
+		}
+
 		newPath := filepath.Join(dest, rel)
 		if info.IsDir() {
 			return os.MkdirAll(newPath, info.Mode())
@@ -377,3 +454,23 @@ func normalizeURL(u string) (string, error) {
 	u = strings.Replace(u, "magnet://", "magnet:", 1)
 	return u, nil
 }
+
+// cacheKey returns the normalized form of u without any
+// username or password, which is used to identify its
+// entry in the download cache.
+func cacheKey(u string) (string, error) {
+	normalized, err := normalizeURL(u)
+	if err != nil {
+		return "", err
+	}
+
+	parsed, err := url.Parse(normalized)
+	if err != nil || parsed.User == nil {
+		// Some URLs, such as magnet links, can't contain
+		// credentials, so they can be used as-is.
+		return normalized, nil
+	}
+
+	parsed.User = nil
+	return parsed.String(), nil
+}
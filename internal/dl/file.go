@@ -21,19 +21,24 @@ package dl
 import (
 	"bytes"
 	"context"
+	"errors"
+	"fmt"
 	"io"
+	"io/fs"
 	"mime"
 	"net/http"
 	"net/url"
 	"os"
 	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/mholt/archives"
 	"github.com/schollz/progressbar/v3"
 	"github.com/sintan1729/lure/internal/shutils/handlers"
+	"github.com/sintan1729/lure/pkg/loggerctx"
 )
 
 // FileDownloader downloads files using HTTP
@@ -52,7 +57,7 @@ func (FileDownloader) MatchURL(string) bool {
 
 // Download downloads a file using HTTP. If the file is
 // compressed using a supported format, it will be extracted
-func (FileDownloader) Download(opts Options) (Type, string, error) {
+func (FileDownloader) Download(ctx context.Context, opts Options) (Type, string, error) {
 	u, err := url.Parse(opts.URL)
 	if err != nil {
 		return 0, "", err
@@ -66,6 +71,11 @@ func (FileDownloader) Download(opts Options) (Type, string, error) {
 	archive := query.Get("~archive")
 	query.Del("~archive")
 
+	xo, err := parseExtractOptions(query)
+	if err != nil {
+		return 0, "", err
+	}
+
 	u.RawQuery = query.Encode()
 
 	var r io.ReadCloser
@@ -85,10 +95,22 @@ func (FileDownloader) Download(opts Options) (Type, string, error) {
 		}
 		r = localFl
 	} else {
-		res, err := http.Get(u.String())
+		creds := getCredentials(ctx, u)
+
+		req, err := newHTTPRequest(ctx, u, creds)
+		if err != nil {
+			return 0, "", err
+		}
+
+		res, err := newHTTPClient(creds).Do(req)
 		if err != nil {
 			return 0, "", err
 		}
+		defer res.Body.Close()
+
+		if res.StatusCode >= 400 {
+			return 0, "", fmt.Errorf("dl: unexpected HTTP status: %s", res.Status)
+		}
 		size = res.ContentLength
 		if name == "" {
 			name = getFilename(res)
@@ -97,7 +119,11 @@ func (FileDownloader) Download(opts Options) (Type, string, error) {
 	}
 	defer r.Close()
 
-	opts.PostprocDisabled = archive == "false"
+	if !filepath.IsLocal(name) {
+		return 0, "", fmt.Errorf("%w: %s", ErrUnsafePath, name)
+	}
+
+	opts.PostprocDisabled = opts.PostprocDisabled || archive == "false"
 
 	path := filepath.Join(opts.Destination, name)
 	fl, err := os.Create(path)
@@ -108,21 +134,7 @@ func (FileDownloader) Download(opts Options) (Type, string, error) {
 
 	var bar io.WriteCloser
 	if opts.Progress != nil {
-		bar = progressbar.NewOptions64(
-			size,
-			progressbar.OptionSetDescription(name),
-			progressbar.OptionSetWriter(opts.Progress),
-			progressbar.OptionShowBytes(true),
-			progressbar.OptionSetWidth(10),
-			progressbar.OptionThrottle(65*time.Millisecond),
-			progressbar.OptionShowCount(),
-			progressbar.OptionOnCompletion(func() {
-				_, _ = io.WriteString(opts.Progress, "\n")
-			}),
-			progressbar.OptionSpinnerType(14),
-			progressbar.OptionFullWidth(),
-			progressbar.OptionSetRenderBlankState(true),
-		)
+		bar = newProgressBar(opts.Progress, size, name)
 		defer bar.Close()
 	} else {
 		bar = handlers.NopRWC{}
@@ -162,14 +174,14 @@ func (FileDownloader) Download(opts Options) (Type, string, error) {
 		return 0, "", err
 	}
 
-	format, ar, err := archives.Identify(context.Background(), name, fl)
+	format, ar, err := archives.Identify(ctx, name, fl)
 	if err == archives.NoMatch {
 		return TypeFile, name, nil
 	} else if err != nil {
 		return 0, "", err
 	}
 
-	err = extractFile(ar, format, name, opts)
+	err = extractFile(ctx, ar, format, name, xo, opts)
 	if err != nil {
 		return 0, "", err
 	}
@@ -178,51 +190,167 @@ func (FileDownloader) Download(opts Options) (Type, string, error) {
 	return TypeDir, "", err
 }
 
+// extractOptions contains the options that control
+// which archive entries are extracted and where
+type extractOptions struct {
+	// strip is the number of leading path components
+	// to remove from each entry
+	strip int
+	// subdir is the directory inside the archive
+	// whose contents should be extracted
+	subdir string
+}
+
+// parseExtractOptions parses and removes the ~strip and
+// ~subdir parameters from the query
+func parseExtractOptions(query url.Values) (extractOptions, error) {
+	var xo extractOptions
+
+	if strip := query.Get("~strip"); strip != "" {
+		n, err := strconv.Atoi(strip)
+		if err != nil {
+			return xo, err
+		} else if n < 0 {
+			return xo, fmt.Errorf("dl: invalid ~strip value: %d", n)
+		}
+		xo.strip = n
+	}
+	query.Del("~strip")
+
+	if subdir := query.Get("~subdir"); subdir != "" {
+		subdir = path.Clean(strings.TrimPrefix(subdir, "./"))
+		if !filepath.IsLocal(subdir) {
+			return xo, fmt.Errorf("%w: %s", ErrUnsafePath, subdir)
+		}
+		if subdir != "." {
+			xo.subdir = subdir
+		}
+	}
+	query.Del("~subdir")
+
+	return xo, nil
+}
+
+// entryPath returns the path relative to the destination directory
+// at which the archive entry with the given name should be extracted.
+// It returns false if the entry should be skipped because it's outside
+// of the subdirectory or has too few components to be stripped.
+// Entries that would escape the destination cause ErrUnsafePath.
+func (xo extractOptions) entryPath(name string) (string, bool, error) {
+	clean := path.Clean(strings.TrimPrefix(filepath.ToSlash(name), "./"))
+	if !filepath.IsLocal(clean) {
+		return "", false, fmt.Errorf("%w: %s", ErrUnsafePath, name)
+	}
+
+	if xo.subdir != "" {
+		if clean == xo.subdir {
+			clean = "."
+		} else if rest, ok := strings.CutPrefix(clean, xo.subdir+"/"); ok {
+			clean = rest
+		} else {
+			return "", false, nil
+		}
+	}
+
+	if xo.strip > 0 {
+		if clean == "." {
+			return "", false, nil
+		}
+		parts := strings.Split(clean, "/")
+		if len(parts) <= xo.strip {
+			return "", false, nil
+		}
+		clean = path.Join(parts[xo.strip:]...)
+	}
+
+	return filepath.FromSlash(clean), true, nil
+}
+
 // extractFile extracts an archive or decompresses a file
-func extractFile(r io.Reader, format archives.Format, name string, opts Options) (err error) {
+func extractFile(ctx context.Context, r io.Reader, format archives.Format, name string, xo extractOptions, opts Options) (err error) {
 	fname := format.Extension()
 
 	switch format := format.(type) {
 	case archives.Extractor:
-		err = format.Extract(context.Background(), r, func(ctx context.Context, f archives.FileInfo) error {
-			fr, err := f.Open()
+		// os.Root makes sure nothing is written outside the destination,
+		// even if the archive contains symlinks that point out of it.
+		root, err := os.OpenRoot(opts.Destination)
+		if err != nil {
+			return err
+		}
+		defer root.Close()
+
+		// Directory modification times are set after everything has been
+		// extracted, because creating files inside them changes their mtime.
+		var dirs []archives.FileInfo
+		var dirPaths []string
+
+		err = format.Extract(ctx, r, func(ctx context.Context, f archives.FileInfo) error {
+			path, ok, err := xo.entryPath(f.NameInArchive)
 			if err != nil {
 				return err
+			} else if !ok {
+				return nil
 			}
-			defer fr.Close()
-			fi, err := f.Stat()
+
+			switch {
+			case f.IsDir():
+				err = root.MkdirAll(path, 0o755)
+				if err != nil {
+					return err
+				}
+				dirs = append(dirs, f)
+				dirPaths = append(dirPaths, path)
+				return nil
+			case f.Mode()&fs.ModeSymlink != 0:
+				return extractSymlink(ctx, root, path, f)
+			case f.LinkTarget != "":
+				return extractHardlink(ctx, root, path, xo, f)
+			case !f.Mode().IsRegular():
+				loggerctx.From(ctx).Warn("Skipping unsupported archive entry").Str("name", f.NameInArchive).Send()
+				return nil
+			}
+
+			err = root.MkdirAll(filepath.Dir(path), 0o755)
 			if err != nil {
 				return err
 			}
-			fm := fi.Mode()
 
-			path := filepath.Join(opts.Destination, f.NameInArchive)
+			fr, err := f.Open()
+			if err != nil {
+				return err
+			}
+			defer fr.Close()
 
-			err = os.MkdirAll(filepath.Dir(path), 0o755)
+			outFl, err := root.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, f.Mode().Perm())
 			if err != nil {
 				return err
 			}
 
-			if f.IsDir() {
-				err = os.Mkdir(path, 0o755)
-				if err != nil {
-					return err
-				}
-			} else {
-				outFl, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, fm.Perm())
-				if err != nil {
-					return err
-				}
-				defer outFl.Close()
+			_, err = io.Copy(outFl, fr)
+			if err != nil {
+				outFl.Close()
+				return err
+			}
 
-				_, err = io.Copy(outFl, fr)
+			err = outFl.Close()
+			if err != nil {
 				return err
 			}
-			return nil
+
+			return root.Chtimes(path, f.ModTime(), f.ModTime())
 		})
 		if err != nil {
 			return err
 		}
+
+		// Go in reverse so that parent directories are set after their children
+		for i := len(dirs) - 1; i >= 0; i-- {
+			err = root.Chtimes(dirPaths[i], dirs[i].ModTime(), dirs[i].ModTime())
+			if err != nil {
+				return err
+			}
+		}
 	case archives.Decompressor:
 		rc, err := format.OpenReader(r)
 		if err != nil {
@@ -247,6 +375,81 @@ func extractFile(r io.Reader, format archives.Format, name string, opts Options)
 	return nil
 }
 
+// extractSymlink creates a symlink from an archive inside root. Symlinks
+// that point outside of root are skipped, since build scripts could
+// otherwise be tricked into reading or writing files outside of srcdir.
+func extractSymlink(ctx context.Context, root *os.Root, name string, f archives.FileInfo) error {
+	target := filepath.ToSlash(f.LinkTarget)
+	resolved := path.Join(path.Dir(filepath.ToSlash(name)), target)
+	if path.IsAbs(target) || !filepath.IsLocal(resolved) {
+		loggerctx.From(ctx).Warn("Skipping symlink that points outside of the source directory").
+			Str("name", f.NameInArchive).
+			Str("target", f.LinkTarget).
+			Send()
+		return nil
+	}
+
+	err := root.MkdirAll(filepath.Dir(name), 0o755)
+	if err != nil {
+		return err
+	}
+
+	err = root.Remove(name)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	return root.Symlink(f.LinkTarget, name)
+}
+
+// extractHardlink creates a hard link from an archive inside root.
+// The target of a hard link is another entry in the same archive,
+// so it's resolved the same way as the entry's own name.
+func extractHardlink(ctx context.Context, root *os.Root, name string, xo extractOptions, f archives.FileInfo) error {
+	target, ok, err := xo.entryPath(f.LinkTarget)
+	if err != nil {
+		return err
+	} else if !ok {
+		loggerctx.From(ctx).Warn("Skipping hard link to a file that wasn't extracted").
+			Str("name", f.NameInArchive).
+			Str("target", f.LinkTarget).
+			Send()
+		return nil
+	}
+
+	err = root.MkdirAll(filepath.Dir(name), 0o755)
+	if err != nil {
+		return err
+	}
+
+	err = root.Remove(name)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	return root.Link(target, name)
+}
+
+// newProgressBar creates a progress bar for a download of the given
+// size, which writes its output to w.
+func newProgressBar(w io.Writer, size int64, name string) *progressbar.ProgressBar {
+	return progressbar.NewOptions64(
+		size,
+		progressbar.OptionSetDescription(name),
+		progressbar.OptionSetWriter(w),
+		progressbar.OptionShowBytes(true),
+		progressbar.OptionSetWidth(10),
+		progressbar.OptionThrottle(65*time.Millisecond),
+		progressbar.OptionShowCount(),
+		progressbar.OptionOnCompletion(func() {
+			_, _ = io.WriteString(w, "\n")
+		}),
+		progressbar.OptionSpinnerType(14),
+		progressbar.OptionFullWidth(),
+		progressbar.OptionSetRenderBlankState(true),
+	)
+}
+
 // getFilename attempts to parse the Content-Disposition
 // HTTP response header and extract a filename. If the
 // header does not exist, it will use the last element
@@ -257,7 +460,9 @@ func getFilename(res *http.Response) (name string) {
 		return path.Base(res.Request.URL.Path)
 	}
 	if filename, ok := params["filename"]; ok {
-		return filename
+		// The server controls this header, so only keep the
+		// base name to prevent it from escaping the destination
+		return path.Base(filename)
 	} else {
 		return path.Base(res.Request.URL.Path)
 	}
@@ -0,0 +1,186 @@
+/*
+ * LURE - Linux User REpository
+ * Copyright (C) 2023 Elara Musayelyan
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package dl
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var testModTime = time.Date(2023, time.March, 14, 15, 9, 26, 0, time.UTC)
+
+// writeTestTar writes a tar archive containing the given headers
+// to a file called test.tar in dir. Regular files get their name
+// as their content.
+func writeTestTar(t *testing.T, dir string, hdrs []*tar.Header) {
+	t.Helper()
+
+	fl, err := os.Create(filepath.Join(dir, "test.tar"))
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	defer fl.Close()
+
+	tw := tar.NewWriter(fl)
+	for _, hdr := range hdrs {
+		var content []byte
+		if hdr.Typeflag == tar.TypeReg {
+			content = []byte(hdr.Name)
+			hdr.Size = int64(len(content))
+		}
+		if hdr.Mode == 0 {
+			hdr.Mode = 0o644
+		}
+		hdr.ModTime = testModTime
+
+		err = tw.WriteHeader(hdr)
+		if err != nil {
+			t.Fatalf("Expected no error, got %s", err)
+		}
+		_, err = tw.Write(content)
+		if err != nil {
+			t.Fatalf("Expected no error, got %s", err)
+		}
+	}
+
+	err = tw.Close()
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+}
+
+func downloadTestTar(t *testing.T, query string, hdrs []*tar.Header) (string, error) {
+	t.Helper()
+
+	localDir := t.TempDir()
+	dest := t.TempDir()
+	writeTestTar(t, localDir, hdrs)
+
+	_, _, err := FileDownloader{}.Download(context.Background(), Options{
+		URL:         "local:///test.tar" + query,
+		Destination: dest,
+		LocalDir:    localDir,
+	})
+	return dest, err
+}
+
+func TestExtractPathTraversal(t *testing.T) {
+	names := []string{"../evil.txt", "foo/../../evil.txt", "/tmp/evil.txt"}
+	for _, name := range names {
+		t.Run(name, func(t *testing.T) {
+			_, err := downloadTestTar(t, "", []*tar.Header{
+				{Name: name, Typeflag: tar.TypeReg},
+			})
+			if !errors.Is(err, ErrUnsafePath) {
+				t.Errorf("Expected ErrUnsafePath, got %v", err)
+			}
+		})
+	}
+}
+
+func TestExtractLinks(t *testing.T) {
+	dest, err := downloadTestTar(t, "", []*tar.Header{
+		{Name: "foo/", Typeflag: tar.TypeDir, Mode: 0o755},
+		{Name: "foo/a.txt", Typeflag: tar.TypeReg},
+		{Name: "foo/inside", Typeflag: tar.TypeSymlink, Linkname: "a.txt"},
+		{Name: "foo/outside", Typeflag: tar.TypeSymlink, Linkname: "../../etc/passwd"},
+		{Name: "foo/absolute", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"},
+		{Name: "foo/hard", Typeflag: tar.TypeLink, Linkname: "foo/a.txt"},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	target, err := os.Readlink(filepath.Join(dest, "foo/inside"))
+	if err != nil {
+		t.Errorf("Expected no error, got %s", err)
+	} else if target != "a.txt" {
+		t.Errorf("Expected symlink to a.txt, got %s", target)
+	}
+
+	for _, name := range []string{"foo/outside", "foo/absolute"} {
+		if _, err := os.Lstat(filepath.Join(dest, name)); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Expected %s to be skipped, got %v", name, err)
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(dest, "foo/hard"))
+	if err != nil {
+		t.Errorf("Expected no error, got %s", err)
+	} else if string(data) != "foo/a.txt" {
+		t.Errorf("Expected hard link to foo/a.txt, got %q", data)
+	}
+
+	for _, name := range []string{"foo", "foo/a.txt"} {
+		fi, err := os.Stat(filepath.Join(dest, name))
+		if err != nil {
+			t.Errorf("Expected no error, got %s", err)
+		} else if !fi.ModTime().Equal(testModTime) {
+			t.Errorf("Expected %s to have mtime %s, got %s", name, testModTime, fi.ModTime())
+		}
+	}
+}
+
+func TestExtractStripSubdir(t *testing.T) {
+	hdrs := func() []*tar.Header {
+		return []*tar.Header{
+			{Name: "foo-1.0/", Typeflag: tar.TypeDir, Mode: 0o755},
+			{Name: "foo-1.0/README", Typeflag: tar.TypeReg},
+			{Name: "foo-1.0/src/", Typeflag: tar.TypeDir, Mode: 0o755},
+			{Name: "foo-1.0/src/main.c", Typeflag: tar.TypeReg},
+		}
+	}
+
+	type testCase struct {
+		query   string
+		present []string
+		absent  []string
+	}
+
+	cases := []testCase{
+		{"?~strip=1", []string{"README", "src/main.c"}, []string{"foo-1.0"}},
+		{"?~subdir=foo-1.0/src", []string{"main.c"}, []string{"README", "foo-1.0", "src"}},
+		{"?~subdir=foo-1.0&~strip=1", []string{"main.c"}, []string{"README", "src"}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.query, func(t *testing.T) {
+			dest, err := downloadTestTar(t, tc.query, hdrs())
+			if err != nil {
+				t.Fatalf("Expected no error, got %s", err)
+			}
+
+			for _, name := range tc.present {
+				if _, err := os.Stat(filepath.Join(dest, name)); err != nil {
+					t.Errorf("Expected %s to exist, got %s", name, err)
+				}
+			}
+			for _, name := range tc.absent {
+				if _, err := os.Stat(filepath.Join(dest, name)); !errors.Is(err, os.ErrNotExist) {
+					t.Errorf("Expected %s not to exist, got %v", name, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+/*
+ * LURE - Linux User REpository
+ * Copyright (C) 2023 Elara Musayelyan
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package dl
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"strings"
+)
+
+// fossilRepoName is the name of the fossil repository file
+// that's stored alongside the checkout in the cache
+const fossilRepoName = ".lure.fossil"
+
+// FossilDownloader downloads Fossil repositories
+type FossilDownloader struct{}
+
+// Name always returns "fossil"
+func (FossilDownloader) Name() string {
+	return "fossil"
+}
+
+// MatchURL matches any URLs that start with "fossil+"
+func (FossilDownloader) MatchURL(u string) bool {
+	return strings.HasPrefix(u, "fossil+")
+}
+
+// Download uses fossil to clone the repository from the specified URL
+// and open a checkout of it. It allows specifying the revision and name
+// via query string.
+func (FossilDownloader) Download(ctx context.Context, opts Options) (Type, string, error) {
+	u, params, err := parseVCSURL(opts.URL, "fossil+")
+	if err != nil {
+		return 0, "", err
+	}
+
+	if params.depth != "" {
+		return 0, "", fmt.Errorf("dl: fossil sources don't support the ~depth parameter")
+	}
+
+	err = runVCS(ctx, opts, opts.Destination, "fossil", "clone", u.String(), fossilRepoName)
+	if err != nil {
+		return 0, "", err
+	}
+
+	// The directory already contains the repository file,
+	// so --force is required to open a checkout in it.
+	args := []string{"open", "--force", fossilRepoName}
+	if params.rev != "" {
+		args = append(args, params.rev)
+	}
+
+	err = runVCS(ctx, opts, opts.Destination, "fossil", args...)
+	if err != nil {
+		return 0, "", err
+	}
+
+	name := params.name
+	if name == "" {
+		name = defaultVCSName(u, ".fossil")
+	}
+
+	return TypeDir, name, nil
+}
+
+// Update uses fossil to pull the repository and update the checkout
+// to the revision in the query string, or the latest revision if there
+// isn't one. It returns true if the checkout changed.
+func (FossilDownloader) Update(ctx context.Context, opts Options) (bool, error) {
+	_, params, err := parseVCSURL(opts.URL, "fossil+")
+	if err != nil {
+		return false, err
+	}
+
+	old, err := fossilCheckout(ctx, opts.Destination)
+	if err != nil {
+		return false, err
+	}
+
+	err = runVCS(ctx, opts, opts.Destination, "fossil", "pull")
+	if err != nil {
+		return false, err
+	}
+
+	args := []string{"update"}
+	if params.rev != "" {
+		args = append(args, params.rev)
+	}
+
+	err = runVCS(ctx, opts, opts.Destination, "fossil", args...)
+	if err != nil {
+		return false, err
+	}
+
+	new, err := fossilCheckout(ctx, opts.Destination)
+	if err != nil {
+		return false, err
+	}
+
+	return old != new, nil
+}
+
+// fossilCheckout returns the hash of the check-in that's
+// currently checked out in dir
+func fossilCheckout(ctx context.Context, dir string) (string, error) {
+	out, err := outputVCS(ctx, dir, "fossil", "info")
+	if err != nil {
+		return "", err
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		key, val, ok := strings.Cut(scanner.Text(), ":")
+		if ok && key == "checkout" {
+			hash, _, _ := strings.Cut(strings.TrimSpace(val), " ")
+			return hash, nil
+		}
+	}
+
+	return "", scanner.Err()
+}
@@ -19,6 +19,7 @@
 package dl
 
 import (
+	"context"
 	"errors"
 	"net/url"
 	"path"
@@ -46,7 +47,7 @@ func (GitDownloader) MatchURL(u string) bool {
 // Download uses git to clone the repository from the specified URL.
 // It allows specifying the revision, depth and recursion options
 // via query string
-func (GitDownloader) Download(opts Options) (Type, string, error) {
+func (GitDownloader) Download(ctx context.Context, opts Options) (Type, string, error) {
 	u, err := url.Parse(opts.URL)
 	if err != nil {
 		return 0, "", err
@@ -77,8 +78,14 @@ func (GitDownloader) Download(opts Options) (Type, string, error) {
 		}
 	}
 
+	auth, err := gitAuth(ctx, u)
+	if err != nil {
+		return 0, "", err
+	}
+
 	co := &git.CloneOptions{
-		URL:               u.String(),
+		URL:               gitRemoteURL(u),
+		Auth:              auth,
 		Depth:             depth,
 		Progress:          opts.Progress,
 		RecurseSubmodules: git.NoRecurseSubmodules,
@@ -88,13 +95,14 @@ func (GitDownloader) Download(opts Options) (Type, string, error) {
 		co.RecurseSubmodules = git.DefaultSubmoduleRecursionDepth
 	}
 
-	r, err := git.PlainClone(opts.Destination, false, co)
+	r, err := git.PlainCloneContext(ctx, opts.Destination, false, co)
 	if err != nil {
 		return 0, "", err
 	}
 
-	err = r.Fetch(&git.FetchOptions{
+	err = r.FetchContext(ctx, &git.FetchOptions{
 		RefSpecs: []config.RefSpec{"+refs/*:refs/*"},
+		Auth:     auth,
 	})
 	if err != git.NoErrAlreadyUpToDate && err != nil {
 		return 0, "", err
@@ -131,7 +139,7 @@ func (GitDownloader) Download(opts Options) (Type, string, error) {
 // and recursion options via query string. It returns
 // true if update was successful and false if the
 // repository is already up-to-date
-func (GitDownloader) Update(opts Options) (bool, error) {
+func (GitDownloader) Update(ctx context.Context, opts Options) (bool, error) {
 	u, err := url.Parse(opts.URL)
 	if err != nil {
 		return false, err
@@ -167,7 +175,13 @@ func (GitDownloader) Update(opts Options) (bool, error) {
 		}
 	}
 
+	auth, err := gitAuth(ctx, u)
+	if err != nil {
+		return false, err
+	}
+
 	po := &git.PullOptions{
+		Auth:              auth,
 		Depth:             depth,
 		Progress:          opts.Progress,
 		RecurseSubmodules: git.NoRecurseSubmodules,
@@ -180,7 +194,7 @@ func (GitDownloader) Update(opts Options) (bool, error) {
 	m, err := getManifest(opts.Destination)
 	manifestOK := err == nil
 
-	err = w.Pull(po)
+	err = w.PullContext(ctx, po)
 	if errors.Is(err, git.NoErrAlreadyUpToDate) {
 		return false, nil
 	} else if err != nil {
@@ -196,3 +210,16 @@ func (GitDownloader) Update(opts Options) (bool, error) {
 
 	return true, nil
 }
+
+// gitRemoteURL returns the URL that should be passed to go-git.
+// HTTP credentials are removed from it because they're sent
+// using the auth method instead, and go-git would otherwise
+// store them in the repo's config.
+func gitRemoteURL(u *url.URL) string {
+	if u.Scheme == "ssh" {
+		return u.String()
+	}
+	out := *u
+	out.User = nil
+	return out.String()
+}
@@ -0,0 +1,106 @@
+/*
+ * LURE - Linux User REpository
+ * Copyright (C) 2023 Elara Musayelyan
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package dl
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// HgDownloader downloads Mercurial repositories
+type HgDownloader struct{}
+
+// Name always returns "hg"
+func (HgDownloader) Name() string {
+	return "hg"
+}
+
+// MatchURL matches any URLs that start with "hg+"
+func (HgDownloader) MatchURL(u string) bool {
+	return strings.HasPrefix(u, "hg+")
+}
+
+// Download uses hg to clone the repository from the specified URL.
+// It allows specifying the revision and name via query string.
+func (HgDownloader) Download(ctx context.Context, opts Options) (Type, string, error) {
+	u, params, err := parseVCSURL(opts.URL, "hg+")
+	if err != nil {
+		return 0, "", err
+	}
+
+	if params.depth != "" {
+		return 0, "", fmt.Errorf("dl: hg sources don't support the ~depth parameter")
+	}
+
+	args := []string{"clone", "--noninteractive"}
+	if params.rev != "" {
+		args = append(args, "--updaterev", params.rev)
+	}
+	args = append(args, u.String(), ".")
+
+	err = runVCS(ctx, opts, opts.Destination, "hg", args...)
+	if err != nil {
+		return 0, "", err
+	}
+
+	name := params.name
+	if name == "" {
+		name = defaultVCSName(u, "")
+	}
+
+	return TypeDir, name, nil
+}
+
+// Update uses hg to pull the repository and update it to the
+// revision in the query string, or the latest revision if there
+// isn't one. It returns true if the working directory changed.
+func (HgDownloader) Update(ctx context.Context, opts Options) (bool, error) {
+	_, params, err := parseVCSURL(opts.URL, "hg+")
+	if err != nil {
+		return false, err
+	}
+
+	old, err := outputVCS(ctx, opts.Destination, "hg", "identify", "--id")
+	if err != nil {
+		return false, err
+	}
+
+	err = runVCS(ctx, opts, opts.Destination, "hg", "pull", "--noninteractive")
+	if err != nil {
+		return false, err
+	}
+
+	args := []string{"update", "--noninteractive"}
+	if params.rev != "" {
+		args = append(args, "--rev", params.rev)
+	}
+
+	err = runVCS(ctx, opts, opts.Destination, "hg", args...)
+	if err != nil {
+		return false, err
+	}
+
+	new, err := outputVCS(ctx, opts.Destination, "hg", "identify", "--id")
+	if err != nil {
+		return false, err
+	}
+
+	return old != new, nil
+}
@@ -0,0 +1,117 @@
+/*
+ * LURE - Linux User REpository
+ * Copyright (C) 2023 Elara Musayelyan
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package dl
+
+import (
+	"context"
+	"net/url"
+	"strings"
+)
+
+// SvnDownloader downloads Subversion repositories
+type SvnDownloader struct{}
+
+// Name always returns "svn"
+func (SvnDownloader) Name() string {
+	return "svn"
+}
+
+// MatchURL matches any URLs that start with "svn+",
+// as well as URLs using the native svn:// protocol
+func (SvnDownloader) MatchURL(u string) bool {
+	return strings.HasPrefix(u, "svn+") || strings.HasPrefix(u, "svn://")
+}
+
+// Download uses svn to check out the repository from the specified URL.
+// It allows specifying the revision, depth and name via query string.
+// The depth must be one of the values accepted by svn's --depth flag.
+func (SvnDownloader) Download(ctx context.Context, opts Options) (Type, string, error) {
+	u, params, err := parseSvnURL(opts.URL)
+	if err != nil {
+		return 0, "", err
+	}
+
+	args := []string{"checkout", "--non-interactive"}
+	if params.rev != "" {
+		args = append(args, "--revision", params.rev)
+	}
+	if params.depth != "" {
+		args = append(args, "--depth", params.depth)
+	}
+	args = append(args, u.String(), ".")
+
+	err = runVCS(ctx, opts, opts.Destination, "svn", args...)
+	if err != nil {
+		return 0, "", err
+	}
+
+	name := params.name
+	if name == "" {
+		name = defaultVCSName(u, "")
+	}
+
+	return TypeDir, name, nil
+}
+
+// Update uses svn to update the working copy to the revision in
+// the query string, or the latest revision if there isn't one.
+// It returns true if the working copy changed.
+func (SvnDownloader) Update(ctx context.Context, opts Options) (bool, error) {
+	_, params, err := parseSvnURL(opts.URL)
+	if err != nil {
+		return false, err
+	}
+
+	old, err := outputVCS(ctx, opts.Destination, "svn", "info", "--show-item", "revision")
+	if err != nil {
+		return false, err
+	}
+
+	args := []string{"update", "--non-interactive"}
+	if params.rev != "" {
+		args = append(args, "--revision", params.rev)
+	}
+
+	err = runVCS(ctx, opts, opts.Destination, "svn", args...)
+	if err != nil {
+		return false, err
+	}
+
+	new, err := outputVCS(ctx, opts.Destination, "svn", "info", "--show-item", "revision")
+	if err != nil {
+		return false, err
+	}
+
+	return old != new, nil
+}
+
+// parseSvnURL parses an svn source URL. The svn+ssh scheme is
+// kept as-is because it's the scheme svn itself uses for SSH.
+func parseSvnURL(rawURL string) (*url.URL, vcsParams, error) {
+	u, params, err := parseVCSURL(rawURL, "svn+")
+	if err != nil {
+		return nil, vcsParams{}, err
+	}
+
+	if u.Scheme == "ssh" {
+		u.Scheme = "svn+ssh"
+	}
+
+	return u, params, nil
+}
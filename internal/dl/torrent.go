@@ -1,24 +1,48 @@
 package dl
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
+
+	"github.com/anacrolix/log"
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/storage"
+	"github.com/schollz/progressbar/v3"
 )
 
 var (
 	urlMatchRegex       = regexp.MustCompile(`(magnet|torrent\+https?):.*`)
-	ErrAria2NotFound    = errors.New("aria2 must be installed for torrent functionality")
 	ErrDestinationEmpty = errors.New("the destination directory is empty")
 )
 
+// newTorrentConfig returns the configuration for a BitTorrent client
+// that stores downloaded files in dest. It's a variable so that
+// tests can disable features that require internet access.
+var newTorrentConfig = func(dest string) *torrent.ClientConfig {
+	cfg := torrent.NewDefaultClientConfig()
+	cfg.DefaultStorage = storage.NewFileOpts(storage.NewFileClientOpts{
+		ClientBaseDir: dest,
+	})
+	// Use a random port so that multiple downloads can run at once
+	cfg.ListenPort = 0
+	cfg.Seed = false
+	cfg.Logger = log.Default.WithFilterLevel(log.Disabled)
+	return cfg
+}
+
 type TorrentDownloader struct{}
 
-// Name always returns "file"
+// Name always returns "torrent"
 func (TorrentDownloader) Name() string {
 	return "torrent"
 }
@@ -29,43 +53,129 @@ func (TorrentDownloader) MatchURL(u string) bool {
 	return urlMatchRegex.MatchString(u)
 }
 
-// Download downloads a file over the BitTorrent protocol.
-func (TorrentDownloader) Download(opts Options) (Type, string, error) {
-	aria2Path, err := exec.LookPath("aria2c")
+// Download downloads a file over the BitTorrent protocol. If the torrent
+// contains a single file and a checksum was provided, the file is checked
+// against it once the download completes.
+func (TorrentDownloader) Download(ctx context.Context, opts Options) (Type, string, error) {
+	client, err := torrent.NewClient(newTorrentConfig(opts.Destination))
 	if err != nil {
-		return 0, "", ErrAria2NotFound
+		return 0, "", err
 	}
+	defer client.Close()
 
-	opts.URL = strings.TrimPrefix(opts.URL, "torrent+")
-
-	cmd := exec.Command(aria2Path, "--summary-interval=0", "--log-level=warn", "--seed-time=0", "--dir="+opts.Destination, opts.URL)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	err = cmd.Run()
+	t, err := addTorrent(ctx, client, strings.TrimPrefix(opts.URL, "torrent+"))
 	if err != nil {
-		return 0, "", fmt.Errorf("aria2c returned an error: %w", err)
+		return 0, "", err
 	}
 
-	err = removeTorrentFiles(opts.Destination)
+	select {
+	case <-t.GotInfo():
+	case <-ctx.Done():
+		return 0, "", ctx.Err()
+	}
+
+	t.DownloadAll()
+	err = waitForTorrent(ctx, t, opts.Progress)
 	if err != nil {
 		return 0, "", err
 	}
 
+	info := t.Info()
+
+	// Close the client so that all the downloaded
+	// files are flushed and closed before using them
+	client.Close()
+
+	if opts.Hash != nil && !info.IsDir() {
+		err = checkFileHash(filepath.Join(opts.Destination, info.BestName()), opts)
+		if err != nil {
+			return 0, "", err
+		}
+	}
+
 	return determineType(opts.Destination)
 }
 
-func removeTorrentFiles(path string) error {
-	filePaths, err := filepath.Glob(filepath.Join(path, "*.torrent"))
+// addTorrent adds the torrent at the given magnet link or
+// http(s) URL to the client.
+func addTorrent(ctx context.Context, client *torrent.Client, u string) (*torrent.Torrent, error) {
+	if strings.HasPrefix(u, "magnet:") {
+		return client.AddMagnet(u)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	for _, filePath := range filePaths {
-		err = os.Remove(filePath)
-		if err != nil {
-			return err
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("dl: unexpected status while fetching torrent file: %s", res.Status)
+	}
+
+	mi, err := metainfo.Load(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.AddTorrent(mi)
+}
+
+// waitForTorrent waits until the torrent has been fully downloaded or the
+// context is canceled, writing a progress bar to progress if it's not nil.
+func waitForTorrent(ctx context.Context, t *torrent.Torrent, progress io.Writer) error {
+	var bar *progressbar.ProgressBar
+	if progress != nil {
+		bar = newProgressBar(progress, t.Length(), t.Name())
+		defer bar.Close()
+	}
+
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.Complete().On():
+			if bar != nil {
+				_ = bar.Set64(t.Length())
+			}
+			return nil
+		case <-ticker.C:
+			if bar != nil {
+				_ = bar.Set64(t.BytesCompleted())
+			}
+		case <-ctx.Done():
+			return ctx.Err()
 		}
 	}
+}
+
+// checkFileHash checks the file at path against the hash in opts
+func checkFileHash(path string, opts Options) error {
+	fl, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fl.Close()
+
+	h, err := opts.NewHash()
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(h, fl)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(h.Sum(nil), opts.Hash) {
+		return ErrChecksumMismatch
+	}
 
 	return nil
 }
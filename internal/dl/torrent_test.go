@@ -0,0 +1,118 @@
+/*
+ * LURE - Linux User REpository
+ * Copyright (C) 2023 Elara Musayelyan
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package dl
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/anacrolix/log"
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/storage"
+)
+
+// localTorrentConfig returns a client config that only
+// talks to peers on the local machine
+func localTorrentConfig(dir string) *torrent.ClientConfig {
+	cfg := torrent.NewDefaultClientConfig()
+	cfg.DefaultStorage = storage.NewFileOpts(storage.NewFileClientOpts{ClientBaseDir: dir})
+	cfg.ListenHost = torrent.LoopbackListenHost
+	cfg.ListenPort = 0
+	cfg.NoDHT = true
+	cfg.DisableTrackers = true
+	cfg.Logger = log.Default.WithFilterLevel(log.Disabled)
+	return cfg
+}
+
+func TestTorrentDownload(t *testing.T) {
+	content := bytes.Repeat([]byte("LURE torrent test\n"), 100000)
+
+	seedDir := t.TempDir()
+	err := os.WriteFile(filepath.Join(seedDir, "test.txt"), content, 0o644)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	info := metainfo.Info{PieceLength: 256 * 1024}
+	err = info.BuildFromFilePath(filepath.Join(seedDir, "test.txt"))
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	mi := metainfo.MetaInfo{}
+	mi.InfoBytes, err = bencode.Marshal(info)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	seedCfg := localTorrentConfig(seedDir)
+	seedCfg.Seed = true
+	seeder, err := torrent.NewClient(seedCfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	defer seeder.Close()
+
+	seedTorrent, err := seeder.AddTorrent(&mi)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	err = seedTorrent.VerifyData()
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	oldConfig := newTorrentConfig
+	newTorrentConfig = localTorrentConfig
+	defer func() { newTorrentConfig = oldConfig }()
+
+	magnet := fmt.Sprintf("%s&x.pe=%s", mi.Magnet(nil, &info), seeder.ListenAddrs()[0])
+	sum := sha256.Sum256(content)
+
+	dest := t.TempDir()
+	typ, name, err := TorrentDownloader{}.Download(context.Background(), Options{
+		URL:         magnet,
+		Destination: dest,
+		Hash:        sum[:],
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	if typ != TypeFile || name != "test.txt" {
+		t.Errorf("Expected file test.txt, got %s %s", typ, name)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dest, name))
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	if !bytes.Equal(data, content) {
+		t.Errorf("Downloaded data does not match seeded data")
+	}
+}
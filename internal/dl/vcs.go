@@ -0,0 +1,134 @@
+/*
+ * LURE - Linux User REpository
+ * Copyright (C) 2023 Elara Musayelyan
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package dl
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os/exec"
+	"path"
+	"strings"
+)
+
+// ErrVCSNotFound occurs when the binary for a version
+// control system that's required for a source isn't installed.
+var ErrVCSNotFound = errors.New("dl: version control system is not installed")
+
+// vcsParams contains the LURE query parameters
+// that are common to the VCS downloaders
+type vcsParams struct {
+	rev   string
+	name  string
+	depth string
+}
+
+// parseVCSURL parses a VCS source URL, removing the given prefix
+// from its scheme and extracting the LURE query parameters.
+func parseVCSURL(rawURL, prefix string) (*url.URL, vcsParams, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, vcsParams{}, err
+	}
+	u.Scheme = strings.TrimPrefix(u.Scheme, prefix)
+
+	query := u.Query()
+
+	params := vcsParams{
+		rev:   query.Get("~rev"),
+		name:  query.Get("~name"),
+		depth: query.Get("~depth"),
+	}
+	query.Del("~rev")
+	query.Del("~name")
+	query.Del("~depth")
+
+	u.RawQuery = query.Encode()
+	return u, params, nil
+}
+
+// defaultVCSName returns the name to use for a VCS source
+// if the ~name parameter isn't provided
+func defaultVCSName(u *url.URL, ext string) string {
+	return strings.TrimSuffix(path.Base(u.Path), ext)
+}
+
+// runVCS runs a version control command in dir. Its output is written
+// to the progress writer in opts, if there is one, and included in
+// the returned error if the command fails.
+func runVCS(ctx context.Context, opts Options, dir, name string, args ...string) error {
+	cmd, err := vcsCommand(ctx, dir, name, args...)
+	if err != nil {
+		return err
+	}
+
+	stderr := &bytes.Buffer{}
+	if opts.Progress != nil {
+		cmd.Stdout = opts.Progress
+		cmd.Stderr = io.MultiWriter(opts.Progress, stderr)
+	} else {
+		cmd.Stderr = stderr
+	}
+
+	err = cmd.Run()
+	if err != nil {
+		return vcsError(name, args, err, stderr)
+	}
+	return nil
+}
+
+// outputVCS runs a version control command in dir and returns its output
+func outputVCS(ctx context.Context, dir, name string, args ...string) (string, error) {
+	cmd, err := vcsCommand(ctx, dir, name, args...)
+	if err != nil {
+		return "", err
+	}
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	err = cmd.Run()
+	if err != nil {
+		return "", vcsError(name, args, err, stderr)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+func vcsCommand(ctx context.Context, dir, name string, args ...string) (*exec.Cmd, error) {
+	binPath, err := exec.LookPath(name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrVCSNotFound, name)
+	}
+
+	cmd := exec.CommandContext(ctx, binPath, args...)
+	cmd.Dir = dir
+	return cmd, nil
+}
+
+func vcsError(name string, args []string, err error, stderr *bytes.Buffer) error {
+	msg := strings.TrimSpace(stderr.String())
+	if msg == "" {
+		return fmt.Errorf("%s %s: %w", name, args[0], err)
+	}
+	return fmt.Errorf("%s %s: %w: %s", name, args[0], err, msg)
+}
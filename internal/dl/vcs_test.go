@@ -0,0 +1,259 @@
+/*
+ * LURE - Linux User REpository
+ * Copyright (C) 2023 Elara Musayelyan
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package dl
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// requireVCS skips the test if any of the given commands aren't installed
+func requireVCS(t *testing.T, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		if _, err := exec.LookPath(name); err != nil {
+			t.Skipf("%s is not installed", name)
+		}
+	}
+}
+
+// runCmd runs a command in dir and returns its trimmed output
+func runCmd(t *testing.T, dir, name string, args ...string) string {
+	t.Helper()
+
+	cmd := exec.Command(name, args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("%s %s: %s: %s", name, strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+
+	err := os.WriteFile(path, []byte(content), 0o644)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+}
+
+func expectFileContent(t *testing.T, path, expected string) {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	if string(data) != expected {
+		t.Errorf("Expected %q in %s, got %q", expected, path, data)
+	}
+}
+
+// testVCSDownloader checks the first download of a repo at its first
+// revision, then an update to the latest revision, then an update that
+// doesn't change anything.
+func testVCSDownloader(t *testing.T, d UpdatingDownloader, url, firstRev, expectedName, checkout string) {
+	t.Helper()
+	ctx := context.Background()
+
+	dest := filepath.Join(t.TempDir(), "cache")
+	err := os.Mkdir(dest, 0o755)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	typ, name, err := d.Download(ctx, Options{
+		URL:         url + "?~rev=" + firstRev,
+		Destination: dest,
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	if typ != TypeDir {
+		t.Errorf("Expected %s, got %s", TypeDir, typ)
+	}
+
+	if name != expectedName {
+		t.Errorf("Expected name %q, got %q", expectedName, name)
+	}
+
+	expectFileContent(t, filepath.Join(dest, "a.txt"), "1")
+
+	// Without a revision, the update should move to the latest one
+	updated, err := d.Update(ctx, Options{URL: url, Destination: dest})
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	if !updated {
+		t.Error("Expected the first update to change the checkout")
+	}
+
+	expectFileContent(t, filepath.Join(dest, "a.txt"), "2")
+
+	updated, err = d.Update(ctx, Options{URL: url, Destination: dest})
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	if updated {
+		t.Error("Expected the second update not to change the checkout")
+	}
+
+	// Updating with a revision should go back to it
+	updated, err = d.Update(ctx, Options{URL: url + "?~rev=" + firstRev, Destination: dest})
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	if !updated {
+		t.Error("Expected the update to the first revision to change the checkout")
+	}
+
+	expectFileContent(t, filepath.Join(dest, "a.txt"), "1")
+
+	if checkout != "" {
+		_, err = os.Stat(filepath.Join(dest, checkout))
+		if err != nil {
+			t.Errorf("Expected %s to exist in the cache, got %s", checkout, err)
+		}
+	}
+}
+
+func TestHgDownloader(t *testing.T) {
+	requireVCS(t, "hg")
+
+	repo := filepath.Join(t.TempDir(), "hgrepo")
+	runCmd(t, "", "hg", "init", repo)
+
+	writeTestFile(t, filepath.Join(repo, "a.txt"), "1")
+	runCmd(t, repo, "hg", "commit", "--addremove", "-u", "test", "-m", "1")
+	firstRev := runCmd(t, repo, "hg", "identify", "--id")
+
+	writeTestFile(t, filepath.Join(repo, "a.txt"), "2")
+	runCmd(t, repo, "hg", "commit", "-u", "test", "-m", "2")
+
+	testVCSDownloader(t, HgDownloader{}, "hg+file://"+repo, firstRev, "hgrepo", ".hg")
+
+	_, _, err := HgDownloader{}.Download(context.Background(), Options{
+		URL:         "hg+file://" + repo + "?~depth=1",
+		Destination: t.TempDir(),
+	})
+	if err == nil {
+		t.Error("Expected an error for the ~depth parameter")
+	}
+}
+
+func TestSvnDownloader(t *testing.T) {
+	requireVCS(t, "svn", "svnadmin")
+
+	repo := filepath.Join(t.TempDir(), "svnrepo")
+	runCmd(t, "", "svnadmin", "create", repo)
+
+	wc := t.TempDir()
+	runCmd(t, wc, "svn", "checkout", "file://"+repo, ".")
+
+	writeTestFile(t, filepath.Join(wc, "a.txt"), "1")
+	runCmd(t, wc, "svn", "add", "a.txt")
+	runCmd(t, wc, "svn", "commit", "-m", "1")
+
+	writeTestFile(t, filepath.Join(wc, "a.txt"), "2")
+	runCmd(t, wc, "svn", "commit", "-m", "2")
+
+	testVCSDownloader(t, SvnDownloader{}, "svn+file://"+repo, "1", "svnrepo", ".svn")
+}
+
+func TestFossilDownloader(t *testing.T) {
+	requireVCS(t, "fossil")
+
+	// Fossil keeps global settings in the home directory
+	t.Setenv("HOME", t.TempDir())
+
+	repo := filepath.Join(t.TempDir(), "fslrepo.fossil")
+	runCmd(t, "", "fossil", "init", "--admin-user", "test", repo)
+
+	wc := t.TempDir()
+	runCmd(t, wc, "fossil", "open", repo)
+
+	writeTestFile(t, filepath.Join(wc, "a.txt"), "1")
+	runCmd(t, wc, "fossil", "add", "a.txt")
+	runCmd(t, wc, "fossil", "commit", "--no-warnings", "-m", "1")
+	firstRev := fossilTestCheckout(t, wc)
+
+	writeTestFile(t, filepath.Join(wc, "a.txt"), "2")
+	runCmd(t, wc, "fossil", "commit", "--no-warnings", "-m", "2")
+
+	testVCSDownloader(t, FossilDownloader{}, "fossil+file://"+repo, firstRev, "fslrepo", fossilRepoName)
+}
+
+// fossilTestCheckout returns the hash of the check-in that's checked out in dir
+func fossilTestCheckout(t *testing.T, dir string) string {
+	t.Helper()
+
+	scanner := bufio.NewScanner(strings.NewReader(runCmd(t, dir, "fossil", "info")))
+	for scanner.Scan() {
+		key, val, ok := strings.Cut(scanner.Text(), ":")
+		if ok && key == "checkout" {
+			hash, _, _ := strings.Cut(strings.TrimSpace(val), " ")
+			return hash
+		}
+	}
+
+	t.Fatal("Expected fossil info to contain the checkout")
+	return ""
+}
+
+func TestLinkDirSkipsCacheOnlyFiles(t *testing.T) {
+	cacheDir := t.TempDir()
+	for _, name := range []string{manifestFileName, fossilRepoName, ".fslckout", "a.txt"} {
+		writeTestFile(t, filepath.Join(cacheDir, name), name)
+	}
+
+	// Only the files at the top of the cache entry are special,
+	// so files with the same names in the sources are kept
+	err := os.Mkdir(filepath.Join(cacheDir, "sub"), 0o755)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	writeTestFile(t, filepath.Join(cacheDir, "sub", ".fslckout"), "sub")
+
+	dest := filepath.Join(t.TempDir(), "src")
+	err = linkDir(cacheDir, dest)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	for _, name := range []string{manifestFileName, fossilRepoName, ".fslckout"} {
+		if _, err := os.Stat(filepath.Join(dest, name)); err == nil {
+			t.Errorf("Expected %s not to be linked into the destination", name)
+		}
+	}
+
+	expectFileContent(t, filepath.Join(dest, "a.txt"), "a.txt")
+	expectFileContent(t, filepath.Join(dest, "sub", ".fslckout"), "sub")
+}
@@ -22,11 +22,14 @@ import (
 	"context"
 	"crypto/sha1"
 	"encoding/hex"
+	"errors"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 
 	"github.com/sintan1729/lure/internal/config"
+	"github.com/sintan1729/lure/internal/flock"
 )
 
 // BasePath returns the base path of the download cache
@@ -37,6 +40,7 @@ func BasePath(ctx context.Context) string {
 // New creates a new directory with the given ID in the cache.
 // If a directory with the same ID already exists,
 // it will be deleted before creating a new one.
+// The caller should hold the entry's lock (see Lock).
 func New(ctx context.Context, id string) (string, error) {
 	h, err := hashID(id)
 	if err != nil {
@@ -80,6 +84,84 @@ func Get(ctx context.Context, id string) (string, bool) {
 	return itemPath, true
 }
 
+// Remove deletes the entry with the given ID from the cache,
+// if it exists.
+func Remove(ctx context.Context, id string) error {
+	h, err := hashID(id)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(filepath.Join(BasePath(ctx), h))
+}
+
+// Lock takes an exclusive lock on the entry with the given ID,
+// waiting for any other process holding it to release it.
+// The entry doesn't need to exist yet.
+func Lock(ctx context.Context, id string) (*flock.Lock, error) {
+	h, err := hashID(id)
+	if err != nil {
+		return nil, err
+	}
+	return flock.Acquire(ctx, lockPath(filepath.Join(BasePath(ctx), h)))
+}
+
+// TryLockEntry attempts to take an exclusive lock on the cache entry
+// at the given path without waiting. It returns flock.ErrLocked
+// if the entry is in use by another process.
+func TryLockEntry(itemPath string) (*flock.Lock, error) {
+	return flock.TryLock(lockPath(itemPath))
+}
+
+// Entries returns the paths of all the entries
+// currently in the cache.
+func Entries(ctx context.Context) ([]string, error) {
+	base := BasePath(ctx)
+	dirEntries, err := os.ReadDir(base)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	out := make([]string, 0, len(dirEntries))
+	for _, de := range dirEntries {
+		if !de.IsDir() {
+			continue
+		}
+		out = append(out, filepath.Join(base, de.Name()))
+	}
+	return out, nil
+}
+
+// Size returns the total size of all the files
+// inside the given cache entry.
+func Size(itemPath string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(itemPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.Type().IsRegular() {
+			fi, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += fi.Size()
+		}
+
+		return nil
+	})
+	return size, err
+}
+
+// lockPath returns the path of the lock file for a cache entry.
+// Lock files are kept next to the entries rather than inside them,
+// so that they survive the entry being deleted and recreated.
+func lockPath(itemPath string) string {
+	return itemPath + ".lock"
+}
+
 // hashID hashes the input ID with SHA1
 // and returns the hex string of the hashed
 // ID.
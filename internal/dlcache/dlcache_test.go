@@ -25,6 +25,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"slices"
 	"testing"
 
 	"github.com/sintan1729/lure/internal/config"
@@ -71,6 +72,35 @@ func TestNew(t *testing.T) {
 	}
 }
 
+func TestRemove(t *testing.T) {
+	const id = "https://example.com/remove"
+	ctx := context.Background()
+
+	dir, err := dlcache.New(ctx, id)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	entries, err := dlcache.Entries(ctx)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	if !slices.Contains(entries, dir) {
+		t.Errorf("Expected %s to be in %v", dir, entries)
+	}
+
+	err = dlcache.Remove(ctx, id)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	_, ok := dlcache.Get(ctx, id)
+	if ok {
+		t.Errorf("Expected Get() to fail after Remove()")
+	}
+}
+
 func sha1sum(id string) string {
 	h := sha1.New()
 	_, _ = io.WriteString(h, id)
@@ -0,0 +1,475 @@
+/*
+ * LURE - Linux User REpository
+ * Copyright (C) 2023 Elara Musayelyan
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+// Package doctor checks the system and LURE's files for problems,
+// and suggests how each of them can be fixed.
+package doctor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+
+	"github.com/sintan1729/lure/internal/config"
+	"github.com/sintan1729/lure/internal/db"
+	"github.com/sintan1729/lure/internal/dl"
+	"github.com/sintan1729/lure/internal/installed"
+	"github.com/sintan1729/lure/internal/pkgdep"
+	"github.com/sintan1729/lure/pkg/manager"
+	"lure.sh/fakeroot"
+)
+
+// Severities of findings
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Finding is a problem found by Run
+type Finding struct {
+	Check    string `json:"check"`
+	Severity string `json:"severity"`
+	Problem  string `json:"problem"`
+	// Fix is a suggestion for how to fix the problem
+	Fix string `json:"fix"`
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s: %s (%s)\n    fix: %s", f.Severity, f.Problem, f.Check, f.Fix)
+}
+
+// vcsSources matches the sources that are downloaded using
+// an external program, mapped by the name of the program
+var vcsSources = map[string]*regexp.Regexp{
+	"hg":     regexp.MustCompile(`["'(\s]hg\+`),
+	"svn":    regexp.MustCompile(`["'(\s]svn(\+|://)`),
+	"fossil": regexp.MustCompile(`["'(\s]fossil\+`),
+}
+
+// doctor contains the state for a single run of the checks
+type doctor struct {
+	mgr      manager.Manager
+	findings []Finding
+	// pkgs contains the packages in the database, mapped by name.
+	// It's nil if the database can't be used.
+	pkgs map[string][]db.Package
+}
+
+// Run checks for problems with LURE. mgr is the system's package manager,
+// or nil if none was detected. An error is only returned if the checks
+// couldn't be performed at all.
+func Run(ctx context.Context, mgr manager.Manager) ([]Finding, error) {
+	d := &doctor{mgr: mgr}
+
+	checks := []func(context.Context) error{
+		d.checkManager,
+		d.checkRootCmd,
+		d.checkFakeroot,
+		d.checkVCS,
+		d.checkDatabase,
+		d.checkRepoDirs,
+		d.checkInstalled,
+		d.checkBuildDirs,
+		d.checkCache,
+	}
+
+	for _, check := range checks {
+		err := check(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return d.findings, nil
+}
+
+func (d *doctor) add(check, severity, problem, fix string) {
+	d.findings = append(d.findings, Finding{
+		Check:    check,
+		Severity: severity,
+		Problem:  problem,
+		Fix:      fix,
+	})
+}
+
+// checkManager makes sure there's a supported package manager
+func (d *doctor) checkManager(ctx context.Context) error {
+	if d.mgr == nil {
+		d.add("package-manager", SeverityError,
+			"no supported package manager was found",
+			"LURE supports apt, dnf, yum, pacman, apk and zypper. If one of them is installed, make sure it's in your PATH.",
+		)
+	}
+	return nil
+}
+
+// checkRootCmd makes sure the command used to run
+// the package manager as root exists
+func (d *doctor) checkRootCmd(ctx context.Context) error {
+	rootCmd := config.Config(ctx).RootCmd
+	if _, err := exec.LookPath(rootCmd); err != nil {
+		d.add("root-cmd", SeverityError,
+			fmt.Sprintf("the root command %q was not found", rootCmd),
+			fmt.Sprintf("Install %s, or set rootCmd in %s to a command that exists, such as sudo or doas.", rootCmd, config.GetPaths(ctx).ConfigPath),
+		)
+	}
+	return nil
+}
+
+// checkFakeroot makes sure commands can be run in the
+// fakeroot environment used by the package() function
+func (d *doctor) checkFakeroot(ctx context.Context) error {
+	truePath, err := exec.LookPath("true")
+	if err != nil {
+		return nil
+	}
+
+	cmd, err := fakeroot.Command(truePath)
+	if err == nil {
+		err = cmd.Run()
+	}
+
+	if err != nil {
+		d.add("fakeroot", SeverityError,
+			fmt.Sprintf("commands can't be run in a fakeroot environment: %s", err),
+			"LURE uses user namespaces to build packages. Make sure they're enabled, for example with sysctl -w kernel.unprivileged_userns_clone=1 or by raising user.max_user_namespaces.",
+		)
+	}
+	return nil
+}
+
+// checkVCS makes sure the programs needed to download the
+// version control sources used by build scripts are installed
+func (d *doctor) checkVCS(ctx context.Context) error {
+	repoDir := config.GetPaths(ctx).RepoDir
+
+	counts := map[string]int{}
+	for _, repo := range config.Config(ctx).Repos {
+		scripts, err := filepath.Glob(filepath.Join(repoDir, repo.Name, "*", "lure.sh"))
+		if err != nil {
+			return err
+		}
+
+		for _, script := range scripts {
+			data, err := os.ReadFile(script)
+			if err != nil {
+				return err
+			}
+
+			for name, re := range vcsSources {
+				if re.Match(data) {
+					counts[name]++
+				}
+			}
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(counts)) {
+		if _, err := exec.LookPath(name); err == nil {
+			continue
+		}
+
+		d.add("vcs", SeverityWarning,
+			fmt.Sprintf("%d build script(s) in your repos use %s sources, but %s isn't installed", counts[name], name, name),
+			fmt.Sprintf("Install %s with your package manager before building them.", name),
+		)
+	}
+	return nil
+}
+
+// checkDatabase makes sure the database exists, has the right version,
+// and only contains packages from the repos in the config. If it can be
+// used, the packages in it are loaded for the other checks.
+func (d *doctor) checkDatabase(ctx context.Context) error {
+	dbPath := config.GetPaths(ctx).DBPath
+	if _, err := os.Stat(dbPath); errors.Is(err, fs.ErrNotExist) {
+		d.add("database", SeverityWarning,
+			"the package database doesn't exist",
+			"Run lure refresh to create it.",
+		)
+		return nil
+	}
+
+	ver, ok, err := db.FileVersion(ctx, dbPath)
+	if err != nil {
+		return err
+	}
+
+	// Opening the database with the wrong version would reset it, so the
+	// checks that need it are skipped until it's been repopulated
+	if !ok || ver != db.CurrentVersion {
+		problem := "the package database doesn't have a version"
+		if ok {
+			problem = fmt.Sprintf("the package database has version %d, but this version of LURE uses version %d", ver, db.CurrentVersion)
+		}
+		d.add("database", SeverityWarning, problem,
+			"Run lure refresh to rebuild it. The checks for installed packages and build directories were skipped.",
+		)
+		return nil
+	}
+
+	result, err := db.GetPkgs(ctx, "true")
+	if err != nil {
+		return err
+	}
+	defer result.Close()
+
+	d.pkgs = map[string][]db.Package{}
+	repos := map[string]bool{}
+	for result.Next() {
+		var pkg db.Package
+		err = result.StructScan(&pkg)
+		if err != nil {
+			return err
+		}
+		d.pkgs[pkg.Name] = append(d.pkgs[pkg.Name], pkg)
+		repos[pkg.Repository] = true
+	}
+
+	configured := config.Config(ctx).Repos
+	if len(d.pkgs) == 0 && len(configured) > 0 {
+		d.add("database", SeverityWarning,
+			"the package database is empty",
+			"Run lure refresh to pull your repos.",
+		)
+	}
+
+	for _, repo := range configured {
+		delete(repos, repo.Name)
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(repos)) {
+		d.add("database", SeverityWarning,
+			fmt.Sprintf("the package database contains packages from the repo %q, which isn't in the config", name),
+			"Run lure fix to rebuild the database from the repos in the config.",
+		)
+	}
+
+	return nil
+}
+
+// checkRepoDirs makes sure every directory in the repo
+// directory belongs to a repo in the config
+func (d *doctor) checkRepoDirs(ctx context.Context) error {
+	repoDir := config.GetPaths(ctx).RepoDir
+
+	entries, err := os.ReadDir(repoDir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() || isConfiguredRepo(ctx, entry.Name()) {
+			continue
+		}
+
+		path := filepath.Join(repoDir, entry.Name())
+		d.add("repo-dir", SeverityWarning,
+			fmt.Sprintf("%s contains the repo %q, which isn't in the config", path, entry.Name()),
+			fmt.Sprintf("Remove it with rm -r %s, or add the repo back with lure addrepo.", path),
+		)
+	}
+	return nil
+}
+
+// checkInstalled finds installed packages that LURE built, but that are no
+// longer in any repo, or whose installed versions are newer than the ones
+// in the repos
+func (d *doctor) checkInstalled(ctx context.Context) error {
+	if d.mgr == nil || d.pkgs == nil {
+		return nil
+	}
+
+	installedPkgs, err := d.mgr.ListInstalled(nil)
+	if err != nil {
+		return err
+	}
+
+	built, err := builtPkgs(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range built {
+		version, ok := installedPkgs[name]
+		if !ok {
+			continue
+		}
+
+		candidates := d.pkgs[name]
+		if len(candidates) == 0 {
+			problem := fmt.Sprintf("%s was built by LURE, but it's no longer in any repo", name)
+			if repo, ok := unconfiguredRepo(ctx, name); ok {
+				problem = fmt.Sprintf("%s was built by LURE, but its repo %q is no longer in the config", name, repo)
+			}
+			d.add("orphaned-pkg", SeverityWarning, problem,
+				fmt.Sprintf("Remove it with lure remove %s if you don't need it anymore. Otherwise, it won't get updates.", name),
+			)
+			continue
+		}
+
+		// The epoch is always included, so that it's compared
+		// with the installed version's even if it's zero
+		var newest db.Package
+		newestVersion := ""
+		for _, pkg := range candidates {
+			repoVersion := fmt.Sprintf("%d:%s-%d", pkg.Epoch, pkg.Version, pkg.Release)
+			if newestVersion == "" || pkgdep.CompareVersions(repoVersion, newestVersion) > 0 {
+				newest, newestVersion = pkg, repoVersion
+			}
+		}
+
+		if pkgdep.CompareVersions(version, newestVersion) > 0 {
+			displayVersion := fmt.Sprintf("%s-%d", newest.Version, newest.Release)
+			if newest.Epoch != 0 {
+				displayVersion = newestVersion
+			}
+
+			d.add("newer-than-repo", SeverityWarning,
+				fmt.Sprintf("%s %s is installed, which is newer than the newest version in the repos (%s)", name, version, displayVersion),
+				fmt.Sprintf("It was probably installed manually or from another source. Reinstall it with lure install %s to use the version from the repos.", name),
+			)
+		}
+	}
+
+	return nil
+}
+
+// checkBuildDirs finds build directories of packages
+// that aren't in any repo and aren't installed
+func (d *doctor) checkBuildDirs(ctx context.Context) error {
+	if d.pkgs == nil {
+		return nil
+	}
+
+	var installedPkgs map[string]string
+	if d.mgr != nil {
+		var err error
+		installedPkgs, err = d.mgr.ListInstalled(nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	pkgsDir := config.GetPaths(ctx).PkgsDir
+	entries, err := os.ReadDir(pkgsDir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() || len(d.pkgs[name]) > 0 {
+			continue
+		}
+
+		if _, ok := installedPkgs[name]; ok {
+			continue
+		}
+
+		path := filepath.Join(pkgsDir, name)
+		d.add("build-dir", SeverityWarning,
+			fmt.Sprintf("%s contains the build directory of %s, which isn't in any repo and isn't installed", path, name),
+			fmt.Sprintf("Remove it with rm -r %s.", path),
+		)
+	}
+	return nil
+}
+
+// checkCache finds download cache entries whose
+// manifests are missing or can't be read
+func (d *doctor) checkCache(ctx context.Context) error {
+	entries, err := dl.CacheEntries(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.Valid {
+			continue
+		}
+
+		d.add("cache", SeverityWarning,
+			fmt.Sprintf("the download cache entry %s has a missing or invalid manifest", entry.Path),
+			fmt.Sprintf("Remove it with rm -r %s. It will be downloaded again when it's needed.", entry.Path),
+		)
+	}
+	return nil
+}
+
+// builtPkgs returns the names of the packages LURE has built or installed.
+// These are the packages in the record of installed packages, along with
+// the ones that have a build directory.
+func builtPkgs(ctx context.Context) ([]string, error) {
+	record, err := installed.Packages(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	names := map[string]bool{}
+	for name := range record {
+		names[name] = true
+	}
+
+	entries, err := os.ReadDir(config.GetPaths(ctx).PkgsDir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			names[entry.Name()] = true
+		}
+	}
+
+	return slices.Sorted(maps.Keys(names)), nil
+}
+
+// unconfiguredRepo returns the name of a repo in the repo directory that
+// isn't in the config, but contains a package called name
+func unconfiguredRepo(ctx context.Context, name string) (string, bool) {
+	scripts, err := filepath.Glob(filepath.Join(config.GetPaths(ctx).RepoDir, "*", name, "lure.sh"))
+	if err != nil {
+		return "", false
+	}
+
+	for _, script := range scripts {
+		repo := filepath.Base(filepath.Dir(filepath.Dir(script)))
+		if !isConfiguredRepo(ctx, repo) {
+			return repo, true
+		}
+	}
+	return "", false
+}
+
+// isConfiguredRepo returns true if there's a repo called name in the config
+func isConfiguredRepo(ctx context.Context, name string) bool {
+	for _, repo := range config.Config(ctx).Repos {
+		if repo.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,429 @@
+/*
+ * LURE - Linux User REpository
+ * Copyright (C) 2023 Elara Musayelyan
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package doctor_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/sintan1729/lure/internal/config"
+	"github.com/sintan1729/lure/internal/db"
+	"github.com/sintan1729/lure/internal/dlcache"
+	"github.com/sintan1729/lure/internal/doctor"
+	"github.com/sintan1729/lure/internal/installed"
+	"github.com/sintan1729/lure/internal/types"
+	"github.com/sintan1729/lure/pkg/manager"
+)
+
+// testManager is a package manager with a fixed set of installed packages
+type testManager struct {
+	manager.Manager
+	installed map[string]string
+}
+
+func (m *testManager) ListInstalled(*manager.Opts) (map[string]string, error) {
+	return m.installed, nil
+}
+
+// testEnv contains the state that a test case can change
+// before the checks are run
+type testEnv struct {
+	ctx   context.Context
+	paths *config.Paths
+	mgr   *testManager
+}
+
+func (e *testEnv) mkdir(t *testing.T, path ...string) string {
+	t.Helper()
+	dir := filepath.Join(path...)
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	return dir
+}
+
+func (e *testEnv) writeScript(t *testing.T, repo, pkg, content string) {
+	t.Helper()
+	dir := e.mkdir(t, e.paths.RepoDir, repo, pkg)
+	err := os.WriteFile(filepath.Join(dir, "lure.sh"), []byte(content), 0o644)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+}
+
+func (e *testEnv) insertPkg(t *testing.T, name, repo string) {
+	t.Helper()
+	err := db.InsertPackage(e.ctx, db.Package{
+		Name:       name,
+		Version:    "1.0",
+		Release:    1,
+		Repository: repo,
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+}
+
+func (e *testEnv) install(t *testing.T, name, version string) {
+	t.Helper()
+	e.mgr.installed[name] = version
+	err := installed.Add(e.ctx, installed.Package{Name: name})
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+}
+
+// setupEnv points LURE's paths to new temporary directories and creates
+// a healthy setup, with a database containing a package from the only
+// configured repo. The PATH only contains the root command, so the
+// result doesn't depend on the programs installed on the system.
+func setupEnv(t *testing.T) *testEnv {
+	t.Helper()
+	ctx := context.Background()
+
+	err := db.Close()
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	dir := t.TempDir()
+	paths := config.GetPaths(ctx)
+	*paths = config.Paths{
+		ConfigDir:  filepath.Join(dir, "config"),
+		ConfigPath: filepath.Join(dir, "config", "lure.toml"),
+		CacheDir:   filepath.Join(dir, "cache"),
+		RepoDir:    filepath.Join(dir, "cache", "repo"),
+		PkgsDir:    filepath.Join(dir, "cache", "pkgs"),
+		DBPath:     filepath.Join(dir, "cache", "db"),
+		StateDir:   filepath.Join(dir, "state"),
+	}
+
+	cfg := config.Config(ctx)
+	cfg.RootCmd = "sudo"
+	cfg.Repos = []types.Repo{{Name: "main", URL: "https://example.com/repo.git"}}
+
+	env := &testEnv{ctx: ctx, paths: paths, mgr: &testManager{installed: map[string]string{}}}
+	for _, dir := range []string{paths.ConfigDir, paths.RepoDir, paths.PkgsDir, paths.StateDir} {
+		env.mkdir(t, dir)
+	}
+
+	binDir := env.mkdir(t, dir, "bin")
+	err = os.WriteFile(filepath.Join(binDir, "sudo"), []byte("#!/bin/sh\nexec \"$@\"\n"), 0o755)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	t.Setenv("PATH", binDir)
+
+	_, err = db.Open(ctx, paths.DBPath)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	env.insertPkg(t, "app", "main")
+	return env
+}
+
+func TestRun(t *testing.T) {
+	type testCase struct {
+		name string
+		// setup changes the healthy environment created by setupEnv
+		setup func(t *testing.T, env *testEnv)
+		// noManager runs the checks without a package manager
+		noManager bool
+		expected  func(env *testEnv) []doctor.Finding
+	}
+
+	tests := []testCase{
+		{
+			name:     "healthy",
+			expected: func(*testEnv) []doctor.Finding { return nil },
+		},
+		{
+			name:      "no package manager",
+			noManager: true,
+			expected: func(*testEnv) []doctor.Finding {
+				return []doctor.Finding{{
+					Check:    "package-manager",
+					Severity: doctor.SeverityError,
+					Problem:  "no supported package manager was found",
+					Fix:      "LURE supports apt, dnf, yum, pacman, apk and zypper. If one of them is installed, make sure it's in your PATH.",
+				}}
+			},
+		},
+		{
+			name: "missing root command",
+			setup: func(t *testing.T, env *testEnv) {
+				config.Config(env.ctx).RootCmd = "doas"
+			},
+			expected: func(env *testEnv) []doctor.Finding {
+				return []doctor.Finding{{
+					Check:    "root-cmd",
+					Severity: doctor.SeverityError,
+					Problem:  `the root command "doas" was not found`,
+					Fix:      "Install doas, or set rootCmd in " + env.paths.ConfigPath + " to a command that exists, such as sudo or doas.",
+				}}
+			},
+		},
+		{
+			name: "missing VCS program",
+			setup: func(t *testing.T, env *testEnv) {
+				env.writeScript(t, "main", "app", "sources=('hg+https://example.com/app')\n")
+				env.writeScript(t, "main", "lib", "sources=(\n\t'hg+https://example.com/lib'\n)\n")
+				env.writeScript(t, "main", "tool", "sources=('https://example.com/tool.tar.gz')\n")
+			},
+			expected: func(*testEnv) []doctor.Finding {
+				return []doctor.Finding{{
+					Check:    "vcs",
+					Severity: doctor.SeverityWarning,
+					Problem:  "2 build script(s) in your repos use hg sources, but hg isn't installed",
+					Fix:      "Install hg with your package manager before building them.",
+				}}
+			},
+		},
+		{
+			name: "missing database",
+			setup: func(t *testing.T, env *testEnv) {
+				db.Close()
+				os.Remove(env.paths.DBPath)
+			},
+			expected: func(*testEnv) []doctor.Finding {
+				return []doctor.Finding{{
+					Check:    "database",
+					Severity: doctor.SeverityWarning,
+					Problem:  "the package database doesn't exist",
+					Fix:      "Run lure refresh to create it.",
+				}}
+			},
+		},
+		{
+			name: "database without version",
+			setup: func(t *testing.T, env *testEnv) {
+				_, err := db.DB(env.ctx).Exec("DELETE FROM lure_db_version")
+				if err != nil {
+					t.Fatalf("Expected no error, got %s", err)
+				}
+				db.Close()
+			},
+			expected: func(*testEnv) []doctor.Finding {
+				return []doctor.Finding{{
+					Check:    "database",
+					Severity: doctor.SeverityWarning,
+					Problem:  "the package database doesn't have a version",
+					Fix:      "Run lure refresh to rebuild it. The checks for installed packages and build directories were skipped.",
+				}}
+			},
+		},
+		{
+			name: "old database version",
+			setup: func(t *testing.T, env *testEnv) {
+				db.Close()
+				fileDB, err := sqlx.Open("sqlite", env.paths.DBPath)
+				if err != nil {
+					t.Fatalf("Expected no error, got %s", err)
+				}
+				defer fileDB.Close()
+
+				_, err = fileDB.Exec("UPDATE lure_db_version SET version = ?", db.CurrentVersion-1)
+				if err != nil {
+					t.Fatalf("Expected no error, got %s", err)
+				}
+			},
+			expected: func(*testEnv) []doctor.Finding {
+				return []doctor.Finding{{
+					Check:    "database",
+					Severity: doctor.SeverityWarning,
+					Problem:  fmt.Sprintf("the package database has version %d, but this version of LURE uses version %d", db.CurrentVersion-1, db.CurrentVersion),
+					Fix:      "Run lure refresh to rebuild it. The checks for installed packages and build directories were skipped.",
+				}}
+			},
+		},
+		{
+			name: "empty database",
+			setup: func(t *testing.T, env *testEnv) {
+				err := db.DeletePkgs(env.ctx, "true")
+				if err != nil {
+					t.Fatalf("Expected no error, got %s", err)
+				}
+			},
+			expected: func(*testEnv) []doctor.Finding {
+				return []doctor.Finding{{
+					Check:    "database",
+					Severity: doctor.SeverityWarning,
+					Problem:  "the package database is empty",
+					Fix:      "Run lure refresh to pull your repos.",
+				}}
+			},
+		},
+		{
+			name: "database with removed repo",
+			setup: func(t *testing.T, env *testEnv) {
+				env.insertPkg(t, "other", "old")
+			},
+			expected: func(*testEnv) []doctor.Finding {
+				return []doctor.Finding{{
+					Check:    "database",
+					Severity: doctor.SeverityWarning,
+					Problem:  `the package database contains packages from the repo "old", which isn't in the config`,
+					Fix:      "Run lure fix to rebuild the database from the repos in the config.",
+				}}
+			},
+		},
+		{
+			name: "removed repo directory",
+			setup: func(t *testing.T, env *testEnv) {
+				env.mkdir(t, env.paths.RepoDir, "old")
+			},
+			expected: func(env *testEnv) []doctor.Finding {
+				path := filepath.Join(env.paths.RepoDir, "old")
+				return []doctor.Finding{{
+					Check:    "repo-dir",
+					Severity: doctor.SeverityWarning,
+					Problem:  path + ` contains the repo "old", which isn't in the config`,
+					Fix:      "Remove it with rm -r " + path + ", or add the repo back with lure addrepo.",
+				}}
+			},
+		},
+		{
+			name: "package no longer in any repo",
+			setup: func(t *testing.T, env *testEnv) {
+				env.install(t, "gone", "1.0-1")
+			},
+			expected: func(*testEnv) []doctor.Finding {
+				return []doctor.Finding{{
+					Check:    "orphaned-pkg",
+					Severity: doctor.SeverityWarning,
+					Problem:  "gone was built by LURE, but it's no longer in any repo",
+					Fix:      "Remove it with lure remove gone if you don't need it anymore. Otherwise, it won't get updates.",
+				}}
+			},
+		},
+		{
+			name: "package from removed repo",
+			setup: func(t *testing.T, env *testEnv) {
+				env.install(t, "gone", "1.0-1")
+				env.writeScript(t, "old", "gone", "name=gone\n")
+			},
+			expected: func(env *testEnv) []doctor.Finding {
+				path := filepath.Join(env.paths.RepoDir, "old")
+				return []doctor.Finding{
+					{
+						Check:    "repo-dir",
+						Severity: doctor.SeverityWarning,
+						Problem:  path + ` contains the repo "old", which isn't in the config`,
+						Fix:      "Remove it with rm -r " + path + ", or add the repo back with lure addrepo.",
+					},
+					{
+						Check:    "orphaned-pkg",
+						Severity: doctor.SeverityWarning,
+						Problem:  `gone was built by LURE, but its repo "old" is no longer in the config`,
+						Fix:      "Remove it with lure remove gone if you don't need it anymore. Otherwise, it won't get updates.",
+					},
+				}
+			},
+		},
+		{
+			name: "package newer than repo",
+			setup: func(t *testing.T, env *testEnv) {
+				env.install(t, "app", "2.0-1")
+			},
+			expected: func(*testEnv) []doctor.Finding {
+				return []doctor.Finding{{
+					Check:    "newer-than-repo",
+					Severity: doctor.SeverityWarning,
+					Problem:  "app 2.0-1 is installed, which is newer than the newest version in the repos (1.0-1)",
+					Fix:      "It was probably installed manually or from another source. Reinstall it with lure install app to use the version from the repos.",
+				}}
+			},
+		},
+		{
+			name: "package up to date",
+			setup: func(t *testing.T, env *testEnv) {
+				env.install(t, "app", "1.0-1")
+			},
+			expected: func(*testEnv) []doctor.Finding { return nil },
+		},
+		{
+			name: "leftover build directory",
+			setup: func(t *testing.T, env *testEnv) {
+				env.mkdir(t, env.paths.PkgsDir, "old")
+				// Build directories of packages in the repos are kept
+				env.mkdir(t, env.paths.PkgsDir, "app")
+			},
+			expected: func(env *testEnv) []doctor.Finding {
+				path := filepath.Join(env.paths.PkgsDir, "old")
+				return []doctor.Finding{{
+					Check:    "build-dir",
+					Severity: doctor.SeverityWarning,
+					Problem:  path + " contains the build directory of old, which isn't in any repo and isn't installed",
+					Fix:      "Remove it with rm -r " + path + ".",
+				}}
+			},
+		},
+		{
+			name: "invalid cache entry",
+			setup: func(t *testing.T, env *testEnv) {
+				// An entry without a manifest was left behind by an interrupted download
+				_, err := dlcache.New(env.ctx, "https://example.com/app.tar.gz")
+				if err != nil {
+					t.Fatalf("Expected no error, got %s", err)
+				}
+			},
+			expected: func(env *testEnv) []doctor.Finding {
+				path, _ := dlcache.Get(env.ctx, "https://example.com/app.tar.gz")
+				return []doctor.Finding{{
+					Check:    "cache",
+					Severity: doctor.SeverityWarning,
+					Problem:  "the download cache entry " + path + " has a missing or invalid manifest",
+					Fix:      "Remove it with rm -r " + path + ". It will be downloaded again when it's needed.",
+				}}
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			env := setupEnv(t)
+			if tc.setup != nil {
+				tc.setup(t, env)
+			}
+
+			var mgr manager.Manager = env.mgr
+			if tc.noManager {
+				mgr = nil
+			}
+
+			findings, err := doctor.Run(env.ctx, mgr)
+			if err != nil {
+				t.Fatalf("Expected no error, got %s", err)
+			}
+
+			expected := tc.expected(env)
+			if !reflect.DeepEqual(findings, expected) {
+				t.Errorf("Expected %v, got %v", expected, findings)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+/*
+ * LURE - Linux User REpository
+ * Copyright (C) 2023 Elara Musayelyan
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+// Package flock provides advisory file locks, which are used to
+// prevent multiple LURE processes from modifying the same files
+// at the same time.
+package flock
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sintan1729/lure/pkg/loggerctx"
+	"golang.org/x/sys/unix"
+)
+
+// pollInterval is how often a blocked lock is retried
+const pollInterval = 100 * time.Millisecond
+
+// ErrLocked occurs when TryLock is called on a file
+// that's already locked by another process.
+var ErrLocked = errors.New("flock: file is locked by another process")
+
+// Lock represents a held advisory lock on a file
+type Lock struct {
+	fl *os.File
+}
+
+// Acquire takes an exclusive lock on the file at path, creating it if
+// needed. If the file is locked by another process, it waits until the
+// lock is released or the context is canceled.
+func Acquire(ctx context.Context, path string) (*Lock, error) {
+	return acquire(ctx, path, unix.LOCK_EX)
+}
+
+// AcquireShared takes a shared lock on the file at path, creating it if
+// needed. Any number of processes may hold a shared lock at the same time,
+// but not while another process holds an exclusive lock.
+func AcquireShared(ctx context.Context, path string) (*Lock, error) {
+	return acquire(ctx, path, unix.LOCK_SH)
+}
+
+// TryLock attempts to take an exclusive lock on the file at path without
+// waiting. If the file is already locked, it returns ErrLocked.
+func TryLock(path string) (*Lock, error) {
+	fl, err := openLockFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	err = unix.Flock(int(fl.Fd()), unix.LOCK_EX|unix.LOCK_NB)
+	if errors.Is(err, unix.EWOULDBLOCK) {
+		fl.Close()
+		return nil, ErrLocked
+	} else if err != nil {
+		fl.Close()
+		return nil, err
+	}
+
+	return &Lock{fl}, nil
+}
+
+// Release releases the lock
+func (l *Lock) Release() error {
+	if l == nil || l.fl == nil {
+		return nil
+	}
+	err := unix.Flock(int(l.fl.Fd()), unix.LOCK_UN)
+	closeErr := l.fl.Close()
+	l.fl = nil
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+func acquire(ctx context.Context, path string, how int) (*Lock, error) {
+	log := loggerctx.From(ctx)
+
+	fl, err := openLockFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	waiting := false
+	for {
+		err = unix.Flock(int(fl.Fd()), how|unix.LOCK_NB)
+		if err == nil {
+			return &Lock{fl}, nil
+		} else if !errors.Is(err, unix.EWOULDBLOCK) {
+			fl.Close()
+			return nil, err
+		}
+
+		if !waiting {
+			log.Info("Waiting for another LURE process to release lock").Str("path", path).Send()
+			waiting = true
+		}
+
+		select {
+		case <-ctx.Done():
+			fl.Close()
+			return nil, ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+func openLockFile(path string) (*os.File, error) {
+	err := os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		return nil, err
+	}
+	return os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+}
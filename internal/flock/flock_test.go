@@ -0,0 +1,72 @@
+/*
+ * LURE - Linux User REpository
+ * Copyright (C) 2023 Elara Musayelyan
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package flock_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sintan1729/lure/internal/flock"
+)
+
+func TestTryLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lock")
+
+	lock, err := flock.Acquire(context.Background(), path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	_, err = flock.TryLock(path)
+	if !errors.Is(err, flock.ErrLocked) {
+		t.Errorf("Expected ErrLocked, got %v", err)
+	}
+
+	err = lock.Release()
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	lock, err = flock.TryLock(path)
+	if err != nil {
+		t.Fatalf("Expected no error after release, got %s", err)
+	}
+	lock.Release()
+}
+
+func TestAcquireCanceled(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lock")
+
+	lock, err := flock.Acquire(context.Background(), path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	defer lock.Release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	_, err = flock.Acquire(ctx, path)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+}
@@ -0,0 +1,129 @@
+/*
+ * LURE - Linux User REpository
+ * Copyright (C) 2023 Elara Musayelyan
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+// Package installed keeps a record of the LURE packages that have been
+// installed, and whether they were installed explicitly or only as
+// dependencies of other packages.
+package installed
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/sintan1729/lure/internal/config"
+	"github.com/sintan1729/lure/internal/flock"
+)
+
+// Package is the record of an installed LURE package
+type Package struct {
+	Name string `json:"name"`
+	// Dependency is true if the package was only installed
+	// because another package depends on it
+	Dependency bool `json:"dependency"`
+}
+
+// recordPath returns the path of the file that contains the record
+func recordPath(ctx context.Context) string {
+	return filepath.Join(config.GetPaths(ctx).StateDir, "installed.json")
+}
+
+// Packages returns the recorded packages, mapped by their names
+func Packages(ctx context.Context) (map[string]Package, error) {
+	lock, err := flock.AcquireShared(ctx, recordPath(ctx)+".lock")
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Release()
+
+	return load(ctx)
+}
+
+// Add records the given packages as installed. Packages that were
+// already installed explicitly stay that way, even if they're added
+// again as dependencies.
+func Add(ctx context.Context, pkgs ...Package) error {
+	return update(ctx, func(record map[string]Package) {
+		for _, pkg := range pkgs {
+			if old, ok := record[pkg.Name]; ok && !old.Dependency {
+				pkg.Dependency = false
+			}
+			record[pkg.Name] = pkg
+		}
+	})
+}
+
+// Remove removes the packages with the given names from the record
+func Remove(ctx context.Context, names ...string) error {
+	return update(ctx, func(record map[string]Package) {
+		for _, name := range names {
+			delete(record, name)
+		}
+	})
+}
+
+// update applies fn to the record while holding its lock, and saves it
+func update(ctx context.Context, fn func(map[string]Package)) error {
+	lock, err := flock.Acquire(ctx, recordPath(ctx)+".lock")
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	record, err := load(ctx)
+	if err != nil {
+		return err
+	}
+
+	fn(record)
+
+	data, err := json.MarshalIndent(record, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	// The record is written to a temporary file first, so that
+	// it isn't left incomplete if LURE is interrupted
+	path := recordPath(ctx)
+	err = os.WriteFile(path+".tmp", data, 0o644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// load reads the record. The caller should hold its lock.
+func load(ctx context.Context) (map[string]Package, error) {
+	record := map[string]Package{}
+
+	data, err := os.ReadFile(recordPath(ctx))
+	if errors.Is(err, fs.ErrNotExist) {
+		return record, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &record)
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
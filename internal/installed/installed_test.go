@@ -0,0 +1,78 @@
+/*
+ * LURE - Linux User REpository
+ * Copyright (C) 2023 Elara Musayelyan
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package installed_test
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/sintan1729/lure/internal/config"
+	"github.com/sintan1729/lure/internal/installed"
+)
+
+func init() {
+	dir, err := os.MkdirTemp("/tmp", "lure-installed-test.*")
+	if err != nil {
+		panic(err)
+	}
+	config.GetPaths(context.Background()).StateDir = dir
+}
+
+func TestAddRemove(t *testing.T) {
+	ctx := context.Background()
+
+	err := installed.Add(ctx,
+		installed.Package{Name: "foo"},
+		installed.Package{Name: "bar", Dependency: true},
+		installed.Package{Name: "baz", Dependency: true},
+	)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	// Explicitly installed packages should stay that way when they're
+	// added as dependencies, but dependencies can become explicit
+	err = installed.Add(ctx,
+		installed.Package{Name: "foo", Dependency: true},
+		installed.Package{Name: "bar"},
+	)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	err = installed.Remove(ctx, "baz")
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	pkgs, err := installed.Packages(ctx)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	expected := map[string]installed.Package{
+		"foo": {Name: "foo"},
+		"bar": {Name: "bar"},
+	}
+	if !reflect.DeepEqual(pkgs, expected) {
+		t.Errorf("Expected %v, got %v", expected, pkgs)
+	}
+}
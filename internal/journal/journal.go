@@ -0,0 +1,252 @@
+/*
+ * LURE - Linux User REpository
+ * Copyright (C) 2023 Elara Musayelyan
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+// Package journal keeps a record of the build dependencies that are
+// installed for each build, so that they can be removed even if the
+// build is interrupted before it gets a chance to remove them.
+package journal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/sintan1729/lure/internal/config"
+	"github.com/sintan1729/lure/internal/flock"
+)
+
+// Entry is the record of the build dependencies installed for one build
+type Entry struct {
+	ID string `json:"id"`
+	// Package is the name of the package being built
+	Package string `json:"package"`
+	// PID is the process ID of the LURE process doing the build
+	PID     int       `json:"pid"`
+	Started time.Time `json:"started"`
+	// BootID is the ID of the boot the build was started in
+	BootID string `json:"boot_id,omitempty"`
+	// StartTime is the time the process doing the build was
+	// started at, in clock ticks since boot. Together with
+	// BootID, it tells it apart from a later process that
+	// reuses its PID.
+	StartTime uint64 `json:"start_time,omitempty"`
+	// Packages contains the names of the packages
+	// that were installed for the build
+	Packages []string `json:"packages"`
+}
+
+// journalPath returns the path of the file that contains the journal
+func journalPath(ctx context.Context) string {
+	return filepath.Join(config.GetPaths(ctx).StateDir, "build-deps.json")
+}
+
+// Start adds an entry for a build of pkgName that's going to install
+// the given packages, and returns its ID.
+func Start(ctx context.Context, pkgName string, pkgs []string) (string, error) {
+	pid := os.Getpid()
+	started := time.Now()
+	id := strconv.Itoa(pid) + "-" + strconv.FormatInt(started.UnixNano(), 10)
+
+	// If these can't be read, the entry is left without them,
+	// and only its PID is checked to find out if it's running
+	bootID, _ := readBootID()
+	startTime, _ := processStartTime(pid)
+
+	err := update(ctx, func(entries []Entry) []Entry {
+		return append(entries, Entry{
+			ID:        id,
+			Package:   pkgName,
+			PID:       pid,
+			Started:   started,
+			BootID:    bootID,
+			StartTime: startTime,
+			Packages:  pkgs,
+		})
+	})
+	return id, err
+}
+
+// Update replaces the packages in the entry with the given ID
+func Update(ctx context.Context, id string, pkgs []string) error {
+	return update(ctx, func(entries []Entry) []Entry {
+		for i := range entries {
+			if entries[i].ID == id {
+				entries[i].Packages = pkgs
+			}
+		}
+		return entries
+	})
+}
+
+// Finish removes the entries with the given IDs, once
+// their build dependencies have been dealt with
+func Finish(ctx context.Context, ids ...string) error {
+	return update(ctx, func(entries []Entry) []Entry {
+		return slices.DeleteFunc(entries, func(e Entry) bool {
+			return slices.Contains(ids, e.ID)
+		})
+	})
+}
+
+// Packages returns the packages in the entry with the given ID
+func Packages(ctx context.Context, id string) ([]string, error) {
+	lock, err := flock.AcquireShared(ctx, journalPath(ctx)+".lock")
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Release()
+
+	entries, err := load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, e := range entries {
+		if e.ID == id {
+			return e.Packages, nil
+		}
+	}
+	return nil, nil
+}
+
+// Leftovers returns the entries of builds that are no longer running,
+// which means they were interrupted before they could remove their
+// build dependencies.
+func Leftovers(ctx context.Context) ([]Entry, error) {
+	lock, err := flock.AcquireShared(ctx, journalPath(ctx)+".lock")
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Release()
+
+	entries, err := load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return slices.DeleteFunc(entries, func(e Entry) bool {
+		return isRunning(e)
+	}), nil
+}
+
+// isRunning returns true if the process that started the build in e
+// is still running. Entries written by older versions of LURE don't
+// have a boot ID or start time, so only their PID is checked.
+func isRunning(e Entry) bool {
+	if e.BootID != "" {
+		bootID, err := readBootID()
+		if err == nil && bootID != e.BootID {
+			return false
+		}
+	}
+
+	if e.StartTime != 0 {
+		startTime, err := processStartTime(e.PID)
+		if errors.Is(err, fs.ErrNotExist) {
+			return false
+		} else if err == nil && startTime != e.StartTime {
+			return false
+		}
+	}
+
+	err := syscall.Kill(e.PID, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// readBootID returns the random ID the kernel generates on each boot
+func readBootID() (string, error) {
+	data, err := os.ReadFile("/proc/sys/kernel/random/boot_id")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// processStartTime returns the time the process with the
+// given PID was started at, in clock ticks since boot
+func processStartTime(pid int) (uint64, error) {
+	data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return 0, err
+	}
+
+	// The second field is the name of the command in parentheses,
+	// which can contain spaces, so the fields after it are split
+	// from the last closing parenthesis. The start time is the
+	// 22nd field, so it's the 20th one after the command.
+	stat := string(data)
+	fields := strings.Fields(stat[strings.LastIndexByte(stat, ')')+1:])
+	if len(fields) < 20 {
+		return 0, fmt.Errorf("invalid stat file for process %d", pid)
+	}
+	return strconv.ParseUint(fields[19], 10, 64)
+}
+
+// update applies fn to the journal while holding its lock, and saves it
+func update(ctx context.Context, fn func([]Entry) []Entry) error {
+	lock, err := flock.Acquire(ctx, journalPath(ctx)+".lock")
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	entries, err := load(ctx)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(fn(entries), "", "\t")
+	if err != nil {
+		return err
+	}
+
+	// The journal is written to a temporary file first, so that
+	// it isn't left incomplete if LURE is interrupted
+	path := journalPath(ctx)
+	err = os.WriteFile(path+".tmp", data, 0o644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// load reads the journal. The caller should hold its lock.
+func load(ctx context.Context) ([]Entry, error) {
+	data, err := os.ReadFile(journalPath(ctx))
+	if errors.Is(err, fs.ErrNotExist) {
+		return []Entry{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	err = json.Unmarshal(data, &entries)
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
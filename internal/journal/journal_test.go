@@ -0,0 +1,198 @@
+/*
+ * LURE - Linux User REpository
+ * Copyright (C) 2023 Elara Musayelyan
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package journal_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/sintan1729/lure/internal/config"
+	"github.com/sintan1729/lure/internal/journal"
+)
+
+func init() {
+	dir, err := os.MkdirTemp("/tmp", "lure-journal-test.*")
+	if err != nil {
+		panic(err)
+	}
+	config.GetPaths(context.Background()).StateDir = dir
+}
+
+func TestJournal(t *testing.T) {
+	ctx := context.Background()
+
+	id, err := journal.Start(ctx, "foo", []string{"bar"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	err = journal.Update(ctx, id, []string{"bar", "baz"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	pkgs, err := journal.Packages(ctx, id)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	expected := []string{"bar", "baz"}
+	if !reflect.DeepEqual(pkgs, expected) {
+		t.Errorf("Expected %v, got %v", expected, pkgs)
+	}
+
+	// Builds done by this process are still running, so
+	// they shouldn't be considered leftovers
+	leftovers, err := journal.Leftovers(ctx)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	if len(leftovers) != 0 {
+		t.Errorf("Expected no leftovers, got %v", leftovers)
+	}
+
+	err = journal.Finish(ctx, id)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	pkgs, err = journal.Packages(ctx, id)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	if pkgs != nil {
+		t.Errorf("Expected no packages, got %v", pkgs)
+	}
+}
+
+func TestLeftovers(t *testing.T) {
+	ctx := context.Background()
+
+	// Use the PID of a process that has already exited
+	// to simulate a build that was interrupted
+	cmd := exec.Command("true")
+	err := cmd.Run()
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	data := `[{"id": "interrupted", "package": "foo", "pid": ` + strconv.Itoa(cmd.Process.Pid) + `, "packages": ["bar"]}]`
+	err = os.WriteFile(filepath.Join(config.GetPaths(ctx).StateDir, "build-deps.json"), []byte(data), 0o644)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	leftovers, err := journal.Leftovers(ctx)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	if len(leftovers) != 1 || leftovers[0].ID != "interrupted" {
+		t.Fatalf("Expected the interrupted build, got %v", leftovers)
+	}
+
+	err = journal.Finish(ctx, "interrupted")
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	leftovers, err = journal.Leftovers(ctx)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	if len(leftovers) != 0 {
+		t.Errorf("Expected no leftovers, got %v", leftovers)
+	}
+}
+
+func TestLeftoversPIDReuse(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(config.GetPaths(ctx).StateDir, "build-deps.json")
+
+	id, err := journal.Start(ctx, "foo", []string{"bar"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	defer journal.Finish(ctx, id)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	var entries []journal.Entry
+	err = json.Unmarshal(data, &entries)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	if len(entries) != 1 || entries[0].BootID == "" || entries[0].StartTime == 0 {
+		t.Fatalf("Expected an entry with a boot ID and start time, got %v", entries)
+	}
+	entry := entries[0]
+
+	type testCase struct {
+		name     string
+		modify   func(e *journal.Entry)
+		leftover bool
+	}
+
+	for _, tc := range []testCase{
+		{"same process", func(e *journal.Entry) {}, false},
+		{"different start time", func(e *journal.Entry) { e.StartTime++ }, true},
+		{"different boot", func(e *journal.Entry) { e.BootID = "other" }, true},
+		{"no start time or boot", func(e *journal.Entry) {
+			e.BootID = ""
+			e.StartTime = 0
+		}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			e := entry
+			tc.modify(&e)
+
+			data, err := json.Marshal([]journal.Entry{e})
+			if err != nil {
+				t.Fatalf("Expected no error, got %s", err)
+			}
+
+			err = os.WriteFile(path, data, 0o644)
+			if err != nil {
+				t.Fatalf("Expected no error, got %s", err)
+			}
+
+			leftovers, err := journal.Leftovers(ctx)
+			if err != nil {
+				t.Fatalf("Expected no error, got %s", err)
+			}
+
+			if leftover := len(leftovers) == 1; leftover != tc.leftover {
+				t.Errorf("Expected leftover to be %t, got %v", tc.leftover, leftovers)
+			}
+		})
+	}
+}
@@ -48,6 +48,13 @@ func Move(sourcePath, destPath string) error {
 	return nil
 }
 
+// Copy copies the file or directory at sourcePath to destPath.
+// The copied files never share an inode with the originals, even
+// if the originals are hard links.
+func Copy(sourcePath, destPath string) error {
+	return copyDirOrFile(sourcePath, destPath)
+}
+
 func copyDirOrFile(sourcePath, destPath string) error {
 	sourceInfo, err := os.Stat(sourcePath)
 	if err != nil {
@@ -88,6 +95,10 @@ func copyDir(sourcePath, destPath string, sourceInfo os.FileInfo) error {
 	return nil
 }
 
+// copyFile copies the file at sourcePath to destPath. The contents are written
+// to a new file that's then renamed over destPath, because destPath may be a
+// hard link to another file, such as a download cache entry, which would be
+// overwritten as well if destPath was truncated and written to.
 func copyFile(sourcePath, destPath string, sourceInfo os.FileInfo) error {
 	sourceFile, err := os.Open(sourcePath)
 	if err != nil {
@@ -95,10 +106,11 @@ func copyFile(sourcePath, destPath string, sourceInfo os.FileInfo) error {
 	}
 	defer sourceFile.Close()
 
-	destFile, err := os.OpenFile(destPath, os.O_CREATE|os.O_TRUNC|os.O_RDWR, sourceInfo.Mode())
+	destFile, err := os.CreateTemp(filepath.Dir(destPath), "."+filepath.Base(destPath)+".*")
 	if err != nil {
 		return err
 	}
+	defer os.Remove(destFile.Name())
 	defer destFile.Close()
 
 	_, err = io.Copy(destFile, sourceFile)
@@ -106,5 +118,15 @@ func copyFile(sourcePath, destPath string, sourceInfo os.FileInfo) error {
 		return err
 	}
 
-	return nil
+	err = destFile.Chmod(sourceInfo.Mode())
+	if err != nil {
+		return err
+	}
+
+	err = destFile.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(destFile.Name(), destPath)
 }
@@ -35,6 +35,9 @@ type Opts struct {
 	LikeDistros  bool
 	Languages    []string
 	LanguageTags []language.Tag
+	// Arch is the CPU architecture to resolve overrides
+	// for. If it's empty, cpu.Arch() is used.
+	Arch string
 }
 
 var DefaultOpts = &Opts{
@@ -58,12 +61,17 @@ func Resolve(info *distro.OSRelease, opts *Opts) ([]string, error) {
 		return nil, err
 	}
 
-	architectures, err := cpu.CompatibleArches(cpu.Arch())
+	arch := opts.Arch
+	if arch == "" {
+		arch = cpu.Arch()
+	}
+
+	architectures, err := cpu.CompatibleArches(arch)
 	if err != nil {
 		return nil, err
 	}
 
-	distros := []string{info.ID}
+	distros := distroNames(info)
 	if opts.LikeDistros {
 		distros = append(distros, info.Like...)
 	}
@@ -106,6 +114,27 @@ func Resolve(info *distro.OSRelease, opts *Opts) ([]string, error) {
 	return out, nil
 }
 
+// distroNames returns the names that can be used for the distro in info,
+// from the most to the least specific. These are its ID followed by its
+// version and each shorter prefix of the version (such as ubuntu_22_04
+// and ubuntu_22), then its ID followed by its codename (such as
+// ubuntu_jammy), and finally its ID on its own.
+func distroNames(info *distro.OSRelease) []string {
+	var out []string
+	if info.VersionID != "" {
+		parts := strings.Split(info.VersionID, ".")
+		for i := len(parts); i > 0; i-- {
+			out = append(out, info.ID+"_"+strings.Join(parts[:i], "_"))
+		}
+	}
+
+	if info.VersionCodename != "" {
+		out = append(out, info.ID+"_"+info.VersionCodename)
+	}
+
+	return append(out, info.ID)
+}
+
 func (o *Opts) WithName(name string) *Opts {
 	out := &Opts{}
 	*out = *o
@@ -114,6 +143,14 @@ func (o *Opts) WithName(name string) *Opts {
 	return out
 }
 
+func (o *Opts) WithArch(arch string) *Opts {
+	out := &Opts{}
+	*out = *o
+
+	out.Arch = arch
+	return out
+}
+
 func (o *Opts) WithOverrides(v bool) *Opts {
 	out := &Opts{}
 	*out = *o
@@ -158,6 +195,7 @@ type ResolvedPackage struct {
 	Maintainer    string   `db:"maintainer"`
 	Architectures []string `sh:"architectures"`
 	Licenses      []string `sh:"license"`
+	License       string   `db:"license"`
 	Provides      []string `sh:"provides"`
 	Conflicts     []string `sh:"conflicts"`
 	Replaces      []string `sh:"replaces"`
@@ -33,6 +33,13 @@ var info = &distro.OSRelease{
 	Like: []string{"rhel", "fedora"},
 }
 
+// TestMain sets the architecture, so that the results
+// don't depend on the CPU of the system running the tests
+func TestMain(m *testing.M) {
+	os.Setenv("LURE_ARCH", "amd64")
+	os.Exit(m.Run())
+}
+
 func TestResolve(t *testing.T) {
 	names, err := overrides.Resolve(info, nil)
 	if err != nil {
@@ -90,8 +97,7 @@ func TestResolveName(t *testing.T) {
 }
 
 func TestResolveArch(t *testing.T) {
-	os.Setenv("LURE_ARCH", "arm7")
-	defer os.Setenv("LURE_ARCH", "")
+	t.Setenv("LURE_ARCH", "arm7")
 
 	names, err := overrides.Resolve(info, &overrides.Opts{
 		Name:        "deps",
@@ -126,6 +132,89 @@ func TestResolveArch(t *testing.T) {
 	}
 }
 
+func TestResolveOptsArch(t *testing.T) {
+	names, err := overrides.Resolve(info, &overrides.Opts{
+		Name:      "deps",
+		Overrides: true,
+		Arch:      "arm64",
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	expected := []string{
+		"deps_arm64_centos",
+		"deps_centos",
+		"deps_arm64",
+		"deps",
+	}
+
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected %v, got %v", expected, names)
+	}
+}
+
+func TestResolveAMD64Level(t *testing.T) {
+	names, err := overrides.Resolve(info, &overrides.Opts{
+		Name:      "sources",
+		Overrides: true,
+		Arch:      "amd64v3",
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	expected := []string{
+		"sources_amd64v3_centos",
+		"sources_amd64v2_centos",
+		"sources_amd64_centos",
+		"sources_centos",
+		"sources_amd64v3",
+		"sources_amd64v2",
+		"sources_amd64",
+		"sources",
+	}
+
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected %v, got %v", expected, names)
+	}
+}
+
+func TestResolveVersion(t *testing.T) {
+	names, err := overrides.Resolve(&distro.OSRelease{
+		ID:              "ubuntu",
+		Like:            []string{"debian"},
+		VersionID:       "22.04",
+		VersionCodename: "jammy",
+	}, &overrides.Opts{
+		Name:        "deps",
+		Overrides:   true,
+		LikeDistros: true,
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	expected := []string{
+		"deps_amd64_ubuntu_22_04",
+		"deps_ubuntu_22_04",
+		"deps_amd64_ubuntu_22",
+		"deps_ubuntu_22",
+		"deps_amd64_ubuntu_jammy",
+		"deps_ubuntu_jammy",
+		"deps_amd64_ubuntu",
+		"deps_ubuntu",
+		"deps_amd64_debian",
+		"deps_debian",
+		"deps_amd64",
+		"deps",
+	}
+
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected %v, got %v", expected, names)
+	}
+}
+
 func TestResolveNoLikeDistros(t *testing.T) {
 	names, err := overrides.Resolve(info, &overrides.Opts{
 		Overrides:   true,
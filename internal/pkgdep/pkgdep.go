@@ -0,0 +1,277 @@
+/*
+ * LURE - Linux User REpository
+ * Copyright (C) 2023 Elara Musayelyan
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+// Package pkgdep parses package relationships with optional version
+// constraints, such as foo>=1.2, and converts them to the syntax
+// used by each package format.
+package pkgdep
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.elara.ws/vercmp"
+)
+
+var ErrInvalidDep = errors.New("invalid dependency")
+
+// ops contains the supported comparison operators. Two-character
+// operators come first so that they're matched before their prefixes.
+var ops = []string{">=", "<=", "==", ">", "<", "="}
+
+// debOps maps operators to the ones used by Debian, which uses
+// << and >> for strict comparisons
+var debOps = map[string]string{
+	">=": ">=",
+	"<=": "<=",
+	">":  ">>",
+	"<":  "<<",
+	"=":  "=",
+}
+
+// Dep is a package name with an optional version constraint
+type Dep struct {
+	Name string
+	// Op is the comparison operator, such as >=. It's
+	// empty if the dependency has no version constraint.
+	Op      string
+	Version string
+}
+
+// Parse parses a dependency such as foo, foo>=1.2 or bar < 3
+func Parse(s string) (Dep, error) {
+	s = strings.TrimSpace(s)
+
+	i := strings.IndexAny(s, "<>=")
+	if i == -1 {
+		if s == "" || strings.ContainsAny(s, " \t|") {
+			return Dep{}, fmt.Errorf("%w: %q", ErrInvalidDep, s)
+		}
+		return Dep{Name: s}, nil
+	}
+
+	dep := Dep{Name: strings.TrimSpace(s[:i])}
+	rest := s[i:]
+	for _, op := range ops {
+		if strings.HasPrefix(rest, op) {
+			dep.Op = op
+			dep.Version = strings.TrimSpace(rest[len(op):])
+			break
+		}
+	}
+
+	if dep.Op == "==" {
+		dep.Op = "="
+	}
+
+	if dep.Name == "" || dep.Version == "" || strings.ContainsAny(dep.Name+dep.Version, " \t<>=|") {
+		return Dep{}, fmt.Errorf("%w: %q", ErrInvalidDep, s)
+	}
+
+	return dep, nil
+}
+
+// Name returns the package name of the dependency s, without its
+// version constraint. If s has alternatives, the name of the first
+// one is returned. If s can't be parsed, it's returned as-is.
+func Name(s string) string {
+	alts, err := ParseAlternatives(s)
+	if err != nil {
+		return s
+	}
+	return alts[0].Name
+}
+
+// String returns the dependency in LURE's syntax, such as foo>=1.2
+func (d Dep) String() string {
+	return d.Name + d.Op + d.Version
+}
+
+// Format returns the dependency in the syntax used by pkgFormat
+func (d Dep) Format(pkgFormat string) string {
+	if d.Op == "" {
+		return d.Name
+	}
+
+	switch pkgFormat {
+	case "deb":
+		return d.Name + " (" + debOps[d.Op] + " " + d.Version + ")"
+	case "rpm":
+		return d.Name + " " + d.Op + " " + d.Version
+	case "apk":
+		// Alpine puts an r before the release number, such as 1.2-r3
+		version := d.Version
+		if ver, rel, ok := cutRelease(version); ok {
+			version = ver + "-r" + rel
+		}
+		return d.Name + d.Op + version
+	default:
+		return d.String()
+	}
+}
+
+// Alternatives is a dependency that can be satisfied by any one of
+// several packages, such as default-jre | openjdk-17-jre. The first
+// one is preferred.
+type Alternatives []Dep
+
+// ParseAlternatives parses a dependency whose alternatives are
+// separated by |, such as foo>=1.2 | bar. Dependencies without
+// alternatives are returned as a single alternative.
+func ParseAlternatives(s string) (Alternatives, error) {
+	var out Alternatives
+	for _, alt := range strings.Split(s, "|") {
+		dep, err := Parse(alt)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidDep, s)
+		}
+		out = append(out, dep)
+	}
+	return out, nil
+}
+
+// String returns the alternatives in LURE's syntax, such as foo>=1.2 | bar
+func (a Alternatives) String() string {
+	out := make([]string, len(a))
+	for i, dep := range a {
+		out[i] = dep.String()
+	}
+	return strings.Join(out, " | ")
+}
+
+// Format returns the alternatives in the syntax used by pkgFormat.
+// Debian packages list them separated by |, and RPM packages use
+// a rich dependency, such as (foo >= 1.2 or bar). Other formats
+// can't express alternatives, so only the first one is used.
+func (a Alternatives) Format(pkgFormat string) string {
+	if len(a) == 1 {
+		return a[0].Format(pkgFormat)
+	}
+
+	out := make([]string, len(a))
+	for i, dep := range a {
+		out[i] = dep.Format(pkgFormat)
+	}
+
+	switch pkgFormat {
+	case "deb":
+		return strings.Join(out, " | ")
+	case "rpm":
+		return "(" + strings.Join(out, " or ") + ")"
+	default:
+		return out[0]
+	}
+}
+
+// SatisfiedBy returns true if a package with the given epoch, version and
+// release satisfies the dependency's version constraint. The epoch and
+// release are only compared if the constraint includes them, as in 1:2.0-3.
+func (d Dep) SatisfiedBy(epoch uint, version string, release int) bool {
+	if d.Op == "" {
+		return true
+	}
+
+	cmp := compare(d.Version, epoch, version, release)
+	switch d.Op {
+	case ">=":
+		return cmp >= 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case "<":
+		return cmp < 0
+	default:
+		return cmp == 0
+	}
+}
+
+// compare compares a package's version to the constraint version.
+// Like vercmp.Compare, it returns 1 if the package's version is
+// greater, 0 if they're equal, and -1 if the constraint's is greater.
+func compare(constraint string, epoch uint, version string, release int) int {
+	if epochStr, rest, ok := strings.Cut(constraint, ":"); ok {
+		if cEpoch, err := strconv.ParseUint(epochStr, 10, 0); err == nil {
+			if epoch != uint(cEpoch) {
+				if epoch > uint(cEpoch) {
+					return 1
+				}
+				return -1
+			}
+			constraint = rest
+		}
+	}
+
+	cVersion, cRelease, hasRelease := cutRelease(constraint)
+	if !hasRelease {
+		return vercmp.Compare(version, constraint)
+	}
+
+	if cmp := vercmp.Compare(version, cVersion); cmp != 0 {
+		return cmp
+	}
+
+	return vercmp.Compare(strconv.Itoa(release), cRelease)
+}
+
+// CompareVersions compares two full versions such as 1:2.0-3. Like
+// vercmp.Compare, it returns 1 if a is greater, 0 if they're equal,
+// and -1 if b is greater. Epochs and releases are only compared if
+// b includes them.
+func CompareVersions(a, b string) int {
+	epoch, version, release := ParseVersion(a)
+	return compare(b, epoch, version, release)
+}
+
+// ParseVersion splits a full version such as 1:2.0-3 into its
+// epoch, version and release. The epoch and release are zero
+// if the version doesn't include them.
+func ParseVersion(full string) (epoch uint, version string, release int) {
+	version = full
+	if epochStr, rest, ok := strings.Cut(version, ":"); ok {
+		if e, err := strconv.ParseUint(epochStr, 10, 0); err == nil {
+			epoch = uint(e)
+			version = rest
+		}
+	}
+
+	if ver, rel, ok := cutRelease(version); ok {
+		release, _ = strconv.Atoi(rel)
+		version = ver
+	}
+
+	return epoch, version, release
+}
+
+// cutRelease splits a version such as 1.2-3 into the
+// version and the release, if it has a numeric release
+func cutRelease(version string) (string, string, bool) {
+	i := strings.LastIndex(version, "-")
+	if i == -1 {
+		return version, "", false
+	}
+
+	release := strings.TrimPrefix(version[i+1:], "r")
+	if _, err := strconv.Atoi(release); err != nil {
+		return version, "", false
+	}
+
+	return version[:i], release, true
+}
@@ -0,0 +1,171 @@
+/*
+ * LURE - Linux User REpository
+ * Copyright (C) 2023 Elara Musayelyan
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package pkgdep_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/sintan1729/lure/internal/pkgdep"
+)
+
+func TestParse(t *testing.T) {
+	tests := map[string]pkgdep.Dep{
+		"foo":          {Name: "foo"},
+		"foo>=1.2":     {Name: "foo", Op: ">=", Version: "1.2"},
+		"bar < 3":      {Name: "bar", Op: "<", Version: "3"},
+		"baz==1:2.0-3": {Name: "baz", Op: "=", Version: "1:2.0-3"},
+		" qux>1 ":      {Name: "qux", Op: ">", Version: "1"},
+	}
+
+	for in, expected := range tests {
+		dep, err := pkgdep.Parse(in)
+		if err != nil {
+			t.Errorf("Expected no error for %q, got %s", in, err)
+			continue
+		}
+
+		if dep != expected {
+			t.Errorf("Expected %+v for %q, got %+v", expected, in, dep)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, in := range []string{"", ">=1.2", "foo>=", "foo bar", "foo>=1 2", "foo=>1", "foo|bar"} {
+		_, err := pkgdep.Parse(in)
+		if !errors.Is(err, pkgdep.ErrInvalidDep) {
+			t.Errorf("Expected %s for %q, got %v", pkgdep.ErrInvalidDep, in, err)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	type formatTest struct {
+		dep    string
+		format string
+	}
+
+	tests := map[formatTest]string{
+		{"foo", "deb"}:         "foo",
+		{"foo>=1.2", "deb"}:    "foo (>= 1.2)",
+		{"foo>1.2", "deb"}:     "foo (>> 1.2)",
+		{"foo<1.2", "deb"}:     "foo (<< 1.2)",
+		{"foo>=1.2", "rpm"}:    "foo >= 1.2",
+		{"foo=1.2-3", "apk"}:   "foo=1.2-r3",
+		{"foo<2", "archlinux"}: "foo<2",
+	}
+
+	for test, expected := range tests {
+		dep, err := pkgdep.Parse(test.dep)
+		if err != nil {
+			t.Fatalf("Expected no error for %q, got %s", test.dep, err)
+		}
+
+		if out := dep.Format(test.format); out != expected {
+			t.Errorf("Expected %q for %q in %s, got %q", expected, test.dep, test.format, out)
+		}
+	}
+}
+
+func TestSatisfiedBy(t *testing.T) {
+	type satisfiedTest struct {
+		dep     string
+		version string
+	}
+
+	tests := map[satisfiedTest]bool{
+		{"foo", "1.0-1"}:          true,
+		{"foo>=1.2", "1.2-1"}:     true,
+		{"foo>=1.2", "1.10-1"}:    true,
+		{"foo>=1.2", "1.1-5"}:     false,
+		{"foo<3", "2.9-1"}:        true,
+		{"foo<3", "3-1"}:          false,
+		{"foo>1.2", "1.2-9"}:      false,
+		{"foo=1.2", "1.2-9"}:      true,
+		{"foo=1.2-3", "1.2-9"}:    false,
+		{"foo>=1.2-3", "1.2-4"}:   true,
+		{"foo>=2:1.0", "1:5.0-1"}: false,
+		{"foo>=1.0", "1:0.5-1"}:   false,
+	}
+
+	for test, expected := range tests {
+		dep, err := pkgdep.Parse(test.dep)
+		if err != nil {
+			t.Fatalf("Expected no error for %q, got %s", test.dep, err)
+		}
+
+		epoch, version, release := pkgdep.ParseVersion(test.version)
+		if out := dep.SatisfiedBy(epoch, version, release); out != expected {
+			t.Errorf("Expected %t for %q with %s, got %t", expected, test.dep, test.version, out)
+		}
+	}
+}
+
+func TestAlternatives(t *testing.T) {
+	alts, err := pkgdep.ParseAlternatives("default-jre | openjdk-17-jre>=17.0.2")
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	tests := map[string]string{
+		"deb":       "default-jre | openjdk-17-jre (>= 17.0.2)",
+		"rpm":       "(default-jre or openjdk-17-jre >= 17.0.2)",
+		"archlinux": "default-jre",
+		"apk":       "default-jre",
+	}
+
+	for format, expected := range tests {
+		if out := alts.Format(format); out != expected {
+			t.Errorf("Expected %q for %s, got %q", expected, format, out)
+		}
+	}
+
+	if name := pkgdep.Name("foo>=1 | bar"); name != "foo" {
+		t.Errorf("Expected foo, got %q", name)
+	}
+
+	for _, in := range []string{"foo |", "| foo", "foo || bar"} {
+		_, err := pkgdep.ParseAlternatives(in)
+		if !errors.Is(err, pkgdep.ErrInvalidDep) {
+			t.Errorf("Expected %s for %q, got %v", pkgdep.ErrInvalidDep, in, err)
+		}
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	type compareTest struct {
+		a, b string
+	}
+
+	tests := map[compareTest]int{
+		{"1.2-1", "1.2-1"}:     0,
+		{"1.10-1", "1.9-3"}:    1,
+		{"1.2-1", "1.2-2"}:     -1,
+		{"1:1.0-1", "0:2.0-1"}: 1,
+		{"1:1.0-1", "2.0-1"}:   -1,
+		{"1.0-1", "1:0.5-1"}:   -1,
+	}
+
+	for test, expected := range tests {
+		if out := pkgdep.CompareVersions(test.a, test.b); out != expected {
+			t.Errorf("Expected %d for %s and %s, got %d", expected, test.a, test.b, out)
+		}
+	}
+}
@@ -0,0 +1,277 @@
+/*
+ * LURE - Linux User REpository
+ * Copyright (C) 2023 Elara Musayelyan
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package publish
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/sintan1729/lure/internal/cpu"
+	"github.com/sintan1729/lure/internal/signing"
+)
+
+// apkArches maps LURE architectures to Alpine architectures
+var apkArches = map[string]string{
+	"amd64":   "x86_64",
+	"386":     "x86",
+	"arm64":   "aarch64",
+	"arm7":    "armv7",
+	"arm6":    "armhf",
+	"loong64": "loongarch64",
+}
+
+// apkIndexFields maps the fields of .PKGINFO files
+// to the fields of entries in an APKINDEX
+var apkIndexFields = []struct {
+	pkgInfo, index string
+}{
+	{"pkgname", "P"},
+	{"pkgver", "V"},
+	{"arch", "A"},
+	{"size", "I"},
+	{"pkgdesc", "T"},
+	{"url", "U"},
+	{"license", "L"},
+	{"origin", "o"},
+	{"maintainer", "m"},
+	{"builddate", "t"},
+	{"commit", "c"},
+	{"provider_priority", "k"},
+}
+
+// apkIndexLists maps the fields of .PKGINFO files that may appear
+// more than once to the fields of entries in an APKINDEX
+var apkIndexLists = []struct {
+	pkgInfo, index string
+}{
+	{"depend", "D"},
+	{"provides", "p"},
+	{"install_if", "i"},
+}
+
+// apkInfo contains the metadata of an apk package
+type apkInfo struct {
+	*pkgInfo
+	// checksum is the checksum of the control
+	// section, in the format apk expects
+	checksum string
+}
+
+// apkArchDirs returns the directories in the apk repository at
+// base that packages for arch belong in. noarch packages are
+// added to every architecture, including the host's.
+func apkArchDirs(base, arch string) []string {
+	if arch != "noarch" {
+		return []string{filepath.Join(base, arch)}
+	}
+
+	hostArch := cpu.BaseArch(cpu.Arch())
+	if apkArch, ok := apkArches[hostArch]; ok {
+		hostArch = apkArch
+	}
+	dirs := []string{filepath.Join(base, hostArch)}
+
+	entries, _ := os.ReadDir(base)
+	for _, entry := range entries {
+		dir := filepath.Join(base, entry.Name())
+		if entry.IsDir() && !slices.Contains(dirs, dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+
+	return dirs
+}
+
+// indexAPK writes the APKINDEX.tar.gz file of the apk repository
+// directory at dir. If an apk key is configured, the index is signed.
+func indexAPK(dir string, opts Options) error {
+	pkgs, err := listPkgs(dir, "apk")
+	if err != nil {
+		return err
+	}
+
+	index := &bytes.Buffer{}
+	for _, name := range pkgs {
+		path := filepath.Join(dir, name)
+
+		info, err := readAPK(path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+
+		fi, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(index, "C:%s\n", info.checksum)
+		for _, field := range apkIndexFields {
+			if value := info.fields[field.pkgInfo]; value != "" {
+				fmt.Fprintf(index, "%s:%s\n", field.index, value)
+			}
+			// The size of the package file comes after its architecture
+			if field.index == "A" {
+				fmt.Fprintf(index, "S:%d\n", fi.Size())
+			}
+		}
+		for _, field := range apkIndexLists {
+			if values := info.lists[field.pkgInfo]; len(values) > 0 {
+				fmt.Fprintf(index, "%s:%s\n", field.index, strings.Join(values, " "))
+			}
+		}
+		index.WriteString("\n")
+	}
+
+	indexTar := &bytes.Buffer{}
+	tw := tar.NewWriter(indexTar)
+	files := []struct {
+		name string
+		data []byte
+	}{
+		{"DESCRIPTION", []byte(opts.Name)},
+		{"APKINDEX", index.Bytes()},
+	}
+	for _, file := range files {
+		err = writeTarFile(tw, file.name, file.data)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tw.Close()
+	if err != nil {
+		return err
+	}
+
+	indexGz, err := gzipBytes(indexTar.Bytes())
+	if err != nil {
+		return err
+	}
+
+	var sigGz []byte
+	if opts.Keys != nil && opts.Keys.APKKeyFile != "" {
+		sigGz, err = apkSignature(indexGz, opts.Keys)
+		if err != nil {
+			return err
+		}
+	}
+
+	return writeFileAtomic(filepath.Join(dir, "APKINDEX.tar.gz"), func(w io.Writer) error {
+		_, err := w.Write(append(sigGz, indexGz...))
+		return err
+	})
+}
+
+// apkSignature returns the gzipped signature section for
+// the data in signed, which is prepended to the signed data
+func apkSignature(signed []byte, keys *signing.Keys) ([]byte, error) {
+	sig, err := signing.SignRSA(signed, keys.APKKeyFile, keys.Passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	sigTar := &bytes.Buffer{}
+	tw := tar.NewWriter(sigTar)
+	err = writeTarFile(tw, ".SIGN.RSA."+keys.APKKeyName+".rsa.pub", sig)
+	if err != nil {
+		return nil, err
+	}
+
+	// Like abuild-sign, the end of the archive is left out so
+	// that apk reads the next section as part of the same archive
+	err = tw.Flush()
+	if err != nil {
+		return nil, err
+	}
+
+	return gzipBytes(sigTar.Bytes())
+}
+
+// readAPK reads the metadata of the apk package at path. An apk package is
+// made of concatenated gzip streams, one of which contains the .PKGINFO file.
+func readAPK(path string) (*apkInfo, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// bytes.Reader implements io.ByteReader, so gzip doesn't read
+	// past the end of each stream and the offsets are exact
+	r := bytes.NewReader(data)
+	for r.Len() > 0 {
+		start := len(data) - r.Len()
+
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		gr.Multistream(false)
+
+		section, err := io.ReadAll(gr)
+		if err != nil {
+			return nil, err
+		}
+
+		end := len(data) - r.Len()
+
+		pkgInfo, err := readTarFile(bytes.NewReader(section), ".PKGINFO")
+		if errors.Is(err, ErrInvalidPackage) {
+			// This is the signature section
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		sum := sha1.Sum(data[start:end])
+		return &apkInfo{
+			pkgInfo:  parsePkgInfo(pkgInfo),
+			checksum: "Q1" + base64.StdEncoding.EncodeToString(sum[:]),
+		}, nil
+	}
+
+	return nil, fmt.Errorf("%w: no .PKGINFO file", ErrInvalidPackage)
+}
+
+// writeTarFile writes a regular file with the given name and data to tw
+func writeTarFile(tw *tar.Writer, name string, data []byte) error {
+	err := tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0o644,
+		Size:     int64(len(data)),
+		ModTime:  time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = tw.Write(data)
+	return err
+}
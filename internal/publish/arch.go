@@ -0,0 +1,260 @@
+/*
+ * LURE - Linux User REpository
+ * Copyright (C) 2023 Elara Musayelyan
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package publish
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.elara.ws/vercmp"
+)
+
+// pkgInfo contains the fields of a .PKGINFO file. Fields that
+// appear more than once, such as depend, are stored in lists.
+type pkgInfo struct {
+	fields map[string]string
+	lists  map[string][]string
+}
+
+// archDescFields maps the fields of .PKGINFO files to the
+// fields of desc files in a pacman database
+var archDescFields = []struct {
+	pkgInfo, desc string
+}{
+	{"pkgname", "NAME"},
+	{"pkgbase", "BASE"},
+	{"pkgver", "VERSION"},
+	{"pkgdesc", "DESC"},
+	{"group", "GROUPS"},
+	{"size", "ISIZE"},
+	{"url", "URL"},
+	{"license", "LICENSE"},
+	{"arch", "ARCH"},
+	{"builddate", "BUILDDATE"},
+	{"packager", "PACKAGER"},
+	{"replaces", "REPLACES"},
+	{"conflict", "CONFLICTS"},
+	{"provides", "PROVIDES"},
+	{"depend", "DEPENDS"},
+	{"optdepend", "OPTDEPENDS"},
+	{"makedepend", "MAKEDEPENDS"},
+	{"checkdepend", "CHECKDEPENDS"},
+}
+
+// indexArch writes the pacman database of the repository in dir, named
+// after the repository. Only the newest version of each package is
+// included, since pacman doesn't support more than one. If an OpenPGP
+// key is configured, the database is signed.
+func indexArch(dir string, opts Options) error {
+	pkgs, err := listPkgs(dir, "archlinux")
+	if err != nil {
+		return err
+	}
+
+	newest := map[string]*pkgInfo{}
+	var names []string
+	for _, name := range pkgs {
+		path := filepath.Join(dir, name)
+
+		info, err := readArchPkgInfo(path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+
+		pkgName := info.fields["pkgname"]
+		if old, ok := newest[pkgName]; ok {
+			if vercmp.Compare(info.fields["pkgver"], old.fields["pkgver"]) <= 0 {
+				continue
+			}
+		} else {
+			names = append(names, pkgName)
+		}
+
+		info.fields["filename"] = name
+		newest[pkgName] = info
+	}
+
+	dbName := opts.Name + ".db.tar.gz"
+	dbPath := filepath.Join(dir, dbName)
+	err = writeFileAtomic(dbPath, func(w io.Writer) error {
+		gw := gzip.NewWriter(w)
+		tw := tar.NewWriter(gw)
+
+		for _, pkgName := range names {
+			info := newest[pkgName]
+
+			desc, err := archDesc(filepath.Join(dir, info.fields["filename"]), info)
+			if err != nil {
+				return err
+			}
+
+			entryDir := pkgName + "-" + info.fields["pkgver"]
+			err = tw.WriteHeader(&tar.Header{
+				Typeflag: tar.TypeDir,
+				Name:     entryDir + "/",
+				Mode:     0o755,
+				ModTime:  time.Now(),
+			})
+			if err != nil {
+				return err
+			}
+
+			err = writeTarFile(tw, entryDir+"/desc", desc)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = tw.Close()
+		if err != nil {
+			return err
+		}
+		return gw.Close()
+	})
+	if err != nil {
+		return err
+	}
+
+	err = writeSignature(dbPath, dbPath+".sig", opts.Keys, false)
+	if err != nil {
+		return err
+	}
+
+	// pacman downloads the database as <name>.db, so like
+	// repo-add, symlinks are used to point to the real files
+	links := map[string]string{
+		opts.Name + ".db": dbName,
+	}
+	if _, err := os.Stat(dbPath + ".sig"); err == nil {
+		links[opts.Name+".db.sig"] = dbName + ".sig"
+	}
+
+	for link, target := range links {
+		linkPath := filepath.Join(dir, link)
+		err = os.Remove(linkPath)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+
+		err = os.Symlink(target, linkPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// archDesc generates the desc file of the package at path in a pacman database
+func archDesc(path string, info *pkgInfo) ([]byte, error) {
+	hashes, err := hashFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	writeField := func(name string, values ...string) {
+		if len(values) == 0 || values[0] == "" {
+			return
+		}
+		fmt.Fprintf(buf, "%%%s%%\n%s\n\n", name, strings.Join(values, "\n"))
+	}
+
+	writeField("FILENAME", info.fields["filename"])
+	writeField("CSIZE", fmt.Sprint(hashes.Size))
+	for _, field := range archDescFields {
+		writeField(field.desc, info.lists[field.pkgInfo]...)
+	}
+	writeField("MD5SUM", hashes.MD5)
+	writeField("SHA256SUM", hashes.SHA256)
+
+	// pacman verifies packages with the signature in the
+	// database, rather than downloading the .sig file
+	sig, err := os.ReadFile(path + ".sig")
+	if err == nil {
+		writeField("PGPSIG", base64.StdEncoding.EncodeToString(sig))
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// readArchPkgInfo reads the .PKGINFO file of the
+// Arch Linux package at path
+func readArchPkgInfo(path string) (*pkgInfo, error) {
+	fl, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fl.Close()
+
+	r, err := decompress(fl, path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	data, err := readTarFile(r, ".PKGINFO")
+	if err != nil {
+		return nil, err
+	}
+
+	return parsePkgInfo(data), nil
+}
+
+// parsePkgInfo parses a .PKGINFO file, which is used
+// by both Arch Linux and Alpine Linux packages
+func parsePkgInfo(data []byte) *pkgInfo {
+	info := &pkgInfo{
+		fields: map[string]string{},
+		lists:  map[string][]string{},
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if _, ok := info.fields[key]; !ok {
+			info.fields[key] = value
+		}
+		info.lists[key] = append(info.lists[key], value)
+	}
+
+	return info
+}
@@ -0,0 +1,222 @@
+/*
+ * LURE - Linux User REpository
+ * Copyright (C) 2023 Elara Musayelyan
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package publish
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/blakesmith/ar"
+	"github.com/sintan1729/lure/internal/signing"
+)
+
+// indexDeb writes the Packages and Release files of the flat
+// APT repository in dir. If an OpenPGP key is configured, the
+// Release file is also signed as InRelease and Release.gpg.
+func indexDeb(dir string, opts Options) error {
+	pkgs, err := listPkgs(dir, "deb")
+	if err != nil {
+		return err
+	}
+
+	packages := &bytes.Buffer{}
+	var archs []string
+	for _, name := range pkgs {
+		path := filepath.Join(dir, name)
+
+		control, err := readDebControl(path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+
+		hashes, err := hashFile(path)
+		if err != nil {
+			return err
+		}
+
+		if arch := controlField(control, "Architecture"); arch != "" && !slices.Contains(archs, arch) {
+			archs = append(archs, arch)
+		}
+
+		packages.WriteString(strings.TrimRight(control, "\n"))
+		fmt.Fprintf(packages, "\nFilename: ./%s\n", name)
+		fmt.Fprintf(packages, "Size: %d\n", hashes.Size)
+		fmt.Fprintf(packages, "MD5sum: %s\n", hashes.MD5)
+		fmt.Fprintf(packages, "SHA1: %s\n", hashes.SHA1)
+		fmt.Fprintf(packages, "SHA256: %s\n\n", hashes.SHA256)
+	}
+	slices.Sort(archs)
+
+	packagesGz, err := gzipBytes(packages.Bytes())
+	if err != nil {
+		return err
+	}
+
+	indexes := []struct {
+		name   string
+		data   []byte
+		hashes fileHashes
+	}{
+		{name: "Packages", data: packages.Bytes()},
+		{name: "Packages.gz", data: packagesGz},
+	}
+
+	for i := range indexes {
+		indexes[i].hashes, err = hashReader(bytes.NewReader(indexes[i].data))
+		if err != nil {
+			return err
+		}
+	}
+
+	release := &bytes.Buffer{}
+	fmt.Fprintf(release, "Origin: %s\n", opts.Name)
+	fmt.Fprintf(release, "Label: %s\n", opts.Name)
+	fmt.Fprintf(release, "Date: %s\n", time.Now().UTC().Format(time.RFC1123))
+	if len(archs) > 0 {
+		fmt.Fprintf(release, "Architectures: %s\n", strings.Join(archs, " "))
+	}
+
+	sums := []struct {
+		field string
+		value func(fileHashes) string
+	}{
+		{"MD5Sum", func(h fileHashes) string { return h.MD5 }},
+		{"SHA1", func(h fileHashes) string { return h.SHA1 }},
+		{"SHA256", func(h fileHashes) string { return h.SHA256 }},
+	}
+
+	for _, sum := range sums {
+		fmt.Fprintf(release, "%s:\n", sum.field)
+		for _, idx := range indexes {
+			fmt.Fprintf(release, " %s %d %s\n", sum.value(idx.hashes), idx.hashes.Size, idx.name)
+		}
+	}
+
+	for _, idx := range indexes {
+		err = writeFileAtomic(filepath.Join(dir, idx.name), func(w io.Writer) error {
+			_, err := w.Write(idx.data)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	releasePath := filepath.Join(dir, "Release")
+	err = writeFileAtomic(releasePath, func(w io.Writer) error {
+		_, err := w.Write(release.Bytes())
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	err = writeSignature(releasePath, filepath.Join(dir, "Release.gpg"), opts.Keys, true)
+	if err != nil {
+		return err
+	}
+
+	inReleasePath := filepath.Join(dir, "InRelease")
+	if opts.Keys == nil || opts.Keys.KeyFile == "" {
+		err = os.Remove(inReleasePath)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	return writeFileAtomic(inReleasePath, func(w io.Writer) error {
+		return signing.ClearSign(w, release.Bytes(), opts.Keys.KeyFile, opts.Keys.Passphrase)
+	})
+}
+
+// readDebControl returns the contents of the control
+// file in the control archive of the deb package at path
+func readDebControl(path string) (string, error) {
+	fl, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer fl.Close()
+
+	arReader := ar.NewReader(fl)
+	for {
+		hdr, err := arReader.Next()
+		if errors.Is(err, io.EOF) {
+			return "", fmt.Errorf("%w: no control archive", ErrInvalidPackage)
+		} else if err != nil {
+			return "", err
+		}
+
+		name := strings.TrimSuffix(hdr.Name, "/")
+		if !strings.HasPrefix(name, "control.tar") {
+			continue
+		}
+
+		r, err := decompress(arReader, name)
+		if err != nil {
+			return "", err
+		}
+		defer r.Close()
+
+		control, err := readTarFile(r, "control")
+		if err != nil {
+			return "", err
+		}
+		return string(control), nil
+	}
+}
+
+// controlField returns the value of a single-line
+// field in a Debian control file
+func controlField(control, field string) string {
+	for _, line := range strings.Split(control, "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if ok && strings.EqualFold(key, field) {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+// readTarFile returns the contents of the file with the given
+// name in the tar archive in r, ignoring any leading "./"
+func readTarFile(r io.Reader, name string) ([]byte, error) {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%w: no %s file", ErrInvalidPackage, name)
+		} else if err != nil {
+			return nil, err
+		}
+
+		if strings.TrimPrefix(hdr.Name, "./") == name {
+			return io.ReadAll(tr)
+		}
+	}
+}
@@ -0,0 +1,398 @@
+/*
+ * LURE - Linux User REpository
+ * Copyright (C) 2023 Elara Musayelyan
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+// Package publish maintains a local package repository that the system
+// package manager can install LURE-built packages from. Packages are
+// stored in a directory for each package format, along with the native
+// metadata for that format:
+//
+//   - deb: a flat APT repository with Packages and Release files
+//   - rpm: repodata for dnf, yum and zypper
+//   - archlinux: a pacman database
+//   - apk: an APKINDEX for each architecture
+package publish
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/sintan1729/lure/internal/config"
+	"github.com/sintan1729/lure/internal/flock"
+	"github.com/sintan1729/lure/internal/signing"
+	"github.com/ulikunitz/xz"
+)
+
+var (
+	ErrNoRepoDir      = errors.New("publish: no repository directory configured")
+	ErrNotAPackage    = errors.New("publish: not a package file")
+	ErrInvalidPackage = errors.New("publish: invalid package")
+)
+
+// DefaultName is the name of the repository if none is configured
+const DefaultName = "lure"
+
+// Options contains the settings for a repository
+type Options struct {
+	// Dir is the directory the repository is in
+	Dir string
+	// Name is the name of the repository
+	Name string
+	// Keys are used to sign the repository metadata.
+	// If it's nil, the metadata isn't signed.
+	Keys *signing.Keys
+}
+
+// OptionsFromConfig returns the repository options in the LURE config,
+// with the metadata signed by keys. If dir isn't empty, it overrides
+// the configured directory.
+func OptionsFromConfig(ctx context.Context, dir string, keys *signing.Keys) (Options, error) {
+	cfg := config.Config(ctx)
+
+	if dir == "" {
+		dir = signing.ExpandPath(cfg.Publish.Dir)
+	}
+	if dir == "" {
+		return Options{}, ErrNoRepoDir
+	}
+
+	name := cfg.Publish.Name
+	if name == "" {
+		name = DefaultName
+	}
+
+	return Options{Dir: dir, Name: name, Keys: keys}, nil
+}
+
+// archPkgRegex matches the file names of Arch Linux packages
+var archPkgRegex = regexp.MustCompile(`\.pkg\.tar(\.(zst|xz|gz|bz2))?$`)
+
+// Format returns the package format of the package file at path,
+// or an empty string if it's not a package
+func Format(path string) string {
+	name := filepath.Base(path)
+	switch {
+	case strings.HasSuffix(name, ".deb"):
+		return "deb"
+	case strings.HasSuffix(name, ".rpm"):
+		return "rpm"
+	case strings.HasSuffix(name, ".apk"):
+		return "apk"
+	case archPkgRegex.MatchString(name):
+		return "archlinux"
+	default:
+		return ""
+	}
+}
+
+// Publish copies the given files into the repository and regenerates
+// the metadata of every directory they're copied to. Files that aren't
+// packages, such as signatures and SBOMs, are copied along with the
+// package whose file name they start with. It returns the paths of the
+// published packages in the repository.
+func Publish(ctx context.Context, opts Options, files []string) ([]string, error) {
+	err := os.MkdirAll(opts.Dir, 0o755)
+	if err != nil {
+		return nil, err
+	}
+
+	// Lock the repository so that packages built at the same
+	// time can't overwrite each other's metadata
+	lock, err := flock.Acquire(ctx, filepath.Join(opts.Dir, ".lock"))
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Release()
+
+	var pkgs []string
+	for _, file := range files {
+		if Format(file) != "" {
+			pkgs = append(pkgs, file)
+		}
+	}
+
+	if len(pkgs) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNotAPackage, strings.Join(files, ", "))
+	}
+
+	var published, dirs []string
+	for _, pkg := range pkgs {
+		destDirs, destName, err := pkgDest(opts.Dir, pkg)
+		if err != nil {
+			return nil, err
+		}
+
+		var extras []string
+		for _, file := range files {
+			if Format(file) == "" && strings.HasPrefix(filepath.Base(file), filepath.Base(pkg)+".") {
+				extras = append(extras, file)
+			}
+		}
+
+		for _, destDir := range destDirs {
+			err = os.MkdirAll(destDir, 0o755)
+			if err != nil {
+				return nil, err
+			}
+
+			err = copyFile(pkg, filepath.Join(destDir, destName))
+			if err != nil {
+				return nil, err
+			}
+
+			for _, file := range extras {
+				suffix := strings.TrimPrefix(filepath.Base(file), filepath.Base(pkg))
+				err = copyFile(file, filepath.Join(destDir, destName+suffix))
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			published = append(published, filepath.Join(destDir, destName))
+			if !slices.Contains(dirs, destDir) {
+				dirs = append(dirs, destDir)
+			}
+		}
+	}
+
+	for _, dir := range dirs {
+		err = index(dir, opts)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return published, nil
+}
+
+// pkgDest returns the directories in the repository at repoDir
+// that the package at path belongs in, and its file name there
+func pkgDest(repoDir, path string) ([]string, string, error) {
+	format := Format(path)
+	if format != "apk" {
+		return []string{filepath.Join(repoDir, format)}, filepath.Base(path), nil
+	}
+
+	// apk repositories have a directory for each architecture
+	info, err := readAPK(path)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// apk downloads packages as <name>-<version>.apk, which
+	// isn't the conventional file name that nfpm uses
+	name := info.fields["pkgname"] + "-" + info.fields["pkgver"] + ".apk"
+	return apkArchDirs(filepath.Join(repoDir, format), info.fields["arch"]), name, nil
+}
+
+// index regenerates the metadata for the packages in dir
+func index(dir string, opts Options) error {
+	switch filepath.Base(dir) {
+	case "deb":
+		return indexDeb(dir, opts)
+	case "rpm":
+		return indexRPM(dir, opts)
+	case "archlinux":
+		return indexArch(dir, opts)
+	default:
+		// apk directories are named after the architecture
+		return indexAPK(dir, opts)
+	}
+}
+
+// listPkgs returns the names of all the packages
+// of the given format in dir, sorted by name
+func listPkgs(dir, format string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && Format(entry.Name()) == format {
+			out = append(out, entry.Name())
+		}
+	}
+	return out, nil
+}
+
+// fileHashes contains the size and hashes of a file
+type fileHashes struct {
+	Size   int64
+	MD5    string
+	SHA1   string
+	SHA256 string
+}
+
+// hashFile returns the size and hashes of the file at path
+func hashFile(path string) (fileHashes, error) {
+	fl, err := os.Open(path)
+	if err != nil {
+		return fileHashes{}, err
+	}
+	defer fl.Close()
+	return hashReader(fl)
+}
+
+// hashReader returns the size and hashes of the data in r
+func hashReader(r io.Reader) (fileHashes, error) {
+	md5Hash, sha1Hash, sha256Hash := md5.New(), sha1.New(), sha256.New()
+	size, err := io.Copy(io.MultiWriter(md5Hash, sha1Hash, sha256Hash), r)
+	if err != nil {
+		return fileHashes{}, err
+	}
+
+	return fileHashes{
+		Size:   size,
+		MD5:    hexSum(md5Hash),
+		SHA1:   hexSum(sha1Hash),
+		SHA256: hexSum(sha256Hash),
+	}, nil
+}
+
+func hexSum(h hash.Hash) string {
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// copyFile copies src to dest, replacing dest atomically
+// so that clients never see a partially written file
+func copyFile(src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	return writeFileAtomic(dest, func(w io.Writer) error {
+		_, err := io.Copy(w, in)
+		return err
+	})
+}
+
+// writeFileAtomic writes the output of write to a temporary
+// file, then renames it to path once it's complete
+func writeFileAtomic(path string, write func(w io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	err = write(tmp)
+	if err != nil {
+		return err
+	}
+
+	err = tmp.Chmod(0o644)
+	if err != nil {
+		return err
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// writeSignature writes an armored detached signature of the file at
+// path to sigPath if keys contains an OpenPGP key. Otherwise, any old
+// signature at sigPath is removed.
+func writeSignature(path, sigPath string, keys *signing.Keys, armored bool) error {
+	if keys == nil || keys.KeyFile == "" {
+		err := os.Remove(sigPath)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	fl, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fl.Close()
+
+	return writeFileAtomic(sigPath, func(w io.Writer) error {
+		if armored {
+			return signing.ArmoredDetachSign(w, fl, keys.KeyFile, keys.Passphrase)
+		}
+		return signing.DetachSign(w, fl, keys.KeyFile, keys.Passphrase)
+	})
+}
+
+// decompress returns a reader that decompresses r based on the
+// extension of name. Files without a known extension are returned as-is.
+func decompress(r io.Reader, name string) (io.ReadCloser, error) {
+	switch filepath.Ext(name) {
+	case ".gz":
+		return gzip.NewReader(r)
+	case ".xz":
+		xr, err := xz.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(xr), nil
+	case ".zst":
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	default:
+		return io.NopCloser(r), nil
+	}
+}
+
+// gzipBytes compresses data with gzip
+func gzipBytes(data []byte) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	gw, err := gzip.NewWriterLevel(buf, gzip.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = gw.Write(data)
+	if err != nil {
+		return nil, err
+	}
+
+	err = gw.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,543 @@
+/*
+ * LURE - Linux User REpository
+ * Copyright (C) 2023 Elara Musayelyan
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package publish_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto"
+	"crypto/md5"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"encoding/xml"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/clearsign"
+	"github.com/goreleaser/nfpm/v2"
+	_ "github.com/goreleaser/nfpm/v2/apk"
+	_ "github.com/goreleaser/nfpm/v2/arch"
+	_ "github.com/goreleaser/nfpm/v2/deb"
+	"github.com/goreleaser/nfpm/v2/files"
+	_ "github.com/goreleaser/nfpm/v2/rpm"
+	"github.com/sintan1729/lure/internal/publish"
+	"github.com/sintan1729/lure/internal/signing"
+)
+
+func TestFormat(t *testing.T) {
+	tests := map[string]string{
+		"foo_1.0-1_amd64.deb":              "deb",
+		"/tmp/foo-1.0-1.x86_64.rpm":        "rpm",
+		"foo_1.0-r1_x86_64.apk":            "apk",
+		"foo-1.0-1-x86_64.pkg.tar.zst":     "archlinux",
+		"foo-1.0-1-any.pkg.tar.xz":         "archlinux",
+		"foo-1.0-1-x86_64.pkg.tar.zst.sig": "",
+		"foo_1.0-1_amd64.deb.cdx.json":     "",
+		"foo-1.0.tar.gz":                   "",
+	}
+
+	for path, expected := range tests {
+		if format := publish.Format(path); format != expected {
+			t.Errorf("Expected %q for %q, got %q", expected, path, format)
+		}
+	}
+}
+
+var (
+	testKeysOnce sync.Once
+	testKeysDir  string
+	testKeys     *signing.Keys
+	testKeysErr  error
+)
+
+// signingKeys returns keys for signing the repository metadata.
+// Generating them is slow, so they're shared between tests.
+func signingKeys(t *testing.T) *signing.Keys {
+	t.Helper()
+
+	testKeysOnce.Do(func() {
+		testKeysDir, testKeysErr = os.MkdirTemp("", "lure-publish-keys-*")
+		if testKeysErr != nil {
+			return
+		}
+
+		var pgpKey, rsaKey []byte
+		pgpKey, rsaKey, testKeysErr = signing.Generate("Test", "test@example.com", "")
+		if testKeysErr != nil {
+			return
+		}
+
+		testKeys = &signing.Keys{
+			KeyFile:    filepath.Join(testKeysDir, "key.asc"),
+			APKKeyFile: filepath.Join(testKeysDir, "key.rsa"),
+			APKKeyName: "test",
+		}
+
+		testKeysErr = os.WriteFile(testKeys.KeyFile, pgpKey, 0o600)
+		if testKeysErr != nil {
+			return
+		}
+		testKeysErr = os.WriteFile(testKeys.APKKeyFile, rsaKey, 0o600)
+	})
+
+	if testKeysErr != nil {
+		t.Fatalf("Expected no error, got %s", testKeysErr)
+	}
+	return testKeys
+}
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if testKeysDir != "" {
+		os.RemoveAll(testKeysDir)
+	}
+	os.Exit(code)
+}
+
+// buildPkg builds a small package in the given format with nfpm
+// and returns its path
+func buildPkg(t *testing.T, format string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	src := filepath.Join(dir, "hello")
+	err := os.WriteFile(src, []byte("#!/bin/sh\necho hello\n"), 0o755)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	info := &nfpm.Info{
+		Name:        "hello",
+		Arch:        "amd64",
+		Platform:    "linux",
+		Version:     "1.0.0",
+		Release:     "1",
+		Description: "Says hello",
+		Maintainer:  "Test <test@example.com>",
+		License:     "GPL-3.0-or-later",
+		Overridables: nfpm.Overridables{
+			Depends: []string{"bash"},
+			Contents: files.Contents{
+				{Source: src, Destination: "/usr/bin/hello"},
+			},
+		},
+	}
+
+	packager, err := nfpm.Get(format)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	path := filepath.Join(dir, packager.ConventionalFileName(info))
+	fl, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	defer fl.Close()
+
+	err = packager.Package(nfpm.WithDefaults(info), fl)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	return path
+}
+
+// publishPkg builds a package in the given format and publishes
+// it to a new repository signed with signingKeys. It returns the
+// path of the published package.
+func publishPkg(t *testing.T, format string) string {
+	t.Helper()
+
+	opts := publish.Options{
+		Dir:  t.TempDir(),
+		Name: "test",
+		Keys: signingKeys(t),
+	}
+
+	published, err := publish.Publish(context.Background(), opts, []string{buildPkg(t, format)})
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	if len(published) != 1 {
+		t.Fatalf("Expected one published package, got %v", published)
+	}
+
+	return published[0]
+}
+
+// fileSums contains the size and checksums of a file
+type fileSums struct {
+	size              int64
+	md5, sha1, sha256 string
+	sha1Raw           []byte
+}
+
+func sumBytes(data []byte) fileSums {
+	md5Sum, sha1Sum, sha256Sum := md5.Sum(data), sha1.Sum(data), sha256.Sum256(data)
+	return fileSums{
+		size:    int64(len(data)),
+		md5:     hex.EncodeToString(md5Sum[:]),
+		sha1:    hex.EncodeToString(sha1Sum[:]),
+		sha256:  hex.EncodeToString(sha256Sum[:]),
+		sha1Raw: sha1Sum[:],
+	}
+}
+
+func readFile(t *testing.T, path string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	return data
+}
+
+func expectField(t *testing.T, name, expected, actual string) {
+	t.Helper()
+	if actual != expected {
+		t.Errorf("Expected %s to be %q, got %q", name, expected, actual)
+	}
+}
+
+// parseFields parses "key: value" lines, as used by APT and APKINDEX
+// files, stopping at the first blank line
+func parseFields(data, sep string) map[string]string {
+	out := map[string]string{}
+	for _, line := range strings.Split(data, "\n") {
+		if line == "" {
+			break
+		}
+		key, value, ok := strings.Cut(line, sep)
+		if ok {
+			out[key] = strings.TrimSpace(value)
+		}
+	}
+	return out
+}
+
+func verifySignature(t *testing.T, signed, sig []byte) {
+	t.Helper()
+
+	entity, err := signing.ReadPGPKey(signingKeys(t).KeyFile, "")
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	_, err = openpgp.CheckArmoredDetachedSignature(openpgp.EntityList{entity}, bytes.NewReader(signed), bytes.NewReader(sig), nil)
+	if err != nil {
+		_, err = openpgp.CheckDetachedSignature(openpgp.EntityList{entity}, bytes.NewReader(signed), bytes.NewReader(sig), nil)
+	}
+	if err != nil {
+		t.Errorf("Expected a valid signature, got %s", err)
+	}
+}
+
+func TestPublishDeb(t *testing.T) {
+	pkgPath := publishPkg(t, "deb")
+	dir := filepath.Dir(pkgPath)
+	sums := sumBytes(readFile(t, pkgPath))
+
+	packages := readFile(t, filepath.Join(dir, "Packages"))
+	fields := parseFields(string(packages), ":")
+	expectField(t, "Package", "hello", fields["Package"])
+	expectField(t, "Version", "1.0.0-1", fields["Version"])
+	expectField(t, "Filename", "./"+filepath.Base(pkgPath), fields["Filename"])
+	expectField(t, "Size", strconv.FormatInt(sums.size, 10), fields["Size"])
+	expectField(t, "MD5sum", sums.md5, fields["MD5sum"])
+	expectField(t, "SHA1", sums.sha1, fields["SHA1"])
+	expectField(t, "SHA256", sums.sha256, fields["SHA256"])
+
+	gr, err := gzip.NewReader(bytes.NewReader(readFile(t, filepath.Join(dir, "Packages.gz"))))
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	packagesGz, err := io.ReadAll(gr)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	if !bytes.Equal(packagesGz, packages) {
+		t.Error("Expected Packages.gz to contain Packages")
+	}
+
+	release := readFile(t, filepath.Join(dir, "Release"))
+	for _, index := range []string{"Packages", "Packages.gz"} {
+		indexSums := sumBytes(readFile(t, filepath.Join(dir, index)))
+		for _, line := range []string{indexSums.md5, indexSums.sha1, indexSums.sha256} {
+			entry := " " + line + " " + strconv.FormatInt(indexSums.size, 10) + " " + index + "\n"
+			if !bytes.Contains(release, []byte(entry)) {
+				t.Errorf("Expected Release to contain %q", entry)
+			}
+		}
+	}
+
+	verifySignature(t, release, readFile(t, filepath.Join(dir, "Release.gpg")))
+
+	block, _ := clearsign.Decode(readFile(t, filepath.Join(dir, "InRelease")))
+	if block == nil {
+		t.Fatal("Expected InRelease to be a cleartext signed message")
+	}
+	if !bytes.Equal(block.Plaintext, release) {
+		t.Error("Expected InRelease to contain Release")
+	}
+}
+
+type repomd struct {
+	Data []struct {
+		Type     string `xml:"type,attr"`
+		Checksum string `xml:"checksum"`
+		OpenSize int64  `xml:"open-size"`
+		Location struct {
+			Href string `xml:"href,attr"`
+		} `xml:"location"`
+	} `xml:"data"`
+}
+
+type primary struct {
+	Count    int `xml:"packages,attr"`
+	Packages []struct {
+		Name     string `xml:"name"`
+		Checksum string `xml:"checksum"`
+		Size     struct {
+			Package int64 `xml:"package,attr"`
+		} `xml:"size"`
+		Location struct {
+			Href string `xml:"href,attr"`
+		} `xml:"location"`
+	} `xml:"package"`
+}
+
+func TestPublishRPM(t *testing.T) {
+	pkgPath := publishPkg(t, "rpm")
+	dir := filepath.Dir(pkgPath)
+	sums := sumBytes(readFile(t, pkgPath))
+
+	repomdPath := filepath.Join(dir, "repodata", "repomd.xml")
+	repomdData := readFile(t, repomdPath)
+	verifySignature(t, repomdData, readFile(t, repomdPath+".asc"))
+
+	var md repomd
+	err := xml.Unmarshal(repomdData, &md)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	var primaryData []byte
+	for _, data := range md.Data {
+		gz := readFile(t, filepath.Join(dir, data.Location.Href))
+		expectField(t, data.Type+" checksum", sumBytes(gz).sha256, data.Checksum)
+
+		gr, err := gzip.NewReader(bytes.NewReader(gz))
+		if err != nil {
+			t.Fatalf("Expected no error, got %s", err)
+		}
+		open, err := io.ReadAll(gr)
+		if err != nil {
+			t.Fatalf("Expected no error, got %s", err)
+		}
+		if int64(len(open)) != data.OpenSize {
+			t.Errorf("Expected %s to be %d bytes, got %d", data.Type, data.OpenSize, len(open))
+		}
+
+		if data.Type == "primary" {
+			primaryData = open
+		}
+	}
+
+	if primaryData == nil {
+		t.Fatal("Expected repomd.xml to contain primary metadata")
+	}
+
+	var pr primary
+	err = xml.Unmarshal(primaryData, &pr)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	if pr.Count != 1 || len(pr.Packages) != 1 {
+		t.Fatalf("Expected one package, got %d", len(pr.Packages))
+	}
+
+	pkg := pr.Packages[0]
+	expectField(t, "name", "hello", pkg.Name)
+	expectField(t, "location", filepath.Base(pkgPath), pkg.Location.Href)
+	expectField(t, "checksum", sums.sha256, pkg.Checksum)
+	if pkg.Size.Package != sums.size {
+		t.Errorf("Expected the size to be %d, got %d", sums.size, pkg.Size.Package)
+	}
+}
+
+// readTarGz returns the files in a gzipped tar archive. Concatenated
+// gzip streams are read as a single archive.
+func readTarGz(t *testing.T, data []byte) map[string][]byte {
+	t.Helper()
+
+	gr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	out := map[string][]byte{}
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return out
+		} else if err != nil {
+			t.Fatalf("Expected no error, got %s", err)
+		}
+
+		out[hdr.Name], err = io.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("Expected no error, got %s", err)
+		}
+	}
+}
+
+// parseDesc parses a desc file in a pacman database
+func parseDesc(data string) map[string]string {
+	out := map[string]string{}
+	for _, section := range strings.Split(strings.TrimSpace(data), "\n\n") {
+		key, value, _ := strings.Cut(section, "\n")
+		out[strings.Trim(key, "%")] = value
+	}
+	return out
+}
+
+func TestPublishArch(t *testing.T) {
+	pkgPath := publishPkg(t, "archlinux")
+	dir := filepath.Dir(pkgPath)
+	sums := sumBytes(readFile(t, pkgPath))
+
+	dbPath := filepath.Join(dir, "test.db")
+	db := readFile(t, dbPath)
+	verifySignature(t, db, readFile(t, dbPath+".sig"))
+
+	files := readTarGz(t, db)
+	desc, ok := files["hello-1.0.0-1/desc"]
+	if !ok {
+		t.Fatalf("Expected the database to contain hello-1.0.0-1/desc, got %v", files)
+	}
+
+	fields := parseDesc(string(desc))
+	expectField(t, "NAME", "hello", fields["NAME"])
+	expectField(t, "VERSION", "1.0.0-1", fields["VERSION"])
+	expectField(t, "FILENAME", filepath.Base(pkgPath), fields["FILENAME"])
+	expectField(t, "CSIZE", strconv.FormatInt(sums.size, 10), fields["CSIZE"])
+	expectField(t, "MD5SUM", sums.md5, fields["MD5SUM"])
+	expectField(t, "SHA256SUM", sums.sha256, fields["SHA256SUM"])
+	expectField(t, "DEPENDS", "bash", fields["DEPENDS"])
+}
+
+// gzipStreams splits data into its concatenated gzip streams
+func gzipStreams(t *testing.T, data []byte) [][]byte {
+	t.Helper()
+
+	var out [][]byte
+	r := bytes.NewReader(data)
+	for r.Len() > 0 {
+		start := len(data) - r.Len()
+
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			t.Fatalf("Expected no error, got %s", err)
+		}
+		gr.Multistream(false)
+
+		_, err = io.Copy(io.Discard, gr)
+		if err != nil {
+			t.Fatalf("Expected no error, got %s", err)
+		}
+
+		out = append(out, data[start:len(data)-r.Len()])
+	}
+	return out
+}
+
+func TestPublishAPK(t *testing.T) {
+	pkgPath := publishPkg(t, "apk")
+	dir := filepath.Dir(pkgPath)
+	pkgData := readFile(t, pkgPath)
+
+	expectField(t, "architecture directory", "x86_64", filepath.Base(dir))
+	expectField(t, "file name", "hello-1.0.0-r1.apk", filepath.Base(pkgPath))
+
+	// The checksum in the index is the SHA1 of the control section, which
+	// is the first stream after the signature added by nfpm, if any
+	var control []byte
+	for _, stream := range gzipStreams(t, pkgData) {
+		if _, ok := readTarGz(t, stream)[".PKGINFO"]; ok {
+			control = stream
+			break
+		}
+	}
+	if control == nil {
+		t.Fatal("Expected the package to contain .PKGINFO")
+	}
+
+	indexData := readFile(t, filepath.Join(dir, "APKINDEX.tar.gz"))
+	streams := gzipStreams(t, indexData)
+	if len(streams) != 2 {
+		t.Fatalf("Expected a signature and an index, got %d streams", len(streams))
+	}
+
+	files := readTarGz(t, indexData)
+	sig, ok := files[".SIGN.RSA.test.rsa.pub"]
+	if !ok {
+		t.Fatalf("Expected the index to be signed, got %v", files)
+	}
+
+	pubPEM, err := signing.RSAPublicKey(signingKeys(t).APKKeyFile, "")
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	block, _ := pem.Decode(pubPEM)
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	err = rsa.VerifyPKCS1v15(pub.(*rsa.PublicKey), crypto.SHA1, sumBytes(streams[1]).sha1Raw, sig)
+	if err != nil {
+		t.Errorf("Expected a valid index signature, got %s", err)
+	}
+
+	fields := parseFields(string(files["APKINDEX"]), ":")
+	expectField(t, "C", "Q1"+base64.StdEncoding.EncodeToString(sumBytes(control).sha1Raw), fields["C"])
+	expectField(t, "P", "hello", fields["P"])
+	expectField(t, "V", "1.0.0-r1", fields["V"])
+	expectField(t, "A", "x86_64", fields["A"])
+	expectField(t, "S", strconv.Itoa(len(pkgData)), fields["S"])
+	expectField(t, "D", "bash", fields["D"])
+}
@@ -0,0 +1,487 @@
+/*
+ * LURE - Linux User REpository
+ * Copyright (C) 2023 Elara Musayelyan
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package publish
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sassoftware/go-rpmutils"
+)
+
+// RPM dependency flags
+const (
+	rpmSenseLess    = 1 << 1
+	rpmSenseGreater = 1 << 2
+	rpmSenseEqual   = 1 << 3
+	rpmSenseRPMLib  = 1 << 24
+)
+
+// rpmVersion is the version element used throughout repodata
+type rpmVersion struct {
+	Epoch string `xml:"epoch,attr"`
+	Ver   string `xml:"ver,attr"`
+	Rel   string `xml:"rel,attr"`
+}
+
+type rpmChecksum struct {
+	Type  string `xml:"type,attr"`
+	PkgID string `xml:"pkgid,attr,omitempty"`
+	Value string `xml:",chardata"`
+}
+
+type rpmEntry struct {
+	Name  string `xml:"name,attr"`
+	Flags string `xml:"flags,attr,omitempty"`
+	Epoch string `xml:"epoch,attr,omitempty"`
+	Ver   string `xml:"ver,attr,omitempty"`
+	Rel   string `xml:"rel,attr,omitempty"`
+}
+
+type rpmEntries struct {
+	Entries []rpmEntry `xml:"rpm:entry"`
+}
+
+type rpmFile struct {
+	Type string `xml:"type,attr,omitempty"`
+	Path string `xml:",chardata"`
+}
+
+type rpmPrimary struct {
+	XMLName  xml.Name            `xml:"metadata"`
+	Xmlns    string              `xml:"xmlns,attr"`
+	XmlnsRPM string              `xml:"xmlns:rpm,attr"`
+	Count    int                 `xml:"packages,attr"`
+	Packages []rpmPrimaryPackage `xml:"package"`
+}
+
+type rpmPrimaryPackage struct {
+	Type        string      `xml:"type,attr"`
+	Name        string      `xml:"name"`
+	Arch        string      `xml:"arch"`
+	Version     rpmVersion  `xml:"version"`
+	Checksum    rpmChecksum `xml:"checksum"`
+	Summary     string      `xml:"summary"`
+	Description string      `xml:"description"`
+	Packager    string      `xml:"packager"`
+	URL         string      `xml:"url"`
+	Time        struct {
+		File  int64 `xml:"file,attr"`
+		Build int   `xml:"build,attr"`
+	} `xml:"time"`
+	Size struct {
+		Package   int64 `xml:"package,attr"`
+		Installed int64 `xml:"installed,attr"`
+		Archive   int64 `xml:"archive,attr"`
+	} `xml:"size"`
+	Location struct {
+		Href string `xml:"href,attr"`
+	} `xml:"location"`
+	Format rpmFormat `xml:"format"`
+}
+
+type rpmFormat struct {
+	License     string `xml:"rpm:license"`
+	Vendor      string `xml:"rpm:vendor"`
+	Group       string `xml:"rpm:group"`
+	BuildHost   string `xml:"rpm:buildhost"`
+	SourceRPM   string `xml:"rpm:sourcerpm"`
+	HeaderRange struct {
+		Start int `xml:"start,attr"`
+		End   int `xml:"end,attr"`
+	} `xml:"rpm:header-range"`
+	Provides  *rpmEntries `xml:"rpm:provides,omitempty"`
+	Requires  *rpmEntries `xml:"rpm:requires,omitempty"`
+	Conflicts *rpmEntries `xml:"rpm:conflicts,omitempty"`
+	Obsoletes *rpmEntries `xml:"rpm:obsoletes,omitempty"`
+	Files     []rpmFile   `xml:"file"`
+}
+
+type rpmFilelists struct {
+	XMLName  xml.Name          `xml:"filelists"`
+	Xmlns    string            `xml:"xmlns,attr"`
+	Count    int               `xml:"packages,attr"`
+	Packages []rpmFilesPackage `xml:"package"`
+}
+
+type rpmFilesPackage struct {
+	PkgID   string     `xml:"pkgid,attr"`
+	Name    string     `xml:"name,attr"`
+	Arch    string     `xml:"arch,attr"`
+	Version rpmVersion `xml:"version"`
+	Files   []rpmFile  `xml:"file"`
+}
+
+type rpmOther struct {
+	XMLName  xml.Name          `xml:"otherdata"`
+	Xmlns    string            `xml:"xmlns,attr"`
+	Count    int               `xml:"packages,attr"`
+	Packages []rpmFilesPackage `xml:"package"`
+}
+
+type rpmRepomd struct {
+	XMLName  xml.Name    `xml:"repomd"`
+	Xmlns    string      `xml:"xmlns,attr"`
+	XmlnsRPM string      `xml:"xmlns:rpm,attr"`
+	Revision int64       `xml:"revision"`
+	Data     []rpmRepoMD `xml:"data"`
+}
+
+type rpmRepoMD struct {
+	Type         string      `xml:"type,attr"`
+	Checksum     rpmChecksum `xml:"checksum"`
+	OpenChecksum rpmChecksum `xml:"open-checksum"`
+	Location     struct {
+		Href string `xml:"href,attr"`
+	} `xml:"location"`
+	Timestamp int64 `xml:"timestamp"`
+	Size      int   `xml:"size"`
+	OpenSize  int   `xml:"open-size"`
+}
+
+// indexRPM writes the repodata directory of the rpm repository in dir.
+// If an OpenPGP key is configured, repomd.xml is signed as repomd.xml.asc.
+func indexRPM(dir string, opts Options) error {
+	pkgs, err := listPkgs(dir, "rpm")
+	if err != nil {
+		return err
+	}
+
+	primary := rpmPrimary{
+		Xmlns:    "http://linux.duke.edu/metadata/common",
+		XmlnsRPM: "http://linux.duke.edu/metadata/rpm",
+	}
+	filelists := rpmFilelists{Xmlns: "http://linux.duke.edu/metadata/filelists"}
+	other := rpmOther{Xmlns: "http://linux.duke.edu/metadata/other"}
+
+	for _, name := range pkgs {
+		pkg, files, err := readRPM(filepath.Join(dir, name))
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+
+		primary.Packages = append(primary.Packages, pkg)
+
+		filesPkg := rpmFilesPackage{
+			PkgID:   pkg.Checksum.Value,
+			Name:    pkg.Name,
+			Arch:    pkg.Arch,
+			Version: pkg.Version,
+		}
+		other.Packages = append(other.Packages, filesPkg)
+
+		filesPkg.Files = files
+		filelists.Packages = append(filelists.Packages, filesPkg)
+	}
+
+	primary.Count = len(primary.Packages)
+	filelists.Count = len(filelists.Packages)
+	other.Count = len(other.Packages)
+
+	repodata := filepath.Join(dir, "repodata")
+	err = os.MkdirAll(repodata, 0o755)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().Unix()
+	repomd := rpmRepomd{
+		Xmlns:    "http://linux.duke.edu/metadata/repo",
+		XmlnsRPM: "http://linux.duke.edu/metadata/rpm",
+		Revision: now,
+	}
+
+	metadata := []struct {
+		name string
+		doc  any
+	}{
+		{"primary", primary},
+		{"filelists", filelists},
+		{"other", other},
+	}
+
+	var keep []string
+	for _, md := range metadata {
+		data, err := encodeXML(md.doc)
+		if err != nil {
+			return err
+		}
+
+		gz, err := gzipBytes(data)
+		if err != nil {
+			return err
+		}
+
+		openHashes, err := hashReader(bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+
+		gzHashes, err := hashReader(bytes.NewReader(gz))
+		if err != nil {
+			return err
+		}
+
+		// The checksum is part of the file name, so that clients
+		// never get a repomd.xml that doesn't match the metadata
+		fileName := gzHashes.SHA256 + "-" + md.name + ".xml.gz"
+		err = writeFileAtomic(filepath.Join(repodata, fileName), func(w io.Writer) error {
+			_, err := w.Write(gz)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		keep = append(keep, fileName)
+
+		entry := rpmRepoMD{
+			Type:         md.name,
+			Checksum:     rpmChecksum{Type: "sha256", Value: gzHashes.SHA256},
+			OpenChecksum: rpmChecksum{Type: "sha256", Value: openHashes.SHA256},
+			Timestamp:    now,
+			Size:         len(gz),
+			OpenSize:     len(data),
+		}
+		entry.Location.Href = "repodata/" + fileName
+		repomd.Data = append(repomd.Data, entry)
+	}
+
+	repomdData, err := encodeXML(repomd)
+	if err != nil {
+		return err
+	}
+
+	repomdPath := filepath.Join(repodata, "repomd.xml")
+	err = writeFileAtomic(repomdPath, func(w io.Writer) error {
+		_, err := w.Write(repomdData)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	keep = append(keep, "repomd.xml")
+
+	err = writeSignature(repomdPath, repomdPath+".asc", opts.Keys, true)
+	if err != nil {
+		return err
+	}
+	keep = append(keep, "repomd.xml.asc")
+
+	// Remove metadata from previous runs
+	entries, err := os.ReadDir(repodata)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		if !slices.Contains(keep, entry.Name()) {
+			err = os.Remove(filepath.Join(repodata, entry.Name()))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// readRPM reads the header of the rpm package at path and returns
+// its entry in primary.xml, along with the list of its files
+func readRPM(path string) (rpmPrimaryPackage, []rpmFile, error) {
+	var pkg rpmPrimaryPackage
+
+	hashes, err := hashFile(path)
+	if err != nil {
+		return pkg, nil, err
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		return pkg, nil, err
+	}
+
+	fl, err := os.Open(path)
+	if err != nil {
+		return pkg, nil, err
+	}
+	defer fl.Close()
+
+	hdr, err := rpmutils.ReadHeader(fl)
+	if err != nil {
+		return pkg, nil, err
+	}
+
+	nevra, err := hdr.GetNEVRA()
+	if err != nil {
+		return pkg, nil, err
+	}
+
+	str := func(tag int) string {
+		val, _ := hdr.GetString(tag)
+		return val
+	}
+
+	pkg.Type = "rpm"
+	pkg.Name = nevra.Name
+	pkg.Arch = nevra.Arch
+	pkg.Version = rpmVersion{Epoch: nevra.Epoch, Ver: nevra.Version, Rel: nevra.Release}
+	if pkg.Version.Epoch == "" {
+		pkg.Version.Epoch = "0"
+	}
+	pkg.Checksum = rpmChecksum{Type: "sha256", PkgID: "YES", Value: hashes.SHA256}
+	pkg.Summary = str(rpmutils.SUMMARY)
+	pkg.Description = str(rpmutils.DESCRIPTION)
+	pkg.Packager = str(rpmutils.PACKAGER)
+	pkg.URL = str(rpmutils.URL)
+	pkg.Time.File = fi.ModTime().Unix()
+	pkg.Time.Build, _ = hdr.GetInt(rpmutils.BUILDTIME)
+	pkg.Size.Package = hashes.Size
+	pkg.Size.Installed, _ = hdr.InstalledSize()
+	pkg.Size.Archive, _ = hdr.PayloadSize()
+	pkg.Location.Href = filepath.Base(path)
+
+	pkg.Format.License = str(rpmutils.LICENSE)
+	pkg.Format.Vendor = str(rpmutils.VENDOR)
+	pkg.Format.Group = str(rpmutils.GROUP)
+	pkg.Format.BuildHost = str(rpmutils.BUILDHOST)
+	pkg.Format.SourceRPM = str(rpmutils.SOURCERPM)
+
+	hdrRange := hdr.GetRange()
+	pkg.Format.HeaderRange.Start = hdrRange.Start
+	pkg.Format.HeaderRange.End = hdrRange.End
+
+	pkg.Format.Provides = rpmDeps(hdr, rpmutils.PROVIDENAME, rpmutils.PROVIDEFLAGS, rpmutils.PROVIDEVERSION)
+	pkg.Format.Requires = rpmDeps(hdr, rpmutils.REQUIRENAME, rpmutils.REQUIREFLAGS, rpmutils.REQUIREVERSION)
+	pkg.Format.Conflicts = rpmDeps(hdr, rpmutils.CONFLICTNAME, rpmutils.CONFLICTFLAGS, rpmutils.CONFLICTVERSION)
+	pkg.Format.Obsoletes = rpmDeps(hdr, rpmutils.OBSOLETENAME, rpmutils.OBSOLETEFLAGS, rpmutils.OBSOLETEVERSION)
+
+	fileInfos, err := hdr.GetFiles()
+	if err != nil {
+		return pkg, nil, err
+	}
+
+	var files []rpmFile
+	for _, info := range fileInfos {
+		file := rpmFile{Path: info.Name()}
+		if info.Mode()&0o170000 == 0o040000 {
+			file.Type = "dir"
+		}
+		files = append(files, file)
+
+		// Like createrepo, only the files that are commonly depended
+		// on by path are listed in primary.xml
+		if file.Type == "" && (strings.HasPrefix(file.Path, "/etc/") || strings.Contains(file.Path, "bin/")) {
+			pkg.Format.Files = append(pkg.Format.Files, file)
+		}
+	}
+
+	return pkg, files, nil
+}
+
+// rpmDeps returns the dependency entries stored in the given tags
+// of hdr, or nil if there aren't any. Internal rpmlib dependencies
+// are skipped.
+func rpmDeps(hdr *rpmutils.RpmHeader, nameTag, flagsTag, versionTag int) *rpmEntries {
+	names, err := hdr.GetStrings(nameTag)
+	if err != nil || len(names) == 0 {
+		return nil
+	}
+	flags, _ := hdr.GetInts(flagsTag)
+	versions, _ := hdr.GetStrings(versionTag)
+
+	entries := &rpmEntries{}
+	for i, name := range names {
+		entry := rpmEntry{Name: name}
+
+		var flag int
+		if i < len(flags) {
+			flag = flags[i]
+		}
+
+		if flag&rpmSenseRPMLib != 0 || strings.HasPrefix(name, "rpmlib(") {
+			continue
+		}
+
+		switch flag & (rpmSenseLess | rpmSenseGreater | rpmSenseEqual) {
+		case rpmSenseLess:
+			entry.Flags = "LT"
+		case rpmSenseGreater:
+			entry.Flags = "GT"
+		case rpmSenseEqual:
+			entry.Flags = "EQ"
+		case rpmSenseLess | rpmSenseEqual:
+			entry.Flags = "LE"
+		case rpmSenseGreater | rpmSenseEqual:
+			entry.Flags = "GE"
+		}
+
+		if entry.Flags != "" && i < len(versions) && versions[i] != "" {
+			entry.Epoch, entry.Ver, entry.Rel = splitEVR(versions[i])
+		}
+
+		entries.Entries = append(entries.Entries, entry)
+	}
+
+	if len(entries.Entries) == 0 {
+		return nil
+	}
+	return entries
+}
+
+// splitEVR splits an rpm version in the form
+// [epoch:]version[-release] into its parts
+func splitEVR(evr string) (epoch, ver, rel string) {
+	epoch = "0"
+	if e, rest, ok := strings.Cut(evr, ":"); ok {
+		if _, err := strconv.Atoi(e); err == nil {
+			epoch, evr = e, rest
+		}
+	}
+
+	ver, rel, _ = strings.Cut(evr, "-")
+	return epoch, ver, rel
+}
+
+// encodeXML encodes doc as an indented XML document
+func encodeXML(doc any) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	buf.WriteString(xml.Header)
+
+	enc := xml.NewEncoder(buf)
+	enc.Indent("", "  ")
+	err := enc.Encode(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
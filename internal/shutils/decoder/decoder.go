@@ -61,11 +61,13 @@ type Decoder struct {
 	Overrides bool
 	// Enable using like distros for overrides
 	LikeDistros bool
+	// CPU architecture to use for overrides (cpu.Arch() if empty)
+	Arch string
 }
 
 // New creates a new variable decoder
 func New(info *distro.OSRelease, runner *interp.Runner) *Decoder {
-	return &Decoder{info, runner, true, len(info.Like) > 0}
+	return &Decoder{info, runner, true, len(info.Like) > 0, ""}
 }
 
 // DecodeVar decodes a variable to val using reflection.
@@ -181,25 +183,34 @@ func (d *Decoder) GetFunc(name string) (ScriptFunc, bool) {
 	}, true
 }
 
-func (d *Decoder) getFunc(name string) *syntax.Stmt {
-	names, err := overrides.Resolve(d.info, overrides.DefaultOpts.WithName(name))
+// FuncName returns the name of the bash function that would be
+// used for the given name once overrides have been resolved
+func (d *Decoder) FuncName(name string) (string, bool) {
+	names, err := overrides.Resolve(d.info, overrides.DefaultOpts.WithName(name).WithArch(d.Arch))
 	if err != nil {
-		return nil
+		return "", false
 	}
 
 	for _, fnName := range names {
-		fn, ok := d.Runner.Funcs[fnName]
-		if ok {
-			return fn
+		if _, ok := d.Runner.Funcs[fnName]; ok {
+			return fnName, true
 		}
 	}
-	return nil
+	return "", false
+}
+
+func (d *Decoder) getFunc(name string) *syntax.Stmt {
+	fnName, ok := d.FuncName(name)
+	if !ok {
+		return nil
+	}
+	return d.Runner.Funcs[fnName]
 }
 
 // getVar gets a variable based on its name, taking into account
 // override variables and nameref variables.
 func (d *Decoder) getVar(name string) *expand.Variable {
-	names, err := overrides.Resolve(d.info, overrides.DefaultOpts.WithName(name))
+	names, err := overrides.Resolve(d.info, overrides.DefaultOpts.WithName(name).WithArch(d.Arch))
 	if err != nil {
 		return nil
 	}
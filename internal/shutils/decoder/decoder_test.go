@@ -222,3 +222,44 @@ func TestGetFunc(t *testing.T) {
 		t.Fatalf(`Expected "Test\n", got %#v`, buf.String())
 	}
 }
+
+func TestFuncName(t *testing.T) {
+	ctx := context.Background()
+
+	const script = `
+		package() { true; }
+		package_arch() { true; }
+	`
+
+	fl, err := syntax.NewParser().Parse(strings.NewReader(script), "lure.sh")
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	runner, err := interp.New()
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	err = runner.Run(ctx, fl)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	dec := decoder.New(osRelease, runner)
+	name, ok := dec.FuncName("package")
+	if !ok || name != "package_arch" {
+		t.Errorf(`Expected "package_arch", got %#v`, name)
+	}
+
+	dec = decoder.New(&distro.OSRelease{ID: "debian"}, runner)
+	name, ok = dec.FuncName("package")
+	if !ok || name != "package" {
+		t.Errorf(`Expected "package", got %#v`, name)
+	}
+
+	_, ok = dec.FuncName("build")
+	if ok {
+		t.Errorf("Expected build() function not to exist")
+	}
+}
@@ -26,11 +26,11 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
-	"unsafe"
 
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing/object"
 	"golang.org/x/exp/slices"
+	"github.com/sintan1729/lure/internal/cpu"
 	"github.com/sintan1729/lure/internal/shutils/handlers"
 	"mvdan.cc/sh/v3/interp"
 )
@@ -201,13 +201,13 @@ func getLibPrefix(hc interp.HandlerContext) string {
 		}
 	}
 
-	wordSize := unsafe.Sizeof(uintptr(0))
-	if wordSize == 8 {
+	// ARCH is the architecture the package is being built
+	// for, which may differ from the one LURE is running on
+	architecture := hc.Env.Get("ARCH").Str
+	if cpu.Is64Bit(architecture) {
 		out = "/usr/lib64"
 	}
 
-	architecture := hc.Env.Get("ARCH").Str
-
 	if distroID == "debian" || slices.Contains(distroLike, "debian") ||
 		distroID == "ubuntu" || slices.Contains(distroLike, "ubuntu") {
 
@@ -0,0 +1,70 @@
+/*
+ * LURE - Linux User REpository
+ * Copyright (C) 2023 Elara Musayelyan
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package signing
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/sintan1729/lure/internal/types"
+)
+
+// Keys contains a signing configuration with its
+// paths expanded and its passphrase read
+type Keys struct {
+	KeyFile    string
+	KeyID      string
+	APKKeyFile string
+	APKKeyName string
+	Passphrase string
+}
+
+// Load resolves the signing configuration in cfg, reading the
+// passphrase from its source. It returns nil if no keys are configured.
+func Load(cfg types.Signing) (*Keys, error) {
+	if cfg.KeyFile == "" && cfg.APKKeyFile == "" {
+		return nil, nil
+	}
+
+	passphrase, err := Passphrase(cfg.Passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := &Keys{
+		KeyFile:    ExpandPath(cfg.KeyFile),
+		KeyID:      cfg.KeyID,
+		APKKeyFile: ExpandPath(cfg.APKKeyFile),
+		APKKeyName: cfg.APKKeyName,
+		Passphrase: passphrase,
+	}
+
+	if keys.APKKeyName == "" && keys.APKKeyFile != "" {
+		keys.APKKeyName = APKKeyName(keys.APKKeyFile)
+	}
+
+	return keys, nil
+}
+
+// APKKeyName returns the default key name for the apk key at keyFile,
+// which is its file name without the extension
+func APKKeyName(keyFile string) string {
+	name := filepath.Base(keyFile)
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
@@ -0,0 +1,335 @@
+/*
+ * LURE - Linux User REpository
+ * Copyright (C) 2023 Elara Musayelyan
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+// Package signing manages the keys that are used to sign built packages.
+// Deb, rpm and Arch Linux packages are signed with an OpenPGP key, and apk
+// packages are signed with an RSA key in PEM format.
+package signing
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/clearsign"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+var (
+	ErrInvalidPassphraseSource = errors.New("signing: invalid passphrase source")
+	ErrNoSigningKey            = errors.New("signing: no signing key found")
+	ErrUnsupportedKey          = errors.New("signing: unsupported key type")
+)
+
+// keyBits is the size of generated RSA keys
+const keyBits = 4096
+
+// Generate generates a new RSA key for signing packages. It returns the key
+// as an armored OpenPGP secret key, which is used for deb, rpm and Arch Linux
+// packages, and as a PEM-encoded RSA secret key, which is used for apk
+// packages. If passphrase isn't empty, both are encrypted with it.
+func Generate(name, email, passphrase string) (pgpKey, rsaKey []byte, err error) {
+	cfg := &packet.Config{
+		Algorithm: packet.PubKeyAlgoRSA,
+		RSABits:   keyBits,
+	}
+
+	entity, err := openpgp.NewEntity(name, "", email, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	priv, ok := entity.PrivateKey.PrivateKey.(*rsa.PrivateKey)
+	if !ok {
+		return nil, nil, ErrUnsupportedKey
+	}
+
+	block := &pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(priv),
+	}
+
+	if passphrase != "" {
+		// nfpm only supports the legacy PEM encryption for apk keys
+		block, err = x509.EncryptPEMBlock(rand.Reader, block.Type, block.Bytes, []byte(passphrase), x509.PEMCipherAES256) //nolint:staticcheck
+		if err != nil {
+			return nil, nil, err
+		}
+
+		err = entity.EncryptPrivateKeys([]byte(passphrase), cfg)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	w, err := armor.Encode(buf, openpgp.PrivateKeyType, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = entity.SerializePrivateWithoutSigning(w, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = w.Close()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return buf.Bytes(), pem.EncodeToMemory(block), nil
+}
+
+// ReadPGPKey reads the OpenPGP key in keyFile, which may be armored, and
+// decrypts its private keys with passphrase if they're encrypted.
+func ReadPGPKey(keyFile, passphrase string) (*openpgp.Entity, error) {
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var keyring openpgp.EntityList
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("-----BEGIN")) {
+		keyring, err = openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+	} else {
+		keyring, err = openpgp.ReadKeyRing(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(keyring) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNoSigningKey, keyFile)
+	}
+	entity := keyring[0]
+
+	if entity.PrivateKey != nil && entity.PrivateKey.Encrypted {
+		err = entity.DecryptPrivateKeys([]byte(passphrase))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return entity, nil
+}
+
+// PGPPublicKey returns the armored OpenPGP public key
+// of the secret key in keyFile
+func PGPPublicKey(keyFile, passphrase string) ([]byte, error) {
+	entity, err := ReadPGPKey(keyFile, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	w, err := armor.Encode(buf, openpgp.PublicKeyType, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	err = entity.Serialize(w)
+	if err != nil {
+		return nil, err
+	}
+
+	err = w.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// RSAPublicKey returns the PEM-encoded public key of the RSA secret key
+// in keyFile, which is the format apk expects in /etc/apk/keys.
+func RSAPublicKey(keyFile, passphrase string) ([]byte, error) {
+	priv, err := readRSAKey(keyFile, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	pubDER, err := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}), nil
+}
+
+// SignRSA signs the SHA1 hash of data with the RSA secret key in keyFile,
+// the way apk signs packages and indexes
+func SignRSA(data []byte, keyFile, passphrase string) ([]byte, error) {
+	priv, err := readRSAKey(keyFile, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha1.Sum(data)
+	return rsa.SignPKCS1v15(rand.Reader, priv, crypto.SHA1, sum[:])
+}
+
+// readRSAKey reads the PEM-encoded RSA secret key in keyFile,
+// decrypting it with passphrase if it's encrypted
+func readRSAKey(keyFile, passphrase string) (*rsa.PrivateKey, error) {
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%w: %s is not a PEM file", ErrUnsupportedKey, keyFile)
+	}
+
+	der := block.Bytes
+	if x509.IsEncryptedPEMBlock(block) { //nolint:staticcheck
+		der, err = x509.DecryptPEMBlock(block, []byte(passphrase)) //nolint:staticcheck
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(der)
+	case "PRIVATE KEY":
+		priv, err := x509.ParsePKCS8PrivateKey(der)
+		if err != nil {
+			return nil, err
+		}
+		rsaPriv, ok := priv.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("%w: %T", ErrUnsupportedKey, priv)
+		}
+		return rsaPriv, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedKey, block.Type)
+	}
+}
+
+// DetachSign writes a binary detached OpenPGP signature of the data
+// in r to w, using the key in keyFile. This is the format pacman
+// expects in the .sig file next to a package.
+func DetachSign(w io.Writer, r io.Reader, keyFile, passphrase string) error {
+	entity, err := ReadPGPKey(keyFile, passphrase)
+	if err != nil {
+		return err
+	}
+	return openpgp.DetachSign(w, entity, r, nil)
+}
+
+// ArmoredDetachSign is like DetachSign, but the signature is armored,
+// which is the format used for repository metadata such as Release.gpg
+func ArmoredDetachSign(w io.Writer, r io.Reader, keyFile, passphrase string) error {
+	entity, err := ReadPGPKey(keyFile, passphrase)
+	if err != nil {
+		return err
+	}
+	return openpgp.ArmoredDetachSign(w, entity, r, nil)
+}
+
+// ClearSign writes data to w with an inline cleartext signature,
+// which is the format APT expects for InRelease files
+func ClearSign(w io.Writer, data []byte, keyFile, passphrase string) error {
+	entity, err := ReadPGPKey(keyFile, passphrase)
+	if err != nil {
+		return err
+	}
+
+	cw, err := clearsign.Encode(w, entity.PrivateKey, nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = cw.Write(data)
+	if err != nil {
+		return err
+	}
+
+	return cw.Close()
+}
+
+// Passphrase reads the passphrase for the signing keys from source,
+// which is either empty, for keys without a passphrase, "env:NAME" to
+// read it from an environment variable, "file:PATH" to read it from
+// a file, or "cmd:COMMAND" to read it from the output of a command,
+// such as a password manager. Trailing newlines are removed.
+func Passphrase(source string) (string, error) {
+	if source == "" {
+		return "", nil
+	}
+
+	kind, value, ok := strings.Cut(source, ":")
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrInvalidPassphraseSource, source)
+	}
+
+	switch kind {
+	case "env":
+		passphrase, ok := os.LookupEnv(value)
+		if !ok {
+			return "", fmt.Errorf("%w: environment variable %s is not set", ErrInvalidPassphraseSource, value)
+		}
+		return passphrase, nil
+	case "file":
+		data, err := os.ReadFile(ExpandPath(value))
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	case "cmd":
+		cmd := exec.Command("sh", "-c", value)
+		// Password managers may need to ask the user to unlock them
+		cmd.Stdin = os.Stdin
+		cmd.Stderr = os.Stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return "", fmt.Errorf("passphrase command: %w", err)
+		}
+		return strings.TrimRight(string(out), "\r\n"), nil
+	default:
+		return "", fmt.Errorf("%w: %s", ErrInvalidPassphraseSource, source)
+	}
+}
+
+// ExpandPath expands environment variables and
+// a leading ~ in a path from the config file
+func ExpandPath(path string) string {
+	path = os.ExpandEnv(path)
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		home, err := os.UserHomeDir()
+		if err == nil {
+			path = filepath.Join(home, path[1:])
+		}
+	}
+	return path
+}
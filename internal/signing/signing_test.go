@@ -0,0 +1,303 @@
+/*
+ * LURE - Linux User REpository
+ * Copyright (C) 2023 Elara Musayelyan
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package signing
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/clearsign"
+)
+
+// writeTestKeys generates keys encrypted with passphrase
+// and writes them to a temporary directory
+func writeTestKeys(t *testing.T, passphrase string) (pgpFile, rsaFile string) {
+	t.Helper()
+
+	pgpKey, rsaKey, err := Generate("Test", "test@example.com", passphrase)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	dir := t.TempDir()
+	pgpFile = filepath.Join(dir, "key.asc")
+	rsaFile = filepath.Join(dir, "key.rsa")
+
+	err = os.WriteFile(pgpFile, pgpKey, 0o600)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	err = os.WriteFile(rsaFile, rsaKey, 0o600)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	return pgpFile, rsaFile
+}
+
+func TestGenerate(t *testing.T) {
+	pgpFile, rsaFile := writeTestKeys(t, "")
+
+	entity, err := ReadPGPKey(pgpFile, "")
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	if _, ok := entity.Identities["Test <test@example.com>"]; !ok {
+		t.Errorf("Expected the key to have the given identity, got %v", entity.Identities)
+	}
+
+	priv, err := readRSAKey(rsaFile, "")
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	// Both files contain the same key, so the same
+	// key ID is used for every package format
+	pgpPriv, ok := entity.PrivateKey.PrivateKey.(*rsa.PrivateKey)
+	if !ok {
+		t.Fatalf("Expected an RSA key, got %T", entity.PrivateKey.PrivateKey)
+	}
+
+	if !pgpPriv.PublicKey.Equal(&priv.PublicKey) {
+		t.Error("Expected the OpenPGP and RSA keys to be the same key")
+	}
+}
+
+func TestGenerateWithPassphrase(t *testing.T) {
+	const passphrase = "secret"
+	pgpFile, rsaFile := writeTestKeys(t, passphrase)
+
+	data, err := os.ReadFile(rsaFile)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil || !x509.IsEncryptedPEMBlock(block) { //nolint:staticcheck
+		t.Error("Expected the RSA key to be encrypted")
+	}
+
+	entity, err := ReadPGPKey(pgpFile, passphrase)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	if entity.PrivateKey.Encrypted {
+		t.Error("Expected the OpenPGP key to be decrypted")
+	}
+
+	_, err = readRSAKey(rsaFile, passphrase)
+	if err != nil {
+		t.Errorf("Expected no error, got %s", err)
+	}
+
+	_, err = ReadPGPKey(pgpFile, "wrong")
+	if err == nil {
+		t.Error("Expected an error for the wrong OpenPGP passphrase")
+	}
+
+	_, err = readRSAKey(rsaFile, "wrong")
+	if err == nil {
+		t.Error("Expected an error for the wrong RSA passphrase")
+	}
+}
+
+func TestSign(t *testing.T) {
+	pgpFile, rsaFile := writeTestKeys(t, "")
+	data := []byte("hello\n")
+
+	entity, err := ReadPGPKey(pgpFile, "")
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	keyring := openpgp.EntityList{entity}
+
+	sig := &bytes.Buffer{}
+	err = DetachSign(sig, bytes.NewReader(data), pgpFile, "")
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	_, err = openpgp.CheckDetachedSignature(keyring, bytes.NewReader(data), sig, nil)
+	if err != nil {
+		t.Errorf("Expected a valid detached signature, got %s", err)
+	}
+
+	sig.Reset()
+	err = ArmoredDetachSign(sig, bytes.NewReader(data), pgpFile, "")
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	_, err = openpgp.CheckArmoredDetachedSignature(keyring, bytes.NewReader(data), sig, nil)
+	if err != nil {
+		t.Errorf("Expected a valid armored signature, got %s", err)
+	}
+
+	signed := &bytes.Buffer{}
+	err = ClearSign(signed, data, pgpFile, "")
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	block, _ := clearsign.Decode(signed.Bytes())
+	if block == nil {
+		t.Fatal("Expected a cleartext signed message")
+	}
+
+	if !bytes.Equal(block.Plaintext, data) {
+		t.Errorf("Expected %q to be signed, got %q", data, block.Plaintext)
+	}
+
+	_, err = block.VerifySignature(keyring, nil)
+	if err != nil {
+		t.Errorf("Expected a valid cleartext signature, got %s", err)
+	}
+
+	rsaSig, err := SignRSA(data, rsaFile, "")
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	pubPEM, err := RSAPublicKey(rsaFile, "")
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	pubBlock, _ := pem.Decode(pubPEM)
+	pub, err := x509.ParsePKIXPublicKey(pubBlock.Bytes)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	sum := sha1.Sum(data)
+	err = rsa.VerifyPKCS1v15(pub.(*rsa.PublicKey), crypto.SHA1, sum[:], rsaSig)
+	if err != nil {
+		t.Errorf("Expected a valid RSA signature, got %s", err)
+	}
+}
+
+func TestReadRSAKeyFormats(t *testing.T) {
+	_, rsaFile := writeTestKeys(t, "")
+	priv, err := readRSAKey(rsaFile, "")
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	dir := t.TempDir()
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		err := os.WriteFile(path, data, 0o600)
+		if err != nil {
+			t.Fatalf("Expected no error, got %s", err)
+		}
+		return path
+	}
+
+	pkcs8File := write("pkcs8.pem", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}))
+	pkcs8Priv, err := readRSAKey(pkcs8File, "")
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	if !priv.Equal(pkcs8Priv) {
+		t.Error("Expected the PKCS #8 key to be the same key")
+	}
+
+	invalid := map[string][]byte{
+		"not-pem":    []byte("not a key"),
+		"other.pem":  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: []byte{0}}),
+		"public.pem": pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: []byte{0}}),
+	}
+	for name, data := range invalid {
+		_, err = readRSAKey(write(name, data), "")
+		if !errors.Is(err, ErrUnsupportedKey) {
+			t.Errorf("Expected %s for %s, got %v", ErrUnsupportedKey, name, err)
+		}
+	}
+}
+
+func TestPassphrase(t *testing.T) {
+	t.Setenv("LURE_TEST_PASSPHRASE", "from env")
+
+	dir := t.TempDir()
+	passFile := filepath.Join(dir, "pass")
+	err := os.WriteFile(passFile, []byte("from file\r\n"), 0o600)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	tests := map[string]string{
+		"":                          "",
+		"env:LURE_TEST_PASSPHRASE":  "from env",
+		"file:" + passFile:          "from file",
+		"cmd:echo 'from command'":   "from command",
+		"cmd:printf 'a:b\\n\\n'":    "a:b",
+		"file:$LURE_TEST_PASS_FILE": "from file",
+	}
+	t.Setenv("LURE_TEST_PASS_FILE", passFile)
+
+	for source, expected := range tests {
+		passphrase, err := Passphrase(source)
+		if err != nil {
+			t.Errorf("Expected no error for %q, got %s", source, err)
+			continue
+		}
+
+		if passphrase != expected {
+			t.Errorf("Expected %q for %q, got %q", expected, source, passphrase)
+		}
+	}
+
+	invalid := map[string]error{
+		"secret":                   ErrInvalidPassphraseSource,
+		"pass:secret":              ErrInvalidPassphraseSource,
+		"env:LURE_TEST_UNSET_VAR":  ErrInvalidPassphraseSource,
+		"file:" + dir + "/missing": fs.ErrNotExist,
+	}
+	for source, expected := range invalid {
+		_, err := Passphrase(source)
+		if !errors.Is(err, expected) {
+			t.Errorf("Expected %s for %q, got %v", expected, source, err)
+		}
+	}
+
+	_, err = Passphrase("cmd:exit 1")
+	if err == nil || !strings.Contains(err.Error(), "passphrase command") {
+		t.Errorf("Expected an error from the passphrase command, got %v", err)
+	}
+}
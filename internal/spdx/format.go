@@ -0,0 +1,154 @@
+/*
+ * LURE - Linux User REpository
+ * Copyright (C) 2023 Elara Musayelyan
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package spdx
+
+import (
+	"regexp"
+	"strings"
+)
+
+// style controls how an expression is written out
+type style struct {
+	and, or, with string
+	license       func(e *Expression) string
+	exception     func(id string) string
+}
+
+var canonicalStyle = style{
+	and:  "AND",
+	or:   "OR",
+	with: "WITH",
+	license: func(e *Expression) string {
+		if e.OrLater {
+			return e.License + "+"
+		}
+		return e.License
+	},
+	exception: func(id string) string { return id },
+}
+
+// archStyle uses SPDX identifiers, which Arch Linux has adopted, but
+// writes licenses that aren't in the SPDX list as custom:name
+var archStyle = style{
+	and:  "AND",
+	or:   "OR",
+	with: "WITH",
+	license: func(e *Expression) string {
+		if e.License == Custom {
+			return "custom"
+		}
+		if _, ref, ok := strings.Cut(e.License, "LicenseRef-"); ok {
+			return "custom:" + ref
+		}
+		return canonicalStyle.license(e)
+	},
+	exception: canonicalStyle.exception,
+}
+
+// debRegex matches the GNU licenses, which have different
+// short names in Debian copyright files
+var debRegex = regexp.MustCompile(`^(A?GPL|LGPL|GFDL)-(\d)\.(\d)(-only|-or-later)?$`)
+
+// debStyle uses the short names from the Debian machine-readable
+// copyright format, such as GPL-2+ and Expat
+var debStyle = style{
+	and:  "and",
+	or:   "or",
+	with: "with",
+	license: func(e *Expression) string {
+		if e.License == "MIT" {
+			return "Expat"
+		}
+		if _, ref, ok := strings.Cut(e.License, "LicenseRef-"); ok {
+			return ref
+		}
+
+		match := debRegex.FindStringSubmatch(e.License)
+		if match == nil {
+			return canonicalStyle.license(e)
+		}
+
+		out := match[1] + "-" + match[2]
+		if match[3] != "0" {
+			out += "." + match[3]
+		}
+		if e.OrLater || match[4] == "-or-later" {
+			out += "+"
+		}
+		return out
+	},
+	exception: func(id string) string { return id + " exception" },
+}
+
+// spdxStyle is used for formats that expect valid SPDX expressions,
+// so Custom is written as a LicenseRef- reference
+var spdxStyle = style{
+	and:  "AND",
+	or:   "OR",
+	with: "WITH",
+	license: func(e *Expression) string {
+		if e.License == Custom {
+			return "LicenseRef-" + Custom
+		}
+		return canonicalStyle.license(e)
+	},
+	exception: canonicalStyle.exception,
+}
+
+// ForFormat returns the expression using the license conventions of
+// the given package format. Arch Linux packages use custom:name for
+// licenses that aren't in the SPDX list, Debian packages use the
+// short names from the Debian copyright format, and other formats
+// use SPDX expressions with LicenseRef- references.
+func (e *Expression) ForFormat(format string) string {
+	switch format {
+	case "archlinux":
+		return e.format(archStyle)
+	case "deb":
+		return e.format(debStyle)
+	default:
+		return e.format(spdxStyle)
+	}
+}
+
+func (e *Expression) format(s style) string {
+	if e.Op == "" {
+		out := s.license(e)
+		if e.Exception != "" {
+			out += " " + s.with + " " + s.exception(e.Exception)
+		}
+		return out
+	}
+
+	op := s.and
+	if e.Op == "OR" {
+		op = s.or
+	}
+
+	return e.Left.formatOperand(e.Op, s) + " " + op + " " + e.Right.formatOperand(e.Op, s)
+}
+
+// formatOperand formats an operand of an expression using parentOp,
+// adding parentheses if it binds less tightly than its parent
+func (e *Expression) formatOperand(parentOp string, s style) string {
+	if parentOp == "AND" && e.Op == "OR" {
+		return "(" + e.format(s) + ")"
+	}
+	return e.format(s)
+}
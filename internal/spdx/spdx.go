@@ -0,0 +1,321 @@
+/*
+ * LURE - Linux User REpository
+ * Copyright (C) 2023 Elara Musayelyan
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+// Package spdx validates and normalizes SPDX license expressions,
+// such as "MIT OR Apache-2.0", using an embedded copy of the SPDX
+// license list.
+package spdx
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+//go:embed licenses.txt
+var licensesList string
+
+//go:embed deprecated.txt
+var deprecatedList string
+
+//go:embed exceptions.txt
+var exceptionsList string
+
+var (
+	// licenses maps the lowercase version of each license identifier
+	// to its canonical form, since SPDX identifiers are case-insensitive
+	licenses   = parseList(licensesList, deprecatedList)
+	deprecated = parseList(deprecatedList)
+	exceptions = parseList(exceptionsList)
+)
+
+// Custom is the identifier build scripts use for licenses that
+// aren't in the SPDX license list
+const Custom = "Custom"
+
+var (
+	ErrInvalidExpression = errors.New("spdx: invalid license expression")
+	ErrUnknownLicense    = errors.New("spdx: unknown license identifier")
+	ErrUnknownException  = errors.New("spdx: unknown license exception")
+)
+
+// licenseRefRegex matches user-defined license references
+var licenseRefRegex = regexp.MustCompile(`^(DocumentRef-[A-Za-z0-9.-]+:)?LicenseRef-[A-Za-z0-9.-]+$`)
+
+// Expression is a parsed SPDX license expression
+type Expression struct {
+	// Op is AND or OR for compound expressions,
+	// and empty for a single license
+	Op          string
+	Left, Right *Expression
+
+	// License is the canonical identifier of a single license
+	License string
+	// OrLater is set if the license was followed by "+"
+	OrLater bool
+	// Exception is the canonical identifier of the
+	// exception in a "WITH" expression, if any
+	Exception string
+}
+
+// Parse parses and validates an SPDX license expression. License and
+// exception identifiers are matched case-insensitively and converted to
+// their canonical form. Custom is accepted as a license identifier,
+// along with LicenseRef- references.
+func Parse(expr string) (*Expression, error) {
+	p := &parser{tokens: tokenize(expr)}
+	if len(p.tokens) == 0 {
+		return nil, fmt.Errorf("%w: empty expression", ErrInvalidExpression)
+	}
+
+	out, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.pos != len(p.tokens) {
+		return nil, fmt.Errorf("%w: unexpected %q", ErrInvalidExpression, p.tokens[p.pos])
+	}
+
+	return out, nil
+}
+
+// ParseList parses each of the expressions in a build script's license
+// array and combines them with AND, since all of them apply to the
+// package. It returns nil if the list is empty.
+func ParseList(list []string) (*Expression, error) {
+	var out *Expression
+	for _, item := range list {
+		expr, err := Parse(item)
+		if err != nil {
+			return nil, err
+		}
+
+		if out == nil {
+			out = expr
+		} else {
+			out = &Expression{Op: "AND", Left: out, Right: expr}
+		}
+	}
+	return out, nil
+}
+
+// Normalize parses the license array of a build script and returns
+// its canonical SPDX expression, or an empty string if it's empty.
+func Normalize(list []string) (string, error) {
+	expr, err := ParseList(list)
+	if err != nil || expr == nil {
+		return "", err
+	}
+	return expr.String(), nil
+}
+
+// String returns the canonical form of the expression
+func (e *Expression) String() string {
+	return e.format(canonicalStyle)
+}
+
+// Licenses returns the license identifiers used in the expression,
+// in the order they first appear and without any "+" suffixes.
+func (e *Expression) Licenses() []string {
+	var out []string
+	e.walk(func(leaf *Expression) {
+		for _, license := range out {
+			if license == leaf.License {
+				return
+			}
+		}
+		out = append(out, leaf.License)
+	})
+	return out
+}
+
+// Deprecated returns the deprecated license identifiers used in the
+// expression, such as GPL-2.0, which should be replaced with
+// GPL-2.0-only or GPL-2.0-or-later.
+func (e *Expression) Deprecated() []string {
+	var out []string
+	for _, license := range e.Licenses() {
+		if _, ok := deprecated[strings.ToLower(license)]; ok {
+			out = append(out, license)
+		}
+	}
+	return out
+}
+
+// Contains checks whether the expression uses the given license
+// identifier. The identifier is matched case-insensitively.
+func (e *Expression) Contains(license string) bool {
+	for _, l := range e.Licenses() {
+		if strings.EqualFold(l, license) {
+			return true
+		}
+	}
+	return false
+}
+
+// walk calls fn for every single license in the expression
+func (e *Expression) walk(fn func(*Expression)) {
+	if e.Op == "" {
+		fn(e)
+		return
+	}
+	e.Left.walk(fn)
+	e.Right.walk(fn)
+}
+
+// parser is a recursive descent parser for SPDX license expressions.
+// AND binds more tightly than OR, and WITH more tightly than both.
+type parser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *parser) peek() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() string {
+	tok := p.peek()
+	p.pos++
+	return tok
+}
+
+func (p *parser) parseOr() (*Expression, error) {
+	return p.parseBinary("OR", p.parseAnd)
+}
+
+func (p *parser) parseAnd() (*Expression, error) {
+	return p.parseBinary("AND", p.parseWith)
+}
+
+func (p *parser) parseBinary(op string, operand func() (*Expression, error)) (*Expression, error) {
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+
+	for isOperator(p.peek(), op) {
+		p.next()
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		left = &Expression{Op: op, Left: left, Right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseWith() (*Expression, error) {
+	if p.peek() == "(" {
+		p.next()
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("%w: missing closing parenthesis", ErrInvalidExpression)
+		}
+		return expr, nil
+	}
+
+	expr, err := p.parseLicense()
+	if err != nil {
+		return nil, err
+	}
+
+	if isOperator(p.peek(), "WITH") {
+		p.next()
+		tok := p.next()
+		exception, ok := exceptions[strings.ToLower(tok)]
+		if !ok {
+			if tok == "" || tok == "(" || tok == ")" {
+				return nil, fmt.Errorf("%w: expected an exception after WITH", ErrInvalidExpression)
+			}
+			return nil, fmt.Errorf("%w: %q", ErrUnknownException, tok)
+		}
+		expr.Exception = exception
+	}
+
+	return expr, nil
+}
+
+func (p *parser) parseLicense() (*Expression, error) {
+	tok := p.next()
+	switch {
+	case tok == "":
+		return nil, fmt.Errorf("%w: unexpected end of expression", ErrInvalidExpression)
+	case tok == "(" || tok == ")" || isOperator(tok, "AND") || isOperator(tok, "OR") || isOperator(tok, "WITH"):
+		return nil, fmt.Errorf("%w: expected a license, got %q", ErrInvalidExpression, tok)
+	}
+
+	expr := &Expression{}
+	if strings.HasSuffix(tok, "+") {
+		expr.OrLater = true
+		tok = strings.TrimSuffix(tok, "+")
+	}
+
+	switch {
+	case strings.EqualFold(tok, Custom):
+		expr.License = Custom
+	case licenseRefRegex.MatchString(tok):
+		expr.License = tok
+	default:
+		license, ok := licenses[strings.ToLower(tok)]
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownLicense, tok)
+		}
+		expr.License = license
+	}
+
+	return expr, nil
+}
+
+// isOperator checks whether tok is the operator op. SPDX
+// operators may be written in either upper or lower case.
+func isOperator(tok, op string) bool {
+	return tok == op || tok == strings.ToLower(op)
+}
+
+// tokenize splits an expression into parentheses and words
+func tokenize(expr string) []string {
+	expr = strings.NewReplacer("(", " ( ", ")", " ) ").Replace(expr)
+	return strings.Fields(expr)
+}
+
+// parseList parses the embedded identifier lists, which contain
+// one identifier per line and comments starting with #
+func parseList(lists ...string) map[string]string {
+	out := map[string]string{}
+	for _, list := range lists {
+		for _, line := range strings.Split(list, "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			out[strings.ToLower(line)] = line
+		}
+	}
+	return out
+}
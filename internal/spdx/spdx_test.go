@@ -0,0 +1,95 @@
+/*
+ * LURE - Linux User REpository
+ * Copyright (C) 2023 Elara Musayelyan
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package spdx_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/sintan1729/lure/internal/spdx"
+)
+
+func TestParse(t *testing.T) {
+	tests := map[string]string{
+		"MIT":                                   "MIT",
+		"mit or apache-2.0":                     "MIT OR Apache-2.0",
+		"(MIT OR Apache-2.0) AND BSD-3-Clause":  "(MIT OR Apache-2.0) AND BSD-3-Clause",
+		"MIT OR Apache-2.0 AND BSD-3-Clause":    "MIT OR Apache-2.0 AND BSD-3-Clause",
+		"((MIT))":                               "MIT",
+		"GPL-2.0+ WITH classpath-exception-2.0": "GPL-2.0+ WITH Classpath-exception-2.0",
+		"custom":                                "Custom",
+		"LicenseRef-Foo AND GPL-3.0-or-later":   "LicenseRef-Foo AND GPL-3.0-or-later",
+	}
+
+	for in, expected := range tests {
+		expr, err := spdx.Parse(in)
+		if err != nil {
+			t.Errorf("Expected no error for %q, got %s", in, err)
+			continue
+		}
+
+		if expr.String() != expected {
+			t.Errorf("Expected %q for %q, got %q", expected, in, expr.String())
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := map[string]error{
+		"":                       spdx.ErrInvalidExpression,
+		"MIT OR":                 spdx.ErrInvalidExpression,
+		"(MIT":                   spdx.ErrInvalidExpression,
+		"MIT Apache-2.0":         spdx.ErrInvalidExpression,
+		"MIT, Apache-2.0":        spdx.ErrUnknownLicense,
+		"GPLv3":                  spdx.ErrUnknownLicense,
+		"GPL-2.0-only WITH Nope": spdx.ErrUnknownException,
+	}
+
+	for in, expected := range tests {
+		_, err := spdx.Parse(in)
+		if !errors.Is(err, expected) {
+			t.Errorf("Expected %s for %q, got %v", expected, in, err)
+		}
+	}
+}
+
+func TestForFormat(t *testing.T) {
+	expr, err := spdx.ParseList([]string{"MIT OR GPL-2.0-or-later", "LicenseRef-Foo", "Custom"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	tests := map[string]string{
+		"archlinux": "(MIT OR GPL-2.0-or-later) AND custom:Foo AND custom",
+		"deb":       "(Expat or GPL-2+) and Foo and Custom",
+		"rpm":       "(MIT OR GPL-2.0-or-later) AND LicenseRef-Foo AND LicenseRef-Custom",
+	}
+
+	for format, expected := range tests {
+		if out := expr.ForFormat(format); out != expected {
+			t.Errorf("Expected %q for %s, got %q", expected, format, out)
+		}
+	}
+
+	expected := []string{"MIT", "GPL-2.0-or-later", "LicenseRef-Foo", "Custom"}
+	if !reflect.DeepEqual(expr.Licenses(), expected) {
+		t.Errorf("Expected %v, got %v", expected, expr.Licenses())
+	}
+}
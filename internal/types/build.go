@@ -25,6 +25,48 @@ type BuildOpts struct {
 	Manager     manager.Manager
 	Clean       bool
 	Interactive bool
+	// SBOM is the format of the software bill of materials
+	// written next to each built package, either "cyclonedx"
+	// or "spdx". If it's empty, the sbom setting from the
+	// config is used, and no SBOM is written if that's empty too.
+	SBOM string
+	// Formats contains the package formats to build, such as
+	// "deb" or "rpm". Each one may be followed by a colon and
+	// the ID of the distro whose overrides should be used for
+	// it, such as "rpm:opensuse-leap", and optionally another
+	// colon and the distro's version or codename, such as
+	// "deb:ubuntu:22.04". If it's empty, only the format of
+	// Manager (or LURE_PKG_FORMAT) is built.
+	Formats []string
+	// TargetArch is the CPU architecture the package is built
+	// for. If it's empty, the default from cpu.Arch() is used.
+	TargetArch string
+	// AsDeps records the packages that are installed as
+	// dependencies of another package, rather than as
+	// packages the user asked for.
+	AsDeps bool
+}
+
+// FetchOpts contains the options for downloading
+// the sources of build scripts without building them
+type FetchOpts struct {
+	Scripts []string
+	// Destination is the directory the sources should
+	// be copied into. If it's empty, the sources are
+	// only downloaded into the cache.
+	Destination string
+	// Deps enables fetching the sources of
+	// all the LURE dependencies as well
+	Deps        bool
+	Interactive bool
+	// TargetArch is the CPU architecture whose overrides are
+	// used. If it's empty, the default from cpu.Arch() is used.
+	TargetArch string
+	// Distro is the ID of the distro whose overrides are used,
+	// optionally followed by a colon and its version or codename,
+	// such as "ubuntu:22.04". If it's empty, the host's distro
+	// is used.
+	Distro string
 }
 
 // BuildVars represents the script variables required
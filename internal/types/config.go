@@ -23,7 +23,13 @@ type Config struct {
 	RootCmd          string   `toml:"rootCmd"`
 	PagerStyle       string   `toml:"pagerStyle"`
 	IgnorePkgUpdates []string `toml:"ignorePkgUpdates"`
+	Offline          bool     `toml:"offline"`
+	SBOM             string   `toml:"sbom"`
 	Repos            []Repo   `toml:"repo"`
+	Cache            Cache    `toml:"cache"`
+	Auth             []Auth   `toml:"auth"`
+	Signing          Signing  `toml:"signing"`
+	Publish          Publish  `toml:"publish"`
 	Unsafe           Unsafe   `toml:"unsafe"`
 }
 
@@ -33,6 +39,62 @@ type Repo struct {
 	URL  string `toml:"url"`
 }
 
+// Cache contains the settings for LURE's download cache
+type Cache struct {
+	// MaxSize is the maximum size of the download cache,
+	// such as "10GB". If it's empty, the size is not limited.
+	MaxSize string `toml:"maxSize"`
+}
+
+// Auth contains the credentials that are used when
+// downloading sources from a host
+type Auth struct {
+	// Host is the host name, optionally with a port,
+	// that these credentials are sent to
+	Host     string `toml:"host"`
+	Username string `toml:"username"`
+	Password string `toml:"password"`
+	// Token is sent as a bearer token for file downloads
+	// and as the password for git repos
+	Token string `toml:"token"`
+	// Headers contains extra HTTP headers that are
+	// sent with file downloads
+	Headers map[string]string `toml:"headers"`
+}
+
+// Signing contains the keys that built packages are signed with.
+// Packages aren't signed if no keys are configured.
+type Signing struct {
+	// KeyFile is the path to the OpenPGP secret key that's
+	// used to sign deb, rpm and Arch Linux packages
+	KeyFile string `toml:"keyFile"`
+	// KeyID is the ID of the key in KeyFile. It's only
+	// needed if the key has subkeys.
+	KeyID string `toml:"keyID"`
+	// APKKeyFile is the path to the RSA secret key
+	// in PEM format that's used to sign apk packages
+	APKKeyFile string `toml:"apkKeyFile"`
+	// APKKeyName is the name that apk uses to look up the public key,
+	// without the ".rsa.pub" extension. It defaults to the name of
+	// APKKeyFile without its extension.
+	APKKeyName string `toml:"apkKeyName"`
+	// Passphrase is where the passphrase of the keys is read from.
+	// It can be "env:NAME", "file:PATH" or "cmd:COMMAND".
+	Passphrase string `toml:"passphrase"`
+}
+
+// Publish contains the settings for the local
+// package repository that lure publish writes to
+type Publish struct {
+	// Dir is the directory the repository is in
+	Dir string `toml:"dir"`
+	// Name is the name of the repository, which is used for the
+	// pacman database and the APT Release file. It defaults to "lure".
+	Name string `toml:"name"`
+	// Auto publishes every package as soon as it's built
+	Auto bool `toml:"auto"`
+}
+
 type Unsafe struct {
 	AllowRunAsRoot bool `toml:"allowRunAsRoot"`
 }
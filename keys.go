@@ -0,0 +1,223 @@
+/*
+ * LURE - Linux User REpository
+ * Copyright (C) 2023 Elara Musayelyan
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/sintan1729/lure/internal/config"
+	"github.com/sintan1729/lure/internal/signing"
+	"github.com/sintan1729/lure/pkg/loggerctx"
+	"github.com/sintan1729/lure/pkg/manager"
+	"github.com/urfave/cli/v3"
+)
+
+var keysCmd = &cli.Command{
+	Name:  "keys",
+	Usage: "Manage the keys that built packages are signed with",
+	Commands: []*cli.Command{
+		keysGenerateCmd,
+		keysExportCmd,
+	},
+}
+
+var keysGenerateCmd = &cli.Command{
+	Name:  "generate",
+	Usage: "Generate a local signing key and use it for all future builds",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:     "name",
+			Aliases:  []string{"n"},
+			Required: true,
+			Usage:    "Name of the key's owner",
+		},
+		&cli.StringFlag{
+			Name:     "email",
+			Aliases:  []string{"e"},
+			Required: true,
+			Usage:    "Email address of the key's owner",
+		},
+		&cli.BoolFlag{
+			Name:    "force",
+			Aliases: []string{"f"},
+			Usage:   "Overwrite existing keys",
+		},
+	},
+	Action: func(ctx context.Context, c *cli.Command) error {
+		log := loggerctx.From(ctx)
+
+		cfg := config.Config(ctx)
+
+		keyDir := filepath.Join(config.GetPaths(ctx).ConfigDir, "keys")
+		keyFile := filepath.Join(keyDir, "lure.asc")
+		apkKeyFile := filepath.Join(keyDir, "lure.rsa")
+
+		if !c.Bool("force") {
+			for _, path := range []string{keyFile, apkKeyFile} {
+				if _, err := os.Stat(path); err == nil {
+					log.Fatal("Signing key already exists, use --force to overwrite it").Str("path", path).Send()
+				}
+			}
+		}
+
+		// The keys are encrypted with the configured passphrase, if there is one
+		passphrase, err := signing.Passphrase(cfg.Signing.Passphrase)
+		if err != nil {
+			log.Fatal("Error reading signing key passphrase").Err(err).Send()
+		}
+
+		log.Info("Generating signing key").Send()
+
+		pgpKey, rsaKey, err := signing.Generate(c.String("name"), c.String("email"), passphrase)
+		if err != nil {
+			log.Fatal("Error generating signing key").Err(err).Send()
+		}
+
+		err = os.MkdirAll(keyDir, 0o700)
+		if err != nil {
+			log.Fatal("Error creating key directory").Err(err).Send()
+		}
+
+		err = os.WriteFile(keyFile, pgpKey, 0o600)
+		if err != nil {
+			log.Fatal("Error writing signing key").Err(err).Send()
+		}
+
+		err = os.WriteFile(apkKeyFile, rsaKey, 0o600)
+		if err != nil {
+			log.Fatal("Error writing signing key").Err(err).Send()
+		}
+
+		entity, err := signing.ReadPGPKey(keyFile, passphrase)
+		if err != nil {
+			log.Fatal("Error reading signing key").Err(err).Send()
+		}
+
+		cfg.Signing.KeyFile = keyFile
+		cfg.Signing.KeyID = ""
+		cfg.Signing.APKKeyFile = apkKeyFile
+		cfg.Signing.APKKeyName = ""
+
+		cfgFl, err := os.Create(config.GetPaths(ctx).ConfigPath)
+		if err != nil {
+			log.Fatal("Error opening config file").Err(err).Send()
+		}
+
+		err = toml.NewEncoder(cfgFl).Encode(cfg)
+		if err != nil {
+			log.Fatal("Error encoding config").Err(err).Send()
+		}
+
+		log.Info("Generated signing key").Str("fingerprint", fmt.Sprintf("%X", entity.PrimaryKey.Fingerprint)).Str("path", keyFile).Send()
+		return nil
+	},
+}
+
+var keysExportCmd = &cli.Command{
+	Name:  "export",
+	Usage: "Export the public signing key so the system package manager can verify built packages",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "format",
+			Usage: "Package format to export the key for (deb, rpm, apk or archlinux). Defaults to the format of the system package manager.",
+		},
+		&cli.StringFlag{
+			Name:    "output",
+			Aliases: []string{"o"},
+			Usage:   "File to write the key to instead of standard output",
+		},
+	},
+	Action: func(ctx context.Context, c *cli.Command) error {
+		log := loggerctx.From(ctx)
+
+		cfg := config.Config(ctx).Signing
+
+		format := c.String("format")
+		if format == "" {
+			format = os.Getenv("LURE_PKG_FORMAT")
+		}
+		if format == "" {
+			mgr := manager.Detect()
+			if mgr == nil {
+				log.Fatal("Unable to detect a supported package manager on the system, use --format to choose a package format").Send()
+			}
+			format = mgr.Format()
+		}
+
+		passphrase, err := signing.Passphrase(cfg.Passphrase)
+		if err != nil {
+			log.Fatal("Error reading signing key passphrase").Err(err).Send()
+		}
+
+		var key []byte
+		var hint string
+		switch format {
+		case "apk":
+			if cfg.APKKeyFile == "" {
+				log.Fatal("No apk signing key is configured, run lure keys generate to create one").Send()
+			}
+
+			keyName := cfg.APKKeyName
+			if keyName == "" {
+				keyName = signing.APKKeyName(cfg.APKKeyFile)
+			}
+
+			key, err = signing.RSAPublicKey(signing.ExpandPath(cfg.APKKeyFile), passphrase)
+			hint = "Install the key as /etc/apk/keys/" + keyName + ".rsa.pub"
+		case "deb", "rpm", "archlinux":
+			if cfg.KeyFile == "" {
+				log.Fatal("No signing key is configured, run lure keys generate to create one").Send()
+			}
+
+			key, err = signing.PGPPublicKey(signing.ExpandPath(cfg.KeyFile), passphrase)
+			switch format {
+			case "deb":
+				hint = "Install the key in /etc/apt/trusted.gpg.d/ with the .asc extension"
+			case "rpm":
+				hint = "Import the key with rpm --import"
+			case "archlinux":
+				hint = "Import the key with pacman-key --add, then sign it locally with pacman-key --lsign-key"
+			}
+		default:
+			log.Fatal("Unsupported package format").Str("format", format).Send()
+		}
+		if err != nil {
+			log.Fatal("Error exporting public key").Err(err).Send()
+		}
+
+		if output := c.String("output"); output != "" {
+			err = os.WriteFile(output, key, 0o644)
+			if err != nil {
+				log.Fatal("Error writing public key").Err(err).Send()
+			}
+		} else {
+			_, err = os.Stdout.Write(key)
+			if err != nil {
+				log.Fatal("Error writing public key").Err(err).Send()
+			}
+		}
+
+		log.Info(hint).Send()
+		return nil
+	},
+}
@@ -0,0 +1,116 @@
+/*
+ * LURE - Linux User REpository
+ * Copyright (C) 2023 Elara Musayelyan
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/sintan1729/lure/internal/config"
+	"github.com/sintan1729/lure/pkg/build"
+	"github.com/sintan1729/lure/pkg/loggerctx"
+	"github.com/urfave/cli/v3"
+)
+
+var lintCmd = &cli.Command{
+	Name:      "lint",
+	Usage:     "Check build scripts for common mistakes",
+	ArgsUsage: "[script or repo directory...]",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:    "repo",
+			Aliases: []string{"r"},
+			Usage:   "Lint every build script in this LURE repo",
+		},
+		&cli.BoolFlag{
+			Name:  "json",
+			Usage: "Print the issues as JSON",
+		},
+	},
+	Action: func(ctx context.Context, c *cli.Command) error {
+		log := loggerctx.From(ctx)
+
+		paths := c.Args().Slice()
+		if c.String("repo") != "" {
+			paths = append(paths, filepath.Join(config.GetPaths(ctx).RepoDir, c.String("repo")))
+		}
+		if len(paths) == 0 {
+			paths = []string{"lure.sh"}
+		}
+
+		var scripts []string
+		for _, path := range paths {
+			fi, err := os.Stat(path)
+			if err != nil {
+				log.Fatal("Error getting build script").Str("path", path).Err(err).Send()
+			}
+
+			if !fi.IsDir() {
+				scripts = append(scripts, path)
+				continue
+			}
+
+			// Repos contain a directory for each package,
+			// with the build script inside it
+			repoScripts, err := filepath.Glob(filepath.Join(path, "*", "lure.sh"))
+			if err != nil {
+				log.Fatal("Error finding build scripts").Str("path", path).Err(err).Send()
+			}
+			scripts = append(scripts, repoScripts...)
+		}
+
+		issues := []build.LintIssue{}
+		for _, script := range scripts {
+			scriptIssues, err := build.Lint(ctx, script)
+			if err != nil {
+				log.Fatal("Error linting build script").Str("script", script).Err(err).Send()
+			}
+			issues = append(issues, scriptIssues...)
+		}
+
+		if c.Bool("json") {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			err := enc.Encode(issues)
+			if err != nil {
+				log.Fatal("Error encoding issues").Err(err).Send()
+			}
+		} else {
+			for _, issue := range issues {
+				fmt.Println(issue)
+			}
+		}
+
+		errCount := 0
+		for _, issue := range issues {
+			if issue.Severity == build.SeverityError {
+				errCount++
+			}
+		}
+
+		if errCount > 0 {
+			log.Fatal("Build scripts contain errors").Int("scripts", len(scripts)).Int("errors", errCount).Send()
+		}
+
+		return nil
+	},
+}
@@ -40,6 +40,11 @@ var listCmd = &cli.Command{
 			Name:    "installed",
 			Aliases: []string{"I"},
 		},
+		&cli.StringFlag{
+			Name:    "license",
+			Aliases: []string{"L"},
+			Usage:   "Only list packages that use this SPDX license identifier",
+		},
 	},
 	Action: func(ctx context.Context, c *cli.Command) error {
 		log := loggerctx.From(ctx)
@@ -52,10 +57,15 @@ var listCmd = &cli.Command{
 		where := "true"
 		args := []any(nil)
 		if c.NArg() > 0 {
-			where = "name LIKE ? OR json_array_contains(provides, ?)"
+			where = "name LIKE ? OR provides_contains(provides, ?)"
 			args = []any{c.Args().First(), c.Args().First()}
 		}
 
+		if c.String("license") != "" {
+			where = "(" + where + ") AND license_contains(license, ?)"
+			args = append(args, c.String("license"))
+		}
+
 		result, err := db.GetPkgs(ctx, where, args...)
 		if err != nil {
 			log.Fatal("Error getting packages").Err(err).Send()
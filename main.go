@@ -50,18 +50,31 @@ var app = &cli.Command{
 			Value:   isatty.IsTerminal(os.Stdin.Fd()),
 			Usage:   "Enable interactive questions and prompts",
 		},
+		&cli.BoolFlag{
+			Name:  "offline",
+			Usage: "Don't pull repos, and only use sources from the download cache",
+		},
 	},
 	Commands: []*cli.Command{
 		installCmd,
 		removeCmd,
+		autoremoveCmd,
+		cleanupCmd,
 		upgradeCmd,
 		infoCmd,
 		listCmd,
 		buildCmd,
+		fetchCmd,
+		updsumsCmd,
+		lintCmd,
 		addrepoCmd,
 		removerepoCmd,
 		refreshCmd,
 		fixCmd,
+		doctorCmd,
+		cacheCmd,
+		keysCmd,
+		publishCmd,
 		genCmd,
 		helperCmd,
 		versionCmd,
@@ -74,6 +87,10 @@ var app = &cli.Command{
 			log.Fatal("Running LURE as root is forbidden as it may cause catastrophic damage to your system").Send()
 		}
 
+		if c.Bool("offline") {
+			config.Config(ctx).Offline = true
+		}
+
 		if trimmed := strings.TrimSpace(c.String("pm-args")); trimmed != "" {
 			args := strings.Split(trimmed, " ")
 			manager.Args = append(manager.Args, args...)
@@ -22,6 +22,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -44,9 +45,15 @@ import (
 	"github.com/sintan1729/lure/internal/cpu"
 	"github.com/sintan1729/lure/internal/db"
 	"github.com/sintan1729/lure/internal/dl"
+	"github.com/sintan1729/lure/internal/flock"
+	"github.com/sintan1729/lure/internal/journal"
+	"github.com/sintan1729/lure/internal/pkgdep"
+	"github.com/sintan1729/lure/internal/publish"
 	"github.com/sintan1729/lure/internal/shutils/decoder"
 	"github.com/sintan1729/lure/internal/shutils/handlers"
 	"github.com/sintan1729/lure/internal/shutils/helpers"
+	"github.com/sintan1729/lure/internal/signing"
+	"github.com/sintan1729/lure/internal/spdx"
 	"github.com/sintan1729/lure/internal/types"
 	"github.com/sintan1729/lure/pkg/distro"
 	"github.com/sintan1729/lure/pkg/loggerctx"
@@ -57,6 +64,30 @@ import (
 	"mvdan.cc/sh/v3/syntax"
 )
 
+var (
+	// ErrUserAborted is returned when the user chooses not to continue with a build
+	ErrUserAborted           = cliutils.ErrUserAborted
+	ErrMissingPackageFunc    = errors.New("the package() function is required")
+	ErrChecksumCountMismatch = errors.New("the checksums array must be the same length as sources")
+)
+
+// BuildPhaseError is returned when one of the functions
+// in a build script, such as build(), fails
+type BuildPhaseError struct {
+	Package string
+	// Phase is the name of the function that failed
+	Phase string
+	Err   error
+}
+
+func (e *BuildPhaseError) Error() string {
+	return e.Package + ": " + e.Phase + "() failed: " + e.Err.Error()
+}
+
+func (e *BuildPhaseError) Unwrap() error {
+	return e.Err
+}
+
 // BuildPackage builds the script at the given path. It returns two slices. One contains the paths
 // to the built package(s), the other contains the names of the built package(s).
 func BuildPackage(ctx context.Context, opts types.BuildOpts) ([]string, []string, error) {
@@ -75,53 +106,104 @@ func BuildPackage(ctx context.Context, opts types.BuildOpts) ([]string, []string
 	// The first pass is just used to get variable values and runs before
 	// the script is displayed, so it's restricted so as to prevent malicious
 	// code from executing.
-	vars, err := executeFirstPass(ctx, info, fl, opts.Script)
+	arch, err := getTargetArch(opts.TargetArch)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	host := &buildTarget{info: info, arch: arch}
+	err = host.load(ctx, fl, opts.Script)
+	if err != nil {
+		return nil, nil, err
+	}
+	vars := host.vars
+
+	// Each target gets its own first pass, so that the
+	// overrides for its distro are used
+	targets, err := getTargets(ctx, opts, host, fl)
 	if err != nil {
 		return nil, nil, err
 	}
 
 	dirs := getDirs(ctx, vars, opts.Script)
 
-	// If opts.Clean isn't set and we find the package already built,
-	// just return it rather than rebuilding
+	// Lock the build directory so that other LURE processes
+	// can't build the same package at the same time
+	lock, err := flock.Acquire(ctx, dirs.BaseDir+".lock")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer lock.Release()
+
+	// If opts.Clean isn't set and we find the packages already built,
+	// just return them rather than rebuilding
 	if !opts.Clean {
-		builtPkgPath, ok, err := checkForBuiltPackage(vars, getPkgFormat(opts.Manager), dirs.BaseDir)
+		builtPkgPaths, ok, err := checkForBuiltPackages(targets, dirs.BaseDir)
 		if err != nil {
 			return nil, nil, err
 		}
 
 		if ok {
-			return []string{builtPkgPath}, nil, err
+			return builtPkgPaths, []string{vars.Name}, err
 		}
 	}
 
-	// Ask the user if they'd like to see the build script
-	err = cliutils.PromptViewScript(ctx, opts.Script, vars.Name, config.Config(ctx).PagerStyle, opts.Interactive)
+	sbomFormat, err := getSBOMFormat(ctx, opts)
 	if err != nil {
-		log.Fatal("Failed to prompt user to view build script").Err(err).Send()
+		return nil, nil, err
+	}
+
+	// The passphrase is read before building so that
+	// the build doesn't fail at the very end
+	keys, err := signing.Load(config.Config(ctx).Signing)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var pubOpts publish.Options
+	if config.Config(ctx).Publish.Auto {
+		pubOpts, err = publish.OptionsFromConfig(ctx, "", keys)
+		if err != nil {
+			return nil, nil, err
+		}
 	}
 
-	log.Info("Building package").Str("name", vars.Name).Str("version", vars.Version).Send()
+	// In offline mode, make sure all the sources are available
+	// before doing anything, rather than failing halfway through
+	if config.Config(ctx).Offline {
+		var sources []string
+		for _, target := range targets {
+			sources = append(sources, target.vars.Sources...)
+		}
+
+		if missing := dl.MissingOffline(ctx, removeDuplicates(sources)); len(missing) > 0 {
+			return nil, nil, fmt.Errorf("%w: %s", dl.ErrOffline, strings.Join(missing, ", "))
+		}
+	}
 
-	// The second pass will be used to execute the actual code,
-	// so it's unrestricted. The script has already been displayed
-	// to the user by this point, so it should be safe
-	dec, err := executeSecondPass(ctx, info, fl, dirs)
+	// Ask the user if they'd like to see the build script
+	err = cliutils.PromptViewScript(ctx, opts.Script, vars.Name, config.Config(ctx).PagerStyle, opts.Interactive)
 	if err != nil {
 		return nil, nil, err
 	}
 
+	log.Info("Building package").
+		Str("name", vars.Name).
+		Str("version", vars.Version).
+		Str("formats", strings.Join(targetFormats(targets), ", ")).
+		Send()
+
 	// Get the installed packages on the system
 	installed, err := opts.Manager.ListInstalled(nil)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	cont, err := performChecks(ctx, vars, opts.Interactive, installed)
+	cont, err := performChecks(ctx, vars, host.arch, opts.Interactive, installed)
 	if err != nil {
 		return nil, nil, err
 	} else if !cont {
-		os.Exit(1)
+		return nil, nil, ErrUserAborted
 	}
 
 	// Prepare the directories for building
@@ -130,70 +212,184 @@ func BuildPackage(ctx context.Context, opts types.BuildOpts) ([]string, []string
 		return nil, nil, err
 	}
 
-	buildDeps, err := installBuildDeps(ctx, vars, opts, installed)
-	if err != nil {
-		return nil, nil, err
+	// Build dependencies are installed on the system
+	// doing the build, so the host's are used
+	buildDeps, journalID, err := installBuildDeps(ctx, vars, opts, installed)
+	if journalID != "" {
+		// The build dependencies are offered for removal however the build
+		// ends. If LURE exits before this runs, they stay in the journal
+		// so that "lure cleanup" can remove them later.
+		defer func() {
+			// The build may have ended because it was interrupted, so the
+			// cleanup shouldn't be canceled along with the build
+			err := removeBuildDeps(context.WithoutCancel(ctx), journalID, opts)
+			if err != nil {
+				log.Warn("Error removing build dependencies").Err(err).Send()
+			}
+		}()
 	}
-
-	err = installOptDeps(ctx, vars, opts, installed)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	builtPaths, builtNames, repoDeps, err := buildLUREDeps(ctx, opts, vars)
+	// The SBOM records the versions of the build dependencies that
+	// were used for the build, and the journal records the packages
+	// that have to be removed once the build is done
+	installedWithDeps, err := opts.Manager.ListInstalled(nil)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	log.Info("Downloading sources").Send()
-
-	err = getSources(ctx, dirs, vars)
-	if err != nil {
-		return nil, nil, err
+	if journalID != "" {
+		err = journal.Update(ctx, journalID, newlyInstalled(installed, installedWithDeps))
+		if err != nil {
+			return nil, nil, err
+		}
 	}
 
-	err = executeFunctions(ctx, dec, dirs, vars)
+	err = installOptDeps(ctx, vars, opts, installed)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	log.Info("Building package metadata").Str("name", vars.Name).Send()
+	// The dependencies of each target may differ, so the LURE
+	// dependencies are built for each distinct set of them
+	var builtPaths, builtNames []string
+	targetDeps := map[*buildTarget][]string{}
+	depsCache := map[string][]string{}
+	for _, target := range targets {
+		depends, err := resolveAlternatives(ctx, target.vars.Depends, installed, opts.Manager)
+		if err != nil {
+			return nil, nil, err
+		}
 
-	pkgFormat := getPkgFormat(opts.Manager)
+		depsKey := strings.Join(depends, "\x00")
+		deps, ok := depsCache[depsKey]
+		if !ok {
+			paths, names, repoDeps, err := buildLUREDeps(ctx, opts, chosenDeps(depends))
+			if err != nil {
+				return nil, nil, err
+			}
 
-	pkgInfo, err := buildPkgMetadata(vars, dirs, pkgFormat, append(repoDeps, builtNames...))
-	if err != nil {
-		return nil, nil, err
-	}
+			builtPaths = append(builtPaths, paths...)
+			builtNames = append(builtNames, names...)
 
-	packager, err := nfpm.Get(pkgFormat)
-	if err != nil {
-		return nil, nil, err
+			// The entries of depends are used so that the package
+			// metadata keeps the alternatives that weren't chosen
+			depNames := make([]string, 0, len(repoDeps)+len(names))
+			for _, dep := range repoDeps {
+				depNames = append(depNames, pkgdep.Name(dep))
+			}
+			deps = withConstraints(append(depNames, names...), depends)
+			depsCache[depsKey] = deps
+		}
+		targetDeps[target] = deps
 	}
 
-	pkgName := packager.ConventionalFileName(pkgInfo)
-	pkgPath := filepath.Join(dirs.BaseDir, pkgName)
+	// Targets whose sources and functions are the same after resolving
+	// overrides share a single build, and get a package each from it
+	var pkgPaths []string
+	for i, group := range groupTargets(targets) {
+		if i > 0 {
+			err = cleanBuildDirs(dirs)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
 
-	pkgFile, err := os.Create(pkgPath)
-	if err != nil {
-		return nil, nil, err
-	}
+		groupVars := group[0].vars
+		if len(targets) > 1 {
+			log.Info("Building for formats").Str("formats", strings.Join(targetFormats(group), ", ")).Send()
+		}
+
+		// The second pass will be used to execute the actual code,
+		// so it's unrestricted. The script has already been displayed
+		// to the user by this point, so it should be safe
+		dec, err := executeSecondPass(ctx, group[0].info, group[0].arch, fl, dirs)
+		if err != nil {
+			return nil, nil, err
+		}
 
-	log.Info("Compressing package").Str("name", pkgName).Send()
+		log.Info("Downloading sources").Send()
 
-	err = packager.Package(pkgInfo, pkgFile)
-	if err != nil {
-		return nil, nil, err
-	}
+		srcNames, err := getSources(ctx, dirs, groupVars)
+		if err != nil {
+			return nil, nil, err
+		}
 
-	err = removeBuildDeps(ctx, buildDeps, opts)
-	if err != nil {
-		return nil, nil, err
+		err = executeFunctions(ctx, dec, dirs, groupVars)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, target := range group {
+			// version() may have changed the version
+			target.vars.Version = groupVars.Version
+
+			log.Info("Building package metadata").Str("name", target.vars.Name).Str("format", target.format).Send()
+
+			pkgInfo, err := buildPkgMetadata(target.vars, dirs, target.format, target.arch, targetDeps[target], keys)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			packager, err := nfpm.Get(target.format)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			pkgName := packager.ConventionalFileName(pkgInfo)
+			pkgPath := filepath.Join(dirs.BaseDir, pkgName)
+
+			pkgFile, err := os.Create(pkgPath)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			log.Info("Compressing package").Str("name", pkgName).Send()
+
+			err = packager.Package(pkgInfo, pkgFile)
+			pkgFile.Close()
+			if err != nil {
+				return nil, nil, err
+			}
+
+			err = signPkgFile(pkgPath, target.format, keys)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			if sbomFormat != "" {
+				sbom, err := collectSBOM(ctx, target.vars, dirs, opts.Script, pkgInfo.Arch, srcNames, buildDeps, installed, installedWithDeps, opts.Manager)
+				if err != nil {
+					return nil, nil, err
+				}
+
+				path := SBOMPath(pkgPath, sbomFormat)
+				log.Info("Writing SBOM").Str("path", path).Send()
+
+				err = writeSBOM(path, sbomFormat, sbom)
+				if err != nil {
+					return nil, nil, err
+				}
+			}
+
+			if pubOpts.Dir != "" {
+				log.Info("Publishing package").Str("dir", pubOpts.Dir).Send()
+
+				_, err = publish.Publish(ctx, pubOpts, PackageFiles(pkgPath))
+				if err != nil {
+					return nil, nil, err
+				}
+			}
+
+			pkgPaths = append(pkgPaths, pkgPath)
+		}
 	}
 
-	// Add the path and name of the package we just built to the
+	// Add the paths and name of the packages we just built to the
 	// appropriate slices
-	pkgPaths := append(builtPaths, pkgPath)
+	pkgPaths = append(builtPaths, pkgPaths...)
 	pkgNames := append(builtNames, vars.Name)
 
 	// Remove any duplicates from the pkgPaths and pkgNames.
@@ -223,9 +419,30 @@ func parseScript(script string) (*syntax.File, error) {
 
 // executeFirstPass executes the parsed script in a restricted environment
 // to extract the build variables without executing any actual code.
-func executeFirstPass(ctx context.Context, info *distro.OSRelease, fl *syntax.File, script string) (*types.BuildVars, error) {
+func executeFirstPass(ctx context.Context, info *distro.OSRelease, arch string, fl *syntax.File, script string) (*types.BuildVars, error) {
+	runner, err := runFirstPass(ctx, info, arch, fl, script)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := decoder.New(info, runner)
+	dec.Arch = arch
+
+	var vars types.BuildVars
+	err = dec.DecodeVars(&vars)
+	if err != nil {
+		return nil, err
+	}
+
+	return &vars, nil
+}
+
+// runFirstPass runs the parsed script in a restricted environment
+// and returns the runner, which contains the values of all the
+// variables set by the script.
+func runFirstPass(ctx context.Context, info *distro.OSRelease, arch string, fl *syntax.File, script string) (*interp.Runner, error) {
 	scriptDir := filepath.Dir(script)
-	env := createBuildEnvVars(info, types.Directories{ScriptDir: scriptDir})
+	env := createBuildEnvVars(info, arch, types.Directories{ScriptDir: scriptDir})
 
 	runner, err := interp.New(
 		interp.Env(expand.ListEnviron(env...)),
@@ -246,15 +463,7 @@ func executeFirstPass(ctx context.Context, info *distro.OSRelease, fl *syntax.Fi
 		return nil, err
 	}
 
-	dec := decoder.New(info, runner)
-
-	var vars types.BuildVars
-	err = dec.DecodeVars(&vars)
-	if err != nil {
-		return nil, err
-	}
-
-	return &vars, nil
+	return runner, nil
 }
 
 // getDirs returns the appropriate directories for the script
@@ -277,8 +486,8 @@ func getDirs(ctx context.Context, vars *types.BuildVars, script string) types.Di
 
 // executeSecondPass executes the build script for the second time, this time without any restrictions.
 // It returns a decoder that can be used to retrieve functions and variables from the script.
-func executeSecondPass(ctx context.Context, info *distro.OSRelease, fl *syntax.File, dirs types.Directories) (*decoder.Decoder, error) {
-	env := createBuildEnvVars(info, dirs)
+func executeSecondPass(ctx context.Context, info *distro.OSRelease, arch string, fl *syntax.File, dirs types.Directories) (*decoder.Decoder, error) {
+	env := createBuildEnvVars(info, arch, dirs)
 
 	fakeroot := handlers.FakerootExecHandler(2 * time.Second)
 	runner, err := interp.New(
@@ -297,7 +506,9 @@ func executeSecondPass(ctx context.Context, info *distro.OSRelease, fl *syntax.F
 		return nil, err
 	}
 
-	return decoder.New(info, runner), nil
+	dec := decoder.New(info, runner)
+	dec.Arch = arch
+	return dec, nil
 }
 
 // prepareDirs prepares the directories for building.
@@ -314,10 +525,15 @@ func prepareDirs(dirs types.Directories) error {
 }
 
 // performChecks checks various things on the system to ensure that the package can be installed.
-func performChecks(ctx context.Context, vars *types.BuildVars, interactive bool, installed map[string]string) (bool, error) {
+func performChecks(ctx context.Context, vars *types.BuildVars, arch string, interactive bool, installed map[string]string) (bool, error) {
 	log := loggerctx.From(ctx)
-	if !cpu.IsCompatibleWith(cpu.Arch(), vars.Architectures) {
-		cont, err := cliutils.YesNoPrompt(ctx, "Your system's CPU architecture doesn't match this package. Do you want to build anyway?", interactive, true)
+	if !cpu.IsCompatibleWith(arch, vars.Architectures) {
+		prompt := "Your system's CPU architecture doesn't match this package. Do you want to build anyway?"
+		if arch != cpu.HostArch() {
+			prompt = "The target architecture (" + arch + ") doesn't match this package. Do you want to build anyway?"
+		}
+
+		cont, err := cliutils.YesNoPrompt(ctx, prompt, interactive, true)
 		if err != nil {
 			return false, err
 		}
@@ -338,25 +554,56 @@ func performChecks(ctx context.Context, vars *types.BuildVars, interactive bool,
 }
 
 // installBuildDeps installs any build dependencies that aren't already installed and returns
-// a slice containing the names of all the packages it installed.
-func installBuildDeps(ctx context.Context, vars *types.BuildVars, opts types.BuildOpts, installed map[string]string) ([]string, error) {
+// a slice containing the names of the LURE packages it installed, along with the ID of the
+// journal entry that records them. The ID is empty if there was nothing to install.
+func installBuildDeps(ctx context.Context, vars *types.BuildVars, opts types.BuildOpts, installed map[string]string) ([]string, string, error) {
 	log := loggerctx.From(ctx)
-	var buildDeps []string
-	if len(vars.BuildDepends) > 0 {
-		found, notFound, err := repos.FindPkgs(ctx, vars.BuildDepends)
-		if err != nil {
-			return nil, err
-		}
+	if len(vars.BuildDepends) == 0 {
+		return nil, "", nil
+	}
 
-		found = removeAlreadyInstalled(found, installed)
+	buildDepends, err := resolveAlternatives(ctx, vars.BuildDepends, installed, opts.Manager)
+	if err != nil {
+		return nil, "", err
+	}
 
-		log.Info("Installing build dependencies").Send()
+	found, notFound, err := repos.FindPkgs(ctx, chosenDeps(buildDepends))
+	if err != nil {
+		return nil, "", err
+	}
 
-		flattened := cliutils.FlattenPkgs(ctx, found, "install", opts.Interactive)
-		buildDeps = packageNames(flattened)
-		InstallPkgs(ctx, flattened, notFound, opts)
+	found = removeAlreadyInstalled(found, installed)
+
+	flattened, err := cliutils.FlattenPkgs(ctx, found, "install", opts.Interactive)
+	if err != nil {
+		return nil, "", err
 	}
-	return buildDeps, nil
+	buildDeps := packageNames(flattened)
+
+	toInstall := slices.Clone(buildDeps)
+	for _, dep := range notFound {
+		if _, ok := installed[pkgdep.Name(dep)]; !ok {
+			toInstall = append(toInstall, pkgdep.Name(dep))
+		}
+	}
+	if len(toInstall) == 0 {
+		return buildDeps, "", nil
+	}
+
+	warnLeftoverBuildDeps(ctx)
+
+	// The packages are added to the journal before they're installed,
+	// so that they can be cleaned up even if the installation fails
+	journalID, err := journal.Start(ctx, vars.Name, toInstall)
+	if err != nil {
+		return nil, "", err
+	}
+
+	log.Info("Installing build dependencies").Send()
+
+	opts.AsDeps = true
+	err = InstallPkgs(ctx, flattened, notFound, opts)
+	return buildDeps, journalID, err
 }
 
 // installOptDeps asks the user which, if any, optional dependencies they want to install.
@@ -372,34 +619,48 @@ func installOptDeps(ctx context.Context, vars *types.BuildVars, opts types.Build
 			return nil
 		}
 
-		found, notFound, err := repos.FindPkgs(ctx, optDeps)
+		optDeps, err = resolveAlternatives(ctx, optDeps, installed, opts.Manager)
+		if err != nil {
+			return err
+		}
+
+		found, notFound, err := repos.FindPkgs(ctx, chosenDeps(optDeps))
 		if err != nil {
 			return err
 		}
 
 		found = removeAlreadyInstalled(found, installed)
-		flattened := cliutils.FlattenPkgs(ctx, found, "install", opts.Interactive)
-		InstallPkgs(ctx, flattened, notFound, opts)
+		flattened, err := cliutils.FlattenPkgs(ctx, found, "install", opts.Interactive)
+		if err != nil {
+			return err
+		}
+
+		opts.AsDeps = true
+		return InstallPkgs(ctx, flattened, notFound, opts)
 	}
 	return nil
 }
 
-// buildLUREDeps builds all the LURE dependencies of the package. It returns the paths and names
+// buildLUREDeps builds all the LURE dependencies in depends. It returns the paths and names
 // of the packages it built, as well as all the dependencies it didn't find in the LURE repo so
 // they can be installed from the system repos.
-func buildLUREDeps(ctx context.Context, opts types.BuildOpts, vars *types.BuildVars) (builtPaths, builtNames, repoDeps []string, err error) {
+func buildLUREDeps(ctx context.Context, opts types.BuildOpts, depends []string) (builtPaths, builtNames, repoDeps []string, err error) {
 	log := loggerctx.From(ctx)
-	if len(vars.Depends) > 0 {
+	if len(depends) > 0 {
 		log.Info("Installing dependencies").Send()
 
-		found, notFound, err := repos.FindPkgs(ctx, vars.Depends)
+		found, notFound, err := repos.FindPkgs(ctx, depends)
 		if err != nil {
 			return nil, nil, nil, err
 		}
 		repoDeps = notFound
 
 		// If there are multiple options for some packages, flatten them all into a single slice
-		pkgs := cliutils.FlattenPkgs(ctx, found, "install", opts.Interactive)
+		pkgs, err := cliutils.FlattenPkgs(ctx, found, "install", opts.Interactive)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
 		scripts := GetScriptPaths(ctx, pkgs)
 		for _, script := range scripts {
 			newOpts := opts
@@ -443,7 +704,7 @@ func executeFunctions(ctx context.Context, dec *decoder.Decoder, dirs types.Dire
 			interp.StdIO(os.Stdin, buf, os.Stderr),
 		)
 		if err != nil {
-			return err
+			return &BuildPhaseError{Package: vars.Name, Phase: "version", Err: err}
 		}
 
 		newVer := strings.TrimSpace(buf.String())
@@ -462,7 +723,7 @@ func executeFunctions(ctx context.Context, dec *decoder.Decoder, dirs types.Dire
 
 		err = prepare(ctx, interp.Dir(dirs.SrcDir))
 		if err != nil {
-			return err
+			return &BuildPhaseError{Package: vars.Name, Phase: "prepare", Err: err}
 		}
 	}
 
@@ -472,7 +733,7 @@ func executeFunctions(ctx context.Context, dec *decoder.Decoder, dirs types.Dire
 
 		err = build(ctx, interp.Dir(dirs.SrcDir))
 		if err != nil {
-			return err
+			return &BuildPhaseError{Package: vars.Name, Phase: "build", Err: err}
 		}
 	}
 
@@ -482,48 +743,77 @@ func executeFunctions(ctx context.Context, dec *decoder.Decoder, dirs types.Dire
 
 		err = packageFn(ctx, interp.Dir(dirs.SrcDir))
 		if err != nil {
-			return err
+			return &BuildPhaseError{Package: vars.Name, Phase: "package", Err: err}
 		}
 	} else {
-		log.Fatal("The package() function is required").Send()
+		return fmt.Errorf("%w: %s", ErrMissingPackageFunc, vars.Name)
 	}
 
 	return nil
 }
 
-// buildPkgMetadata builds the metadata for the package that's going to be built.
-func buildPkgMetadata(vars *types.BuildVars, dirs types.Directories, pkgFormat string, deps []string) (*nfpm.Info, error) {
+// pkgLicense returns the license of a package using the conventions of
+// pkgFormat. Licenses that aren't valid SPDX expressions are joined
+// as-is, since lure lint is responsible for reporting them.
+func pkgLicense(licenses []string, pkgFormat string) string {
+	expr, err := spdx.ParseList(licenses)
+	if err != nil {
+		return strings.Join(licenses, ", ")
+	} else if expr == nil {
+		return ""
+	}
+	return expr.ForFormat(pkgFormat)
+}
+
+// buildPkgMetadata builds the metadata for the package that's going to be built for arch.
+// If keys isn't nil, the package is signed with them.
+func buildPkgMetadata(vars *types.BuildVars, dirs types.Directories, pkgFormat, arch string, deps []string, keys *signing.Keys) (*nfpm.Info, error) {
 	pkgInfo := &nfpm.Info{
 		Name:            vars.Name,
 		Description:     vars.Description,
-		Arch:            cpu.Arch(),
+		Arch:            cpu.BaseArch(arch),
 		Platform:        "linux",
 		Version:         vars.Version,
 		Release:         strconv.Itoa(vars.Release),
 		Homepage:        vars.Homepage,
-		License:         strings.Join(vars.Licenses, ", "),
+		License:         pkgLicense(vars.Licenses, pkgFormat),
 		Maintainer:      vars.Maintainer,
 		DisableGlobbing: true,
-		Overridables: nfpm.Overridables{
-			Conflicts: vars.Conflicts,
-			Replaces:  vars.Replaces,
-			Provides:  vars.Provides,
-			Depends:   deps,
-		},
 	}
 
+	// Version constraints are written differently in each package format
+	var err error
+	pkgInfo.Overridables.Depends, err = formatDeps("deps", deps, pkgFormat)
+	if err != nil {
+		return nil, err
+	}
+	pkgInfo.Overridables.Conflicts, err = formatDeps("conflicts", vars.Conflicts, pkgFormat)
+	if err != nil {
+		return nil, err
+	}
+	pkgInfo.Overridables.Replaces, err = formatDeps("replaces", vars.Replaces, pkgFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	provides := vars.Provides
 	if pkgFormat == "apk" {
 		// Alpine refuses to install packages that provide themselves, so remove any such provides
-		pkgInfo.Overridables.Provides = slices.DeleteFunc(pkgInfo.Overridables.Provides, func(s string) bool {
-			return s == pkgInfo.Name
+		provides = slices.DeleteFunc(slices.Clone(provides), func(s string) bool {
+			return pkgdep.Name(s) == pkgInfo.Name
 		})
 	}
+	pkgInfo.Overridables.Provides, err = formatDeps("provides", provides, pkgFormat)
+	if err != nil {
+		return nil, err
+	}
 
 	if vars.Epoch != 0 {
 		pkgInfo.Epoch = strconv.FormatUint(uint64(vars.Epoch), 10)
 	}
 
 	setScripts(vars, pkgInfo, dirs.ScriptDir)
+	setSignature(pkgInfo, pkgFormat, keys)
 
 	if slices.Contains(vars.Architectures, "all") {
 		pkgInfo.Arch = "all"
@@ -612,9 +902,26 @@ func buildContents(vars *types.BuildVars, dirs types.Directories) ([]*files.Cont
 	return contents, err
 }
 
-// removeBuildDeps asks the user if they'd like to remove the build dependencies that were
-// installed by installBuildDeps. If so, it uses the package manager to do that.
-func removeBuildDeps(ctx context.Context, buildDeps []string, opts types.BuildOpts) error {
+// removeBuildDeps asks the user if they'd like to remove the build dependencies recorded in
+// the journal entry with the given ID. If so, it uses the package manager to do that. Either
+// way, the entry is finished afterwards, since the build dependencies have been dealt with.
+func removeBuildDeps(ctx context.Context, journalID string, opts types.BuildOpts) error {
+	buildDeps, err := journal.Packages(ctx, journalID)
+	if err != nil {
+		return err
+	}
+
+	// Some of the packages may not have been
+	// installed if the installation failed
+	installed, err := opts.Manager.ListInstalled(nil)
+	if err != nil {
+		return err
+	}
+	buildDeps = slices.DeleteFunc(buildDeps, func(name string) bool {
+		_, ok := installed[name]
+		return !ok
+	})
+
 	if len(buildDeps) > 0 {
 		remove, err := cliutils.YesNoPrompt(ctx, "Would you like to remove the build dependencies?", opts.Interactive, false)
 		if err != nil {
@@ -632,15 +939,46 @@ func removeBuildDeps(ctx context.Context, buildDeps []string, opts types.BuildOp
 			if err != nil {
 				return err
 			}
+
+			err = forgetInstalled(ctx, buildDeps)
+			if err != nil {
+				return err
+			}
 		}
 	}
-	return nil
+
+	return journal.Finish(ctx, journalID)
+}
+
+// newlyInstalled returns the names of the packages in after that aren't in before
+func newlyInstalled(before, after map[string]string) []string {
+	var out []string
+	for name := range after {
+		if _, ok := before[name]; !ok {
+			out = append(out, name)
+		}
+	}
+	slices.Sort(out)
+	return out
+}
+
+// warnLeftoverBuildDeps warns the user if there are build dependencies
+// left over from builds that were interrupted
+func warnLeftoverBuildDeps(ctx context.Context) {
+	log := loggerctx.From(ctx)
+
+	leftovers, err := journal.Leftovers(ctx)
+	if err != nil {
+		log.Warn("Error reading the build dependency journal").Err(err).Send()
+	} else if len(leftovers) > 0 {
+		log.Warn("Build dependencies from interrupted builds are still installed, run \"lure cleanup\" to remove them").Int("builds", len(leftovers)).Send()
+	}
 }
 
 // checkForBuiltPackage tries to detect a previously-built package and returns its path
 // and true if it finds one. If it doesn't find it, it returns "", false, nil.
-func checkForBuiltPackage(vars *types.BuildVars, pkgFormat, baseDir string) (string, bool, error) {
-	filename, err := pkgFileName(vars, pkgFormat)
+func checkForBuiltPackage(vars *types.BuildVars, pkgFormat, arch, baseDir string) (string, bool, error) {
+	filename, err := pkgFileName(vars, pkgFormat, arch)
 	if err != nil {
 		return "", false, err
 	}
@@ -657,10 +995,16 @@ func checkForBuiltPackage(vars *types.BuildVars, pkgFormat, baseDir string) (str
 
 // pkgFileName returns the filename of the package if it were to be built.
 // This is used to check if the package has already been built.
-func pkgFileName(vars *types.BuildVars, pkgFormat string) (string, error) {
+func pkgFileName(vars *types.BuildVars, pkgFormat, arch string) (string, error) {
+	// Architecture-independent packages are built with "all",
+	// the same as in buildPkgMetadata
+	if slices.Contains(vars.Architectures, "all") {
+		arch = "all"
+	}
+
 	pkgInfo := &nfpm.Info{
 		Name:    vars.Name,
-		Arch:    cpu.Arch(),
+		Arch:    cpu.BaseArch(arch),
 		Version: vars.Version,
 		Release: strconv.Itoa(vars.Release),
 		Epoch:   strconv.FormatUint(uint64(vars.Epoch), 10),
@@ -685,21 +1029,36 @@ func getPkgFormat(mgr manager.Manager) string {
 }
 
 // createBuildEnvVars creates the environment variables that will be set in the
-// build script when it's executed.
-func createBuildEnvVars(info *distro.OSRelease, dirs types.Directories) []string {
+// build script when it's executed, for a package being built for arch.
+func createBuildEnvVars(info *distro.OSRelease, arch string, dirs types.Directories) []string {
 	env := os.Environ()
 
+	hostArch := cpu.HostArch()
 	env = append(
 		env,
 		"DISTRO_NAME="+info.Name,
 		"DISTRO_PRETTY_NAME="+info.PrettyName,
 		"DISTRO_ID="+info.ID,
 		"DISTRO_VERSION_ID="+info.VersionID,
+		"DISTRO_VERSION_CODENAME="+info.VersionCodename,
 		"DISTRO_ID_LIKE="+strings.Join(info.Like, " "),
-		"ARCH="+cpu.Arch(),
+		"ARCH="+cpu.BaseArch(arch),
+		"ARCH_LEVEL="+cpu.AMD64Level(arch),
+		"HOST_ARCH="+cpu.BaseArch(hostArch),
+		"CARCH="+cpu.Machine(arch),
+		"CHOST="+cpu.Triplet(arch),
+		"CBUILD="+cpu.Triplet(hostArch),
 		"NCPU="+strconv.Itoa(runtime.NumCPU()),
 	)
 
+	// When cross-compiling, CROSS_COMPILE contains the prefix
+	// of the cross toolchain, such as aarch64-linux-gnu-
+	crossCompile := ""
+	if cpu.BaseArch(arch) != cpu.BaseArch(hostArch) && cpu.Triplet(arch) != "" {
+		crossCompile = cpu.Triplet(arch) + "-"
+	}
+	env = append(env, "CROSS_COMPILE="+crossCompile)
+
 	if dirs.ScriptDir != "" {
 		env = append(env, "scriptdir="+dirs.ScriptDir)
 	}
@@ -715,13 +1074,15 @@ func createBuildEnvVars(info *distro.OSRelease, dirs types.Directories) []string
 	return env
 }
 
-// getSources downloads the sources from the script.
-func getSources(ctx context.Context, dirs types.Directories, bv *types.BuildVars) error {
-	log := loggerctx.From(ctx)
+// getSources downloads the sources from the script. It returns the names
+// of the downloaded files and directories inside the source directory,
+// in the same order as the sources.
+func getSources(ctx context.Context, dirs types.Directories, bv *types.BuildVars) ([]string, error) {
 	if len(bv.Sources) != len(bv.Checksums) {
-		log.Fatal("The checksums array must be the same length as sources").Send()
+		return nil, fmt.Errorf("%w: %d sources, %d checksums", ErrChecksumCountMismatch, len(bv.Sources), len(bv.Checksums))
 	}
 
+	names := make([]string, 0, len(bv.Sources))
 	for i, src := range bv.Sources {
 		opts := dl.Options{
 			Name:        fmt.Sprintf("%s[%d]", bv.Name, i),
@@ -729,6 +1090,7 @@ func getSources(ctx context.Context, dirs types.Directories, bv *types.BuildVars
 			Destination: dirs.SrcDir,
 			Progress:    os.Stderr,
 			LocalDir:    dirs.ScriptDir,
+			Offline:     config.Config(ctx).Offline,
 		}
 
 		if !strings.EqualFold(bv.Checksums[i], "SKIP") {
@@ -739,26 +1101,27 @@ func getSources(ctx context.Context, dirs types.Directories, bv *types.BuildVars
 			if ok {
 				checksum, err := hex.DecodeString(hashData)
 				if err != nil {
-					return err
+					return nil, err
 				}
 				opts.Hash = checksum
 				opts.HashAlgorithm = algo
 			} else {
 				checksum, err := hex.DecodeString(bv.Checksums[i])
 				if err != nil {
-					return err
+					return nil, err
 				}
 				opts.Hash = checksum
 			}
 		}
 
-		err := dl.Download(ctx, opts)
+		name, err := dl.Download(ctx, opts)
 		if err != nil {
-			return err
+			return nil, err
 		}
+		names = append(names, name)
 	}
 
-	return nil
+	return names, nil
 }
 
 // setScripts adds any hook scripts to the package metadata.
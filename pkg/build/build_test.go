@@ -0,0 +1,115 @@
+/*
+ * LURE - Linux User REpository
+ * Copyright (C) 2023 Elara Musayelyan
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package build
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sintan1729/lure/internal/config"
+	"github.com/sintan1729/lure/internal/types"
+)
+
+func TestBuildPackageErrors(t *testing.T) {
+	ctx := context.Background()
+
+	paths := config.GetPaths(ctx)
+	oldPkgsDir := paths.PkgsDir
+	paths.PkgsDir = t.TempDir()
+	t.Cleanup(func() { paths.PkgsDir = oldPkgsDir })
+
+	const header = "name=foo\nversion=1.0\nrelease=1\narchitectures=('all')\n"
+
+	type testCase struct {
+		name     string
+		script   string
+		expected error
+		phase    string
+	}
+
+	for _, tc := range []testCase{
+		{
+			name:     "missing package function",
+			script:   "build() { true; }\n",
+			expected: ErrMissingPackageFunc,
+		},
+		{
+			name:     "more sources than checksums",
+			script:   "sources=('https://example.com/a' 'https://example.com/b')\nchecksums=('SKIP')\npackage() { true; }\n",
+			expected: ErrChecksumCountMismatch,
+		},
+		{
+			name:   "failing version",
+			script: "version() { false; }\npackage() { true; }\n",
+			phase:  "version",
+		},
+		{
+			name:   "failing prepare",
+			script: "prepare() { false; }\npackage() { true; }\n",
+			phase:  "prepare",
+		},
+		{
+			name:   "failing build",
+			script: "build() { exit 3; }\npackage() { true; }\n",
+			phase:  "build",
+		},
+		{
+			name:   "failing package",
+			script: "package() { false; }\n",
+			phase:  "package",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			script := filepath.Join(t.TempDir(), "lure.sh")
+			err := os.WriteFile(script, []byte(header+tc.script), 0o644)
+			if err != nil {
+				t.Fatalf("Expected no error, got %s", err)
+			}
+
+			_, _, err = BuildPackage(ctx, types.BuildOpts{
+				Script:  script,
+				Manager: &testManager{},
+				Clean:   true,
+			})
+
+			if tc.phase == "" {
+				if !errors.Is(err, tc.expected) {
+					t.Fatalf("Expected %s, got %v", tc.expected, err)
+				}
+				return
+			}
+
+			var phaseErr *BuildPhaseError
+			if !errors.As(err, &phaseErr) {
+				t.Fatalf("Expected a build phase error, got %v", err)
+			}
+
+			if phaseErr.Phase != tc.phase {
+				t.Errorf("Expected phase %s, got %s", tc.phase, phaseErr.Phase)
+			}
+
+			if phaseErr.Package != "foo" {
+				t.Errorf("Expected package foo, got %s", phaseErr.Package)
+			}
+		})
+	}
+}
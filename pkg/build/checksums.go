@@ -0,0 +1,350 @@
+/*
+ * LURE - Linux User REpository
+ * Copyright (C) 2023 Elara Musayelyan
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package build
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/sintan1729/lure/internal/config"
+	"github.com/sintan1729/lure/internal/cpu"
+	"github.com/sintan1729/lure/internal/dl"
+	"github.com/sintan1729/lure/pkg/distro"
+	"github.com/sintan1729/lure/pkg/loggerctx"
+	"mvdan.cc/sh/v3/expand"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// ChecksumMismatch describes an entry in a checksums array
+// that doesn't match the checksum of its source
+type ChecksumMismatch struct {
+	// Var is the name of the checksums array, such as checksums_amd64
+	Var   string
+	Index int
+	// Source is empty if the checksums array has
+	// more entries than the sources array
+	Source string
+	// Expected is empty if the checksums array has
+	// fewer entries than the sources array
+	Expected string
+	// Actual is empty if the checksums array has
+	// more entries than the sources array
+	Actual string
+}
+
+// scriptAssign is a top-level variable assignment in a build script
+type scriptAssign struct {
+	stmt   *syntax.Stmt
+	assign *syntax.Assign
+}
+
+// scriptEdit is a replacement of a range of bytes in a build script
+type scriptEdit struct {
+	start, end uint
+	text       string
+}
+
+// UpdateChecksums downloads the sources in the build script at script and
+// computes their checksums. Each override variant of the sources array, such
+// as sources_amd64, is checked against the checksums array with the same
+// suffix. Each checksum is computed with the algorithm already used by its
+// entry, or sha256 if there is none, and SKIP entries are left alone.
+//
+// Unless check is set, the checksums arrays are then rewritten in place. Only
+// the arrays themselves are replaced, so the formatting and comments in the
+// rest of the script are kept. It returns all the entries that didn't match.
+func UpdateChecksums(ctx context.Context, script string, check bool) ([]ChecksumMismatch, error) {
+	log := loggerctx.From(ctx)
+
+	data, err := os.ReadFile(script)
+	if err != nil {
+		return nil, err
+	}
+
+	fl, err := syntax.NewParser(syntax.KeepComments(true)).Parse(bytes.NewReader(data), "lure.sh")
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := distro.ParseOSRelease(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	runner, err := runFirstPass(ctx, info, cpu.Arch(), fl, script)
+	if err != nil {
+		return nil, err
+	}
+
+	sources, checksums := findChecksumAssigns(fl)
+
+	scriptDir, err := filepath.Abs(filepath.Dir(script))
+	if err != nil {
+		return nil, err
+	}
+
+	tmpDir, err := os.MkdirTemp("", "lure-updsums-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// Sources are often shared between override variants,
+	// so only download each of them once per algorithm
+	computed := map[string]string{}
+
+	var mismatches []ChecksumMismatch
+	var edits []scriptEdit
+	for _, src := range sources {
+		srcName := src.assign.Name.Value
+		sumsName := "checksums" + strings.TrimPrefix(srcName, "sources")
+
+		urls := varList(runner.Vars[srcName])
+		oldSums := varList(runner.Vars[sumsName])
+		newSums := make([]string, len(urls))
+
+		var varMismatches []ChecksumMismatch
+		for i, u := range urls {
+			var old string
+			if i < len(oldSums) {
+				old = oldSums[i]
+			}
+
+			if strings.EqualFold(old, "SKIP") {
+				newSums[i] = old
+				continue
+			}
+
+			algo, _, ok := strings.Cut(old, ":")
+			if !ok {
+				algo = ""
+			}
+
+			key := algo + "\x00" + u
+			sum, ok := computed[key]
+			if !ok {
+				log.Info("Computing checksum").Str("source", fmt.Sprintf("%s[%d]", srcName, i)).Send()
+
+				sum, err = computeChecksum(ctx, u, algo, scriptDir, tmpDir)
+				if errors.Is(err, dl.ErrNoChecksum) {
+					log.Warn("Checksums can't be computed for this source, using SKIP").Str("source", u).Send()
+					sum = "SKIP"
+				} else if err != nil {
+					return nil, err
+				}
+				computed[key] = sum
+			}
+			newSums[i] = sum
+
+			if !strings.EqualFold(old, sum) {
+				varMismatches = append(varMismatches, ChecksumMismatch{
+					Var:      sumsName,
+					Index:    i,
+					Source:   u,
+					Expected: old,
+					Actual:   sum,
+				})
+			}
+		}
+
+		for i := len(urls); i < len(oldSums); i++ {
+			varMismatches = append(varMismatches, ChecksumMismatch{
+				Var:      sumsName,
+				Index:    i,
+				Expected: oldSums[i],
+			})
+		}
+
+		mismatches = append(mismatches, varMismatches...)
+		if check || len(varMismatches) == 0 {
+			continue
+		}
+
+		edit, err := checksumEdit(data, src, checksums[sumsName], sumsName, newSums)
+		if err != nil {
+			return nil, err
+		}
+		edits = append(edits, edit)
+	}
+
+	if check || len(edits) == 0 {
+		return mismatches, nil
+	}
+
+	// Apply the edits from the end of the file to the start,
+	// so that the offsets of the remaining edits stay valid
+	slices.SortFunc(edits, func(a, b scriptEdit) int {
+		return int(b.start) - int(a.start)
+	})
+	for _, edit := range edits {
+		data = slices.Concat(data[:edit.start], []byte(edit.text), data[edit.end:])
+	}
+
+	fi, err := os.Stat(script)
+	if err != nil {
+		return nil, err
+	}
+
+	return mismatches, os.WriteFile(script, data, fi.Mode().Perm())
+}
+
+// findChecksumAssigns finds the top-level assignments to the sources
+// and checksums arrays and all of their override variants. If a
+// variable is assigned more than once, the last assignment is used.
+func findChecksumAssigns(fl *syntax.File) (sources []scriptAssign, checksums map[string]scriptAssign) {
+	checksums = map[string]scriptAssign{}
+	for _, stmt := range fl.Stmts {
+		call, ok := stmt.Cmd.(*syntax.CallExpr)
+		if !ok || len(call.Args) > 0 {
+			continue
+		}
+
+		for _, assign := range call.Assigns {
+			if assign.Name == nil {
+				continue
+			}
+			name := assign.Name.Value
+
+			switch {
+			case name == "sources" || strings.HasPrefix(name, "sources_"):
+				sources = slices.DeleteFunc(sources, func(sa scriptAssign) bool {
+					return sa.assign.Name.Value == name
+				})
+				sources = append(sources, scriptAssign{stmt, assign})
+			case name == "checksums" || strings.HasPrefix(name, "checksums_"):
+				checksums[name] = scriptAssign{stmt, assign}
+			}
+		}
+	}
+	return sources, checksums
+}
+
+// computeChecksum downloads the source at u and returns its checksum in
+// the format used in build scripts. If algo is empty, sha256 is used
+// and the checksum isn't prefixed with the algorithm.
+func computeChecksum(ctx context.Context, u, algo, scriptDir, tmpDir string) (string, error) {
+	dest, err := os.MkdirTemp(tmpDir, "src-*")
+	if err != nil {
+		return "", err
+	}
+
+	sum, err := dl.Checksum(ctx, dl.Options{
+		HashAlgorithm: algo,
+		URL:           u,
+		Destination:   dest,
+		Progress:      os.Stderr,
+		LocalDir:      scriptDir,
+		Offline:       config.Config(ctx).Offline,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if algo == "" {
+		return hex.EncodeToString(sum), nil
+	}
+	return algo + ":" + hex.EncodeToString(sum), nil
+}
+
+// checksumEdit returns the edit that sets the checksums array called name
+// to sums. If the array isn't assigned in the script, a new assignment is
+// added after the assignment of the matching sources array.
+func checksumEdit(data []byte, src scriptAssign, sums scriptAssign, name string, values []string) (scriptEdit, error) {
+	if sums.assign == nil {
+		end := src.stmt.End().Offset()
+		return scriptEdit{
+			start: end,
+			end:   end,
+			text:  "\n" + name + "=" + formatArray(data, src.assign.Array, values),
+		}, nil
+	}
+
+	if sums.assign.Array == nil {
+		return scriptEdit{}, fmt.Errorf("%s must be an array", name)
+	}
+
+	return scriptEdit{
+		start: sums.assign.Array.Pos().Offset(),
+		end:   sums.assign.Array.End().Offset(),
+		text:  formatArray(data, sums.assign.Array, values),
+	}, nil
+}
+
+// formatArray formats values as a bash array, using the same quotes and
+// layout as the existing array arr. If arr spans multiple lines, each value
+// is put on its own line with the same indentation as arr's first element.
+func formatArray(data []byte, arr *syntax.ArrayExpr, values []string) string {
+	quote := "'"
+	if arr != nil && len(arr.Elems) > 0 && arr.Elems[0].Value != nil && len(arr.Elems[0].Value.Parts) > 0 {
+		if _, ok := arr.Elems[0].Value.Parts[0].(*syntax.DblQuoted); ok {
+			quote = `"`
+		}
+	}
+
+	quoted := make([]string, len(values))
+	for i, val := range values {
+		quoted[i] = quote + val + quote
+	}
+
+	if arr == nil || arr.Lparen.Line() == arr.Rparen.Line() {
+		return "(" + strings.Join(quoted, " ") + ")"
+	}
+
+	indent := lineIndent(data, arr.Rparen) + "\t"
+	if len(arr.Elems) > 0 {
+		indent = lineIndent(data, arr.Elems[0].Pos())
+	}
+
+	var sb strings.Builder
+	sb.WriteString("(\n")
+	for _, q := range quoted {
+		sb.WriteString(indent)
+		sb.WriteString(q)
+		sb.WriteString("\n")
+	}
+	sb.WriteString(lineIndent(data, arr.Rparen))
+	sb.WriteString(")")
+	return sb.String()
+}
+
+// lineIndent returns the whitespace at the start of the line containing pos
+func lineIndent(data []byte, pos syntax.Pos) string {
+	lineStart := pos.Offset() - (pos.Col() - 1)
+	line := data[lineStart:pos.Offset()]
+	return string(line[:len(line)-len(bytes.TrimLeft(line, " \t"))])
+}
+
+// varList returns the values of a variable as a list
+func varList(v expand.Variable) []string {
+	switch v.Kind {
+	case expand.Indexed:
+		return v.List
+	case expand.String:
+		return []string{v.Str}
+	default:
+		return nil
+	}
+}
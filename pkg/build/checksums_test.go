@@ -0,0 +1,160 @@
+/*
+ * LURE - Linux User REpository
+ * Copyright (C) 2023 Elara Musayelyan
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package build_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sintan1729/lure/pkg/build"
+)
+
+// writeChecksumScript writes a build script and the local
+// sources a.txt and b.txt it can use into a temporary directory
+func writeChecksumScript(t *testing.T, script string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, content := range map[string]string{"a.txt": "a", "b.txt": "b", "lure.sh": script} {
+		err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644)
+		if err != nil {
+			t.Fatalf("Expected no error, got %s", err)
+		}
+	}
+	return filepath.Join(dir, "lure.sh")
+}
+
+func TestUpdateChecksums(t *testing.T) {
+	sha256sum := func(s string) string {
+		sum := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(sum[:])
+	}
+	sha512sum := func(s string) string {
+		sum := sha512.Sum512([]byte(s))
+		return hex.EncodeToString(sum[:])
+	}
+	replacer := strings.NewReplacer(
+		"{A}", sha256sum("a"),
+		"{B}", sha256sum("b"),
+		"{B512}", sha512sum("b"),
+	)
+
+	type testCase struct {
+		script     string
+		expected   string
+		mismatches int
+	}
+
+	tests := map[string]testCase{
+		"single line": {
+			script:     "sources=('local:///a.txt' 'local:///b.txt')\nchecksums=('x' 'y') # sums\n",
+			expected:   "sources=('local:///a.txt' 'local:///b.txt')\nchecksums=('{A}' '{B}') # sums\n",
+			mismatches: 2,
+		},
+		"multiple lines": {
+			script:     "sources=(\n\t'local:///a.txt'\n\t'local:///b.txt'\n)\nchecksums=(\n    'x'\n    'y'\n)\n",
+			expected:   "sources=(\n\t'local:///a.txt'\n\t'local:///b.txt'\n)\nchecksums=(\n    '{A}'\n    '{B}'\n)\n",
+			mismatches: 2,
+		},
+		"double quotes": {
+			script:     "sources=(\"local:///a.txt\")\nchecksums=(\"x\")\n",
+			expected:   "sources=(\"local:///a.txt\")\nchecksums=(\"{A}\")\n",
+			mismatches: 1,
+		},
+		"skip and algorithm": {
+			script:     "sources=('local:///a.txt' 'local:///b.txt')\nchecksums=('SKIP' 'sha512:00')\n",
+			expected:   "sources=('local:///a.txt' 'local:///b.txt')\nchecksums=('SKIP' 'sha512:{B512}')\n",
+			mismatches: 1,
+		},
+		"overrides": {
+			script:     "sources=('local:///a.txt')\nchecksums=('{A}')\nsources_amd64=('local:///b.txt')\nchecksums_amd64=('x')\n",
+			expected:   "sources=('local:///a.txt')\nchecksums=('{A}')\nsources_amd64=('local:///b.txt')\nchecksums_amd64=('{B}')\n",
+			mismatches: 1,
+		},
+		"missing checksums": {
+			script:     "sources=('local:///a.txt')\n# comment\nsources_arm64=('local:///b.txt')\n",
+			expected:   "sources=('local:///a.txt')\nchecksums=('{A}')\n# comment\nsources_arm64=('local:///b.txt')\nchecksums_arm64=('{B}')\n",
+			mismatches: 2,
+		},
+		"extra checksums": {
+			script:     "sources=('local:///a.txt')\nchecksums=('{A}' 'y')\n",
+			expected:   "sources=('local:///a.txt')\nchecksums=('{A}')\n",
+			mismatches: 1,
+		},
+		"up to date": {
+			script:     "sources=('local:///a.txt')\nchecksums=( '{A}' )\n",
+			expected:   "sources=('local:///a.txt')\nchecksums=( '{A}' )\n",
+			mismatches: 0,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			script := writeChecksumScript(t, replacer.Replace(tc.script))
+
+			mismatches, err := build.UpdateChecksums(context.Background(), script, false)
+			if err != nil {
+				t.Fatalf("Expected no error, got %s", err)
+			}
+
+			if len(mismatches) != tc.mismatches {
+				t.Errorf("Expected %d mismatches, got %v", tc.mismatches, mismatches)
+			}
+
+			data, err := os.ReadFile(script)
+			if err != nil {
+				t.Fatalf("Expected no error, got %s", err)
+			}
+
+			expected := replacer.Replace(tc.expected)
+			if string(data) != expected {
+				t.Errorf("Expected script:\n%s\ngot:\n%s", expected, data)
+			}
+		})
+	}
+}
+
+func TestUpdateChecksumsCheck(t *testing.T) {
+	const script = "sources=('local:///a.txt')\nchecksums=('x')\n"
+	path := writeChecksumScript(t, script)
+
+	mismatches, err := build.UpdateChecksums(context.Background(), path, true)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	if len(mismatches) != 1 || mismatches[0].Var != "checksums" || mismatches[0].Expected != "x" {
+		t.Errorf("Expected a mismatch for checksums[0], got %v", mismatches)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	if string(data) != script {
+		t.Errorf("Expected the script to be left untouched, got:\n%s", data)
+	}
+}
@@ -0,0 +1,204 @@
+/*
+ * LURE - Linux User REpository
+ * Copyright (C) 2023 Elara Musayelyan
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package build
+
+import (
+	"strings"
+	"time"
+
+	"github.com/sintan1729/lure/internal/config"
+)
+
+// cdxBOM is a CycloneDX 1.5 JSON document
+type cdxBOM struct {
+	BOMFormat    string         `json:"bomFormat"`
+	SpecVersion  string         `json:"specVersion"`
+	SerialNumber string         `json:"serialNumber"`
+	Version      int            `json:"version"`
+	Metadata     cdxMetadata    `json:"metadata"`
+	Components   []cdxComponent `json:"components,omitempty"`
+}
+
+type cdxMetadata struct {
+	Timestamp string       `json:"timestamp"`
+	Tools     cdxTools     `json:"tools"`
+	Component cdxComponent `json:"component"`
+}
+
+type cdxTools struct {
+	Components []cdxComponent `json:"components"`
+}
+
+type cdxComponent struct {
+	BOMRef             string           `json:"bom-ref,omitempty"`
+	Type               string           `json:"type"`
+	Name               string           `json:"name"`
+	Version            string           `json:"version,omitempty"`
+	Description        string           `json:"description,omitempty"`
+	Author             string           `json:"author,omitempty"`
+	Scope              string           `json:"scope,omitempty"`
+	Hashes             []cdxHash        `json:"hashes,omitempty"`
+	Licenses           []cdxLicense     `json:"licenses,omitempty"`
+	ExternalReferences []cdxExternalRef `json:"externalReferences,omitempty"`
+	Properties         []cdxProperty    `json:"properties,omitempty"`
+}
+
+type cdxHash struct {
+	Alg     string `json:"alg"`
+	Content string `json:"content"`
+}
+
+type cdxLicense struct {
+	Expression string `json:"expression"`
+}
+
+type cdxExternalRef struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+type cdxProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// cycloneDXDocument converts info into a CycloneDX document. Sources, build
+// dependencies and the files in the package are listed as components. Anything
+// CycloneDX has no field for is recorded as a property in the lure namespace.
+func cycloneDXDocument(info *sbomInfo) cdxBOM {
+	vars := info.Vars
+
+	pkg := cdxComponent{
+		BOMRef:      vars.Name + "@" + fullVersion(vars),
+		Type:        "application",
+		Name:        vars.Name,
+		Version:     fullVersion(vars),
+		Description: vars.Description,
+		Author:      vars.Maintainer,
+		Properties: []cdxProperty{
+			{"lure:architecture", info.Arch},
+		},
+	}
+
+	if info.License != nil {
+		pkg.Licenses = []cdxLicense{{info.License.ForFormat("spdx")}}
+	} else if len(vars.Licenses) > 0 {
+		pkg.Properties = append(pkg.Properties, cdxProperty{"lure:license", strings.Join(vars.Licenses, ", ")})
+	}
+
+	if vars.Homepage != "" {
+		pkg.ExternalReferences = append(pkg.ExternalReferences, cdxExternalRef{"website", vars.Homepage})
+	}
+
+	if info.Repo != "" {
+		pkg.Properties = append(pkg.Properties, cdxProperty{"lure:repository", info.Repo})
+	}
+	if info.RepoCommit != "" {
+		pkg.Properties = append(pkg.Properties, cdxProperty{"lure:repository-commit", info.RepoCommit})
+	}
+
+	lists := []struct {
+		name   string
+		values []string
+	}{
+		{"lure:depends", vars.Depends},
+		{"lure:opt-depends", vars.OptDepends},
+		{"lure:provides", vars.Provides},
+		{"lure:conflicts", vars.Conflicts},
+		{"lure:replaces", vars.Replaces},
+	}
+	for _, list := range lists {
+		for _, value := range list.values {
+			pkg.Properties = append(pkg.Properties, cdxProperty{list.name, value})
+		}
+	}
+
+	bom := cdxBOM{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.5",
+		SerialNumber: "urn:uuid:" + info.Serial,
+		Version:      1,
+		Metadata: cdxMetadata{
+			Timestamp: info.Created.Format(time.RFC3339),
+			Tools: cdxTools{
+				Components: []cdxComponent{{Type: "application", Name: "lure", Version: config.Version}},
+			},
+			Component: pkg,
+		},
+	}
+
+	for _, src := range info.Sources {
+		comp := cdxComponent{
+			Type: "file",
+			Name: src.Name,
+			Properties: []cdxProperty{
+				{"lure:source", "true"},
+			},
+		}
+
+		if src.Revision != "" {
+			comp.Version = src.Revision
+			comp.ExternalReferences = []cdxExternalRef{{"vcs", src.URL}}
+		} else {
+			comp.ExternalReferences = []cdxExternalRef{{"distribution", src.URL}}
+		}
+
+		if src.Checksum != "" {
+			if alg := sbomHashAlgos[src.Algorithm].cdx; alg != "" {
+				comp.Hashes = []cdxHash{{alg, src.Checksum}}
+			} else {
+				comp.Properties = append(comp.Properties, cdxProperty{"lure:checksum", src.Algorithm + ":" + src.Checksum})
+			}
+		}
+
+		bom.Components = append(bom.Components, comp)
+	}
+
+	for _, dep := range info.BuildDeps {
+		comp := cdxComponent{
+			Type:    "application",
+			Name:    dep.Name,
+			Version: dep.Version,
+			// Build dependencies aren't part of the package
+			Scope: "excluded",
+			Properties: []cdxProperty{
+				{"lure:build-dependency", "true"},
+			},
+		}
+
+		if dep.Installed {
+			comp.Properties = append(comp.Properties, cdxProperty{"lure:installed-for-build", "true"})
+		}
+
+		bom.Components = append(bom.Components, comp)
+	}
+
+	for _, file := range info.Files {
+		bom.Components = append(bom.Components, cdxComponent{
+			Type: "file",
+			Name: file.Path,
+			Hashes: []cdxHash{
+				{"SHA-1", file.SHA1},
+				{"SHA-256", file.SHA256},
+			},
+		})
+	}
+
+	return bom
+}
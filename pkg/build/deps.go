@@ -0,0 +1,170 @@
+/*
+ * LURE - Linux User REpository
+ * Copyright (C) 2023 Elara Musayelyan
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package build
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/sintan1729/lure/internal/pkgdep"
+	"github.com/sintan1729/lure/pkg/manager"
+	"github.com/sintan1729/lure/pkg/repos"
+)
+
+// parseRelation parses the entry s of the relationship field, such as
+// deps or provides. Only dependencies can have alternatives, and only
+// exact versions are allowed in provides, since that's all that
+// package managers support.
+func parseRelation(field, s string) (pkgdep.Alternatives, error) {
+	alts, err := pkgdep.ParseAlternatives(s)
+	if err != nil {
+		return nil, err
+	}
+
+	switch field {
+	case "deps", "build_deps", "opt_deps":
+	default:
+		if len(alts) > 1 {
+			return nil, fmt.Errorf("%w: %q: alternatives aren't allowed in %s", pkgdep.ErrInvalidDep, s, field)
+		}
+	}
+
+	if field == "provides" && alts[0].Op != "" && alts[0].Op != "=" {
+		return nil, fmt.Errorf("%w: %q: only exact versions are allowed in provides", pkgdep.ErrInvalidDep, s)
+	}
+
+	return alts, nil
+}
+
+// formatDeps converts the entries of the relationship field, which may
+// have version constraints and alternatives, such as foo>=1.2 | bar,
+// to the syntax used by pkgFormat.
+func formatDeps(field string, deps []string, pkgFormat string) ([]string, error) {
+	out := make([]string, 0, len(deps))
+	for _, s := range deps {
+		alts, err := parseRelation(field, s)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, alts.Format(pkgFormat))
+	}
+	return out, nil
+}
+
+// resolveAlternatives chooses which alternative of each dependency is used
+// and moves it to the front, so that the others are kept in the package
+// metadata. The first alternative that's already installed is chosen.
+// If none are, the first one that's in the LURE repos is chosen, and
+// then the first one that's available from the system repos. If none of
+// them are available either, the dependency is left as it is.
+func resolveAlternatives(ctx context.Context, deps []string, installed map[string]string, mgr manager.Manager) ([]string, error) {
+	out := make([]string, len(deps))
+	for i, s := range deps {
+		out[i] = s
+
+		alts, err := pkgdep.ParseAlternatives(s)
+		if err != nil || len(alts) < 2 {
+			continue
+		}
+
+		j, err := chooseAlternative(ctx, alts, installed, mgr)
+		if err != nil {
+			return nil, err
+		}
+
+		if j > 0 {
+			chosen := alts[j]
+			alts = append(pkgdep.Alternatives{chosen}, slices.Delete(alts, j, j+1)...)
+			out[i] = alts.String()
+		}
+	}
+	return out, nil
+}
+
+// chooseAlternative returns the index of the alternative in alts
+// that should be used, as described in resolveAlternatives
+func chooseAlternative(ctx context.Context, alts pkgdep.Alternatives, installed map[string]string, mgr manager.Manager) (int, error) {
+	for i, alt := range alts {
+		version, ok := installed[alt.Name]
+		if ok && alt.SatisfiedBy(pkgdep.ParseVersion(version)) {
+			return i, nil
+		}
+	}
+
+	for i, alt := range alts {
+		found, _, err := repos.FindPkgs(ctx, []string{alt.String()})
+		if err != nil {
+			return 0, err
+		}
+
+		if len(found) > 0 {
+			return i, nil
+		}
+	}
+
+	for i, alt := range alts {
+		ok, err := mgr.IsAvailable(alt.Name)
+		if err != nil {
+			return 0, err
+		}
+
+		if ok {
+			return i, nil
+		}
+	}
+
+	return 0, nil
+}
+
+// chosenDeps returns the chosen alternative of each of the dependencies
+// returned by resolveAlternatives, so that packages are only looked up
+// and installed using the alternative that was chosen.
+func chosenDeps(deps []string) []string {
+	out := make([]string, len(deps))
+	for i, s := range deps {
+		alts, err := pkgdep.ParseAlternatives(s)
+		if err != nil {
+			out[i] = s
+			continue
+		}
+		out[i] = alts[0].String()
+	}
+	return out
+}
+
+// withConstraints replaces each of the names with the entry of depends
+// that refers to the same package, so that version constraints on
+// LURE dependencies are kept in the package metadata.
+func withConstraints(names, depends []string) []string {
+	constraints := map[string]string{}
+	for _, dep := range depends {
+		constraints[pkgdep.Name(dep)] = dep
+	}
+
+	out := make([]string, len(names))
+	for i, name := range names {
+		if dep, ok := constraints[name]; ok {
+			out[i] = dep
+		} else {
+			out[i] = name
+		}
+	}
+	return out
+}
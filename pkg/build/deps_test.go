@@ -0,0 +1,167 @@
+/*
+ * LURE - Linux User REpository
+ * Copyright (C) 2023 Elara Musayelyan
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package build
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/sintan1729/lure/internal/db"
+	"github.com/sintan1729/lure/internal/types"
+	"github.com/sintan1729/lure/pkg/manager"
+	"github.com/sintan1729/lure/pkg/repos"
+)
+
+// testManager is a package manager with fixed installed and available
+// packages, which records the packages it's asked to install
+type testManager struct {
+	installed map[string]string
+	available []string
+	installs  []string
+}
+
+func (*testManager) Name() string                                { return "test" }
+func (*testManager) Format() string                              { return "deb" }
+func (*testManager) Exists() bool                                { return true }
+func (*testManager) SetRootCmd(string)                           {}
+func (*testManager) Sync(*manager.Opts) error                    { return nil }
+func (*testManager) Remove(*manager.Opts, ...string) error       { return nil }
+func (*testManager) Upgrade(*manager.Opts, ...string) error      { return nil }
+func (*testManager) InstallLocal(*manager.Opts, ...string) error { return nil }
+func (*testManager) UpgradeAll(*manager.Opts) error              { return nil }
+
+func (m *testManager) Install(_ *manager.Opts, pkgs ...string) error {
+	m.installs = append(m.installs, pkgs...)
+	return nil
+}
+
+func (m *testManager) IsAvailable(name string) (bool, error) {
+	return slices.Contains(m.available, name), nil
+}
+
+func (m *testManager) ListInstalled(*manager.Opts) (map[string]string, error) {
+	return m.installed, nil
+}
+
+// openTestDB opens an in-memory database containing LURE
+// packages with the given names, each at version 2.0
+func openTestDB(t *testing.T, names ...string) {
+	t.Helper()
+	ctx := context.Background()
+
+	_, err := db.Open(ctx, ":memory:")
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	for _, name := range names {
+		err = db.InsertPackage(ctx, db.Package{
+			Name:       name,
+			Version:    "2.0",
+			Release:    1,
+			Repository: "default",
+		})
+		if err != nil {
+			t.Fatalf("Expected no error, got %s", err)
+		}
+	}
+}
+
+func TestResolveAlternatives(t *testing.T) {
+	openTestDB(t, "lure-a", "lure-b")
+
+	mgr := &testManager{
+		installed: map[string]string{"inst-a": "1.0", "inst-b": "2.0"},
+		available: []string{"native-a", "native-b"},
+	}
+
+	tests := map[string]string{
+		"foo>=1.0":                             "foo>=1.0",
+		"missing | other":                      "missing | other",
+		"missing | inst-b":                     "inst-b | missing",
+		"missing | inst-a>=2.0 | inst-b":       "inst-b | missing | inst-a>=2.0",
+		"lure-a | inst-a":                      "inst-a | lure-a",
+		"missing | lure-a | lure-b":            "lure-a | missing | lure-b",
+		"lure-a>=3.0 | lure-b>=2.0":            "lure-b>=2.0 | lure-a>=3.0",
+		"native-a | lure-b":                    "lure-b | native-a",
+		"missing | native-b | native-a":        "native-b | missing | native-a",
+		"missing | native-b | inst-a | lure-a": "inst-a | missing | native-b | lure-a",
+	}
+
+	for dep, expected := range tests {
+		resolved, err := resolveAlternatives(context.Background(), []string{dep}, mgr.installed, mgr)
+		if err != nil {
+			t.Fatalf("Expected no error, got %s", err)
+		}
+
+		if resolved[0] != expected {
+			t.Errorf("Expected %q for %q, got %q", expected, dep, resolved[0])
+		}
+	}
+}
+
+func TestChosenDeps(t *testing.T) {
+	deps := []string{"foo>=1.0", "bar | baz", "qux<2 | quux"}
+	expected := []string{"foo>=1.0", "bar", "qux<2"}
+
+	if chosen := chosenDeps(deps); !reflect.DeepEqual(chosen, expected) {
+		t.Errorf("Expected %v, got %v", expected, chosen)
+	}
+}
+
+func TestFindPkgsAlternatives(t *testing.T) {
+	openTestDB(t, "lure-a", "lure-b")
+	ctx := context.Background()
+
+	found, notFound, err := repos.FindPkgs(ctx, []string{"missing | lure-a>=3.0 | lure-b", "missing | other"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	pkgs := found["missing | lure-a>=3.0 | lure-b"]
+	if len(pkgs) != 1 || pkgs[0].Name != "lure-b" {
+		t.Errorf("Expected lure-b to be found, got %v", pkgs)
+	}
+
+	if !reflect.DeepEqual(notFound, []string{"missing | other"}) {
+		t.Errorf("Expected only the dependency without LURE packages to be missing, got %v", notFound)
+	}
+}
+
+func TestInstallPkgsAlternatives(t *testing.T) {
+	openTestDB(t)
+
+	mgr := &testManager{
+		installed: map[string]string{"inst-a": "1.0"},
+		available: []string{"native-b"},
+	}
+
+	err := InstallPkgs(context.Background(), nil, []string{"missing | native-b", "native-b | inst-a", "plain>=1.0"}, types.BuildOpts{Manager: mgr})
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	expected := []string{"native-b", "inst-a", "plain"}
+	if !reflect.DeepEqual(mgr.installs, expected) {
+		t.Errorf("Expected %v to be installed, got %v", expected, mgr.installs)
+	}
+}
@@ -0,0 +1,160 @@
+/*
+ * LURE - Linux User REpository
+ * Copyright (C) 2023 Elara Musayelyan
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package build
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/sintan1729/lure/internal/cliutils"
+	"github.com/sintan1729/lure/internal/config"
+	"github.com/sintan1729/lure/internal/osutils"
+	"github.com/sintan1729/lure/internal/types"
+	"github.com/sintan1729/lure/pkg/distro"
+	"github.com/sintan1729/lure/pkg/loggerctx"
+	"github.com/sintan1729/lure/pkg/repos"
+)
+
+// FetchSources downloads the sources of the given build scripts into
+// the download cache, without building anything. If opts.Destination
+// is set, the sources of each package are also copied into a directory
+// named after the package inside it. If opts.Deps is set, the sources of
+// all the LURE dependencies are fetched as well. Only the restricted first
+// pass of each script is executed, so overrides are resolved for the
+// distro and architecture in opts, which default to the current ones.
+func FetchSources(ctx context.Context, opts types.FetchOpts) error {
+	log := loggerctx.From(ctx)
+
+	host, err := distro.ParseOSRelease(ctx)
+	if err != nil {
+		return err
+	}
+	info := getTargetDistro(host, opts.Distro)
+
+	arch, err := getTargetArch(opts.TargetArch)
+	if err != nil {
+		return err
+	}
+
+	// The sources are hard-linked from the cache, so the temporary
+	// destination has to be on the same filesystem as the cache.
+	tmpDir, err := os.MkdirTemp(config.GetPaths(ctx).CacheDir, "fetch-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	seen := map[string]bool{}
+	queue := opts.Scripts
+	for len(queue) > 0 {
+		script := queue[0]
+		queue = queue[1:]
+
+		if seen[script] {
+			continue
+		}
+		seen[script] = true
+
+		fl, err := parseScript(script)
+		if err != nil {
+			return err
+		}
+
+		vars, err := executeFirstPass(ctx, info, arch, fl, script)
+		if err != nil {
+			return err
+		}
+
+		log.Info("Fetching sources").Str("name", vars.Name).Send()
+
+		dirs := getDirs(ctx, vars, script)
+		dirs.SrcDir, err = os.MkdirTemp(tmpDir, vars.Name+"-*")
+		if err != nil {
+			return err
+		}
+
+		_, err = getSources(ctx, dirs, vars)
+		if err != nil {
+			return err
+		}
+
+		if opts.Destination != "" {
+			err = copySources(dirs.SrcDir, filepath.Join(opts.Destination, vars.Name))
+			if err != nil {
+				return err
+			}
+		}
+
+		deps := slices.Concat(vars.Depends, vars.BuildDepends)
+		if !opts.Deps || len(deps) == 0 {
+			continue
+		}
+
+		found, _, err := repos.FindPkgs(ctx, deps)
+		if err != nil {
+			return err
+		}
+
+		pkgs, err := cliutils.FlattenPkgs(ctx, found, "fetch", opts.Interactive)
+		if err != nil {
+			return err
+		}
+		queue = append(queue, GetScriptPaths(ctx, pkgs)...)
+	}
+
+	return nil
+}
+
+// copySources copies the sources in srcDir to dest, replacing anything that
+// was already there. The files in srcDir are hard links into the download
+// cache, so they're copied rather than moved, to make sure that changes
+// made in dest don't affect the cache. The sources are copied into a
+// temporary directory first, so that dest is never left incomplete.
+func copySources(srcDir, dest string) error {
+	err := os.MkdirAll(filepath.Dir(dest), 0o755)
+	if err != nil {
+		return err
+	}
+
+	tmpDest, err := os.MkdirTemp(filepath.Dir(dest), "."+filepath.Base(dest)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDest)
+
+	// MkdirTemp creates the directory with restrictive permissions
+	err = os.Chmod(tmpDest, 0o755)
+	if err != nil {
+		return err
+	}
+
+	err = osutils.Copy(srcDir, tmpDest)
+	if err != nil {
+		return err
+	}
+
+	err = os.RemoveAll(dest)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmpDest, dest)
+}
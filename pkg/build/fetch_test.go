@@ -0,0 +1,221 @@
+/*
+ * LURE - Linux User REpository
+ * Copyright (C) 2023 Elara Musayelyan
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package build_test
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sintan1729/lure/internal/config"
+	"github.com/sintan1729/lure/internal/cpu"
+	"github.com/sintan1729/lure/internal/dlcache"
+	"github.com/sintan1729/lure/internal/types"
+	"github.com/sintan1729/lure/pkg/build"
+)
+
+func init() {
+	dir, err := os.MkdirTemp("/tmp", "lure-build-test.*")
+	if err != nil {
+		panic(err)
+	}
+
+	paths := config.GetPaths(context.Background())
+	paths.CacheDir = dir
+	paths.RepoDir = filepath.Join(dir, "repo")
+	paths.PkgsDir = filepath.Join(dir, "pkgs")
+	paths.StateDir = filepath.Join(dir, "state")
+}
+
+func TestFetchSourcesTwice(t *testing.T) {
+	ctx := context.Background()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer srv.Close()
+
+	scriptDir := t.TempDir()
+	script := filepath.Join(scriptDir, "lure.sh")
+	err := os.WriteFile(script, []byte(`name=fetchtest
+version=1.0
+release=1
+architectures=('all')
+sources=('`+srv.URL+`/hello.txt')
+checksums=('SKIP')
+`), 0o644)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	dest := filepath.Join(t.TempDir(), "out")
+	opts := types.FetchOpts{
+		Scripts:     []string{script},
+		Destination: dest,
+	}
+
+	// Fetching into the same destination a second time used
+	// to truncate the cached source, since the destination
+	// was a hard link to it
+	for range 2 {
+		err = build.FetchSources(ctx, opts)
+		if err != nil {
+			t.Fatalf("Expected no error, got %s", err)
+		}
+	}
+
+	destFile := filepath.Join(dest, "fetchtest", "hello.txt")
+	data, err := os.ReadFile(destFile)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	if string(data) != "hello" {
+		t.Errorf("Expected %q in the destination, got %q", "hello", data)
+	}
+
+	var cached []string
+	err = filepath.WalkDir(dlcache.BasePath(ctx), func(path string, d fs.DirEntry, err error) error {
+		if err == nil && d.Name() == "hello.txt" {
+			cached = append(cached, path)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	if len(cached) != 1 {
+		t.Fatalf("Expected one cache entry, got %v", cached)
+	}
+
+	data, err = os.ReadFile(cached[0])
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	if string(data) != "hello" {
+		t.Errorf("Expected %q in the cache, got %q", "hello", data)
+	}
+
+	destInfo, err := os.Stat(destFile)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	cacheInfo, err := os.Stat(cached[0])
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	if os.SameFile(destInfo, cacheInfo) {
+		t.Error("Expected the destination not to be a hard link to the cache")
+	}
+}
+
+func TestFetchSourcesTarget(t *testing.T) {
+	ctx := context.Background()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer srv.Close()
+
+	scriptDir := t.TempDir()
+	script := filepath.Join(scriptDir, "lure.sh")
+	err := os.WriteFile(script, []byte(`name=fetchtarget
+version=1.0
+release=1
+architectures=('all')
+# The distros are made up, so that the host's distro doesn't match them
+sources=('`+srv.URL+`/generic.txt')
+checksums=('SKIP')
+sources_arm64=('`+srv.URL+`/arm64.txt')
+checksums_arm64=('SKIP')
+sources_testos=('`+srv.URL+`/testos.txt')
+checksums_testos=('SKIP')
+sources_arm64_testos_2_1=('`+srv.URL+`/arm64-testos-2.1.txt')
+checksums_arm64_testos_2_1=('SKIP')
+sources_testos_stable=('`+srv.URL+`/testos-stable.txt')
+checksums_testos_stable=('SKIP')
+`), 0o644)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	type testCase struct {
+		name       string
+		targetArch string
+		distro     string
+		expected   string
+	}
+
+	hostExpected := "generic.txt"
+	if cpu.Arch() == "arm64" {
+		hostExpected = "arm64.txt"
+	}
+
+	tests := []testCase{
+		{name: "host", expected: hostExpected},
+		{name: "arch", targetArch: "arm64", expected: "arm64.txt"},
+		{name: "arch alias", targetArch: "aarch64", expected: "arm64.txt"},
+		{name: "distro", distro: "testos", expected: "testos.txt"},
+		{name: "distro and arch", targetArch: "arm64", distro: "testos", expected: "testos.txt"},
+		{name: "distro version and arch", targetArch: "arm64", distro: "testos:2.1", expected: "arm64-testos-2.1.txt"},
+		{name: "other distro version", distro: "testos:2.2", expected: "testos.txt"},
+		{name: "distro codename", distro: "testos:stable", expected: "testos-stable.txt"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			dest := t.TempDir()
+			err := build.FetchSources(ctx, types.FetchOpts{
+				Scripts:     []string{script},
+				Destination: dest,
+				TargetArch:  tc.targetArch,
+				Distro:      tc.distro,
+			})
+			if err != nil {
+				t.Fatalf("Expected no error, got %s", err)
+			}
+
+			entries, err := os.ReadDir(filepath.Join(dest, "fetchtarget"))
+			if err != nil {
+				t.Fatalf("Expected no error, got %s", err)
+			}
+
+			if len(entries) != 1 || entries[0].Name() != tc.expected {
+				t.Errorf("Expected only %s to be fetched, got %v", tc.expected, entries)
+			}
+		})
+	}
+
+	err = build.FetchSources(ctx, types.FetchOpts{
+		Scripts:    []string{script},
+		TargetArch: "not-an-arch",
+	})
+	if !errors.Is(err, build.ErrInvalidArch) {
+		t.Errorf("Expected ErrInvalidArch, got %v", err)
+	}
+}
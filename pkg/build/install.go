@@ -21,26 +21,67 @@ package build
 import (
 	"context"
 	"path/filepath"
+	"slices"
+	"strings"
 
 	"github.com/sintan1729/lure/internal/config"
 	"github.com/sintan1729/lure/internal/db"
+	"github.com/sintan1729/lure/internal/installed"
+	"github.com/sintan1729/lure/internal/pkgdep"
 	"github.com/sintan1729/lure/internal/types"
-	"github.com/sintan1729/lure/pkg/loggerctx"
+	"github.com/sintan1729/lure/pkg/manager"
 )
 
 // InstallPkgs installs native packages via the package manager,
 // then builds and installs the LURE packages
-func InstallPkgs(ctx context.Context, lurePkgs []db.Package, nativePkgs []string, opts types.BuildOpts) {
-	log := loggerctx.From(ctx)
-
+func InstallPkgs(ctx context.Context, lurePkgs []db.Package, nativePkgs []string, opts types.BuildOpts) error {
 	if len(nativePkgs) > 0 {
-		err := opts.Manager.Install(nil, nativePkgs...)
+		names, err := nativeNames(ctx, nativePkgs, opts.Manager)
+		if err != nil {
+			return err
+		}
+
+		err = opts.Manager.Install(nil, names...)
+		if err != nil {
+			return err
+		}
+	}
+
+	scripts := GetScriptPaths(ctx, lurePkgs)
+	for i, pkg := range lurePkgs {
+		err := installScript(ctx, scripts[i], pkg.Name, opts)
 		if err != nil {
-			log.Fatal("Error installing native packages").Err(err).Send()
+			return err
 		}
 	}
 
-	InstallScripts(ctx, GetScriptPaths(ctx, lurePkgs), opts)
+	return nil
+}
+
+// nativeNames returns the names of the packages that have to be installed
+// from the system repos for deps. Package managers can't install packages
+// by version constraint or choose between alternatives, so for each
+// dependency, only the name of the alternative that's chosen is returned.
+func nativeNames(ctx context.Context, deps []string, mgr manager.Manager) ([]string, error) {
+	var installed map[string]string
+	if slices.ContainsFunc(deps, func(dep string) bool { return strings.Contains(dep, "|") }) {
+		var err error
+		installed, err = mgr.ListInstalled(nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	resolved, err := resolveAlternatives(ctx, deps, installed, mgr)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, len(resolved))
+	for i, dep := range resolved {
+		names[i] = pkgdep.Name(dep)
+	}
+	return names, nil
 }
 
 // GetScriptPaths returns a slice of script paths corresponding to the
@@ -54,19 +95,57 @@ func GetScriptPaths(ctx context.Context, pkgs []db.Package) []string {
 	return scripts
 }
 
-// InstallScripts builds and installs the given LURE build scripts
-func InstallScripts(ctx context.Context, scripts []string, opts types.BuildOpts) {
-	log := loggerctx.From(ctx)
+// InstallScripts builds and installs the given LURE build scripts.
+// Like in GetScriptPaths, each script must be in a directory named
+// after its package.
+func InstallScripts(ctx context.Context, scripts []string, opts types.BuildOpts) error {
 	for _, script := range scripts {
-		opts.Script = script
-		builtPkgs, _, err := BuildPackage(ctx, opts)
+		err := installScript(ctx, script, filepath.Base(filepath.Dir(script)), opts)
 		if err != nil {
-			log.Fatal("Error building package").Err(err).Send()
+			return err
 		}
+	}
+	return nil
+}
 
-		err = opts.Manager.InstallLocal(nil, builtPkgs...)
-		if err != nil {
-			log.Fatal("Error installing package").Err(err).Send()
+// installScript builds and installs the build script for the package called
+// name, along with its LURE dependencies, and records them as installed
+func installScript(ctx context.Context, script, name string, opts types.BuildOpts) error {
+	// Packages that are going to be installed are only
+	// needed in the system's package format and architecture
+	opts.Formats = nil
+	opts.TargetArch = ""
+	opts.Script = script
+
+	builtPkgs, builtNames, err := BuildPackage(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	err = opts.Manager.InstallLocal(nil, builtPkgs...)
+	if err != nil {
+		return err
+	}
+
+	return recordInstalled(ctx, name, builtNames, opts.AsDeps)
+}
+
+// recordInstalled records the packages that were installed by building
+// the script for the package called name. Only that package is recorded
+// as explicitly installed, unless asDeps is set, and the other names are
+// recorded as its dependencies.
+func recordInstalled(ctx context.Context, name string, names []string, asDeps bool) error {
+	pkgs := []installed.Package{{Name: name, Dependency: asDeps}}
+	for _, depName := range names {
+		if depName != name {
+			pkgs = append(pkgs, installed.Package{Name: depName, Dependency: true})
 		}
 	}
+
+	return installed.Add(ctx, pkgs...)
+}
+
+// forgetInstalled removes the given packages from the record of installed packages
+func forgetInstalled(ctx context.Context, names []string) error {
+	return installed.Remove(ctx, names...)
 }
@@ -0,0 +1,59 @@
+/*
+ * LURE - Linux User REpository
+ * Copyright (C) 2023 Elara Musayelyan
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package build
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/sintan1729/lure/internal/installed"
+)
+
+func TestRecordInstalled(t *testing.T) {
+	ctx := context.Background()
+	t.Cleanup(func() { installed.Remove(ctx, "app", "lib", "tool", "tool-lib") })
+
+	// The explicit package doesn't have to be the last name
+	err := recordInstalled(ctx, "app", []string{"app", "lib"}, false)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	err = recordInstalled(ctx, "tool", []string{"tool-lib", "app", "tool"}, true)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	record, err := installed.Packages(ctx)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	expected := map[string]installed.Package{
+		// Packages that were installed explicitly stay that way
+		"app":      {Name: "app"},
+		"lib":      {Name: "lib", Dependency: true},
+		"tool":     {Name: "tool", Dependency: true},
+		"tool-lib": {Name: "tool-lib", Dependency: true},
+	}
+	if !reflect.DeepEqual(record, expected) {
+		t.Errorf("Expected %v, got %v", expected, record)
+	}
+}
@@ -0,0 +1,452 @@
+/*
+ * LURE - Linux User REpository
+ * Copyright (C) 2023 Elara Musayelyan
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package build
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/sintan1729/lure/internal/cpu"
+	"github.com/sintan1729/lure/internal/shutils/decoder"
+	"github.com/sintan1729/lure/internal/shutils/helpers"
+	"github.com/sintan1729/lure/internal/spdx"
+	"github.com/sintan1729/lure/internal/types"
+	"github.com/sintan1729/lure/pkg/distro"
+	"mvdan.cc/sh/v3/interp"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// Severities of lint issues
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// LintIssue is a problem found in a build script by Lint
+type LintIssue struct {
+	Script string `json:"script"`
+	// Line is zero if the issue isn't
+	// related to a specific line
+	Line     uint   `json:"line,omitempty"`
+	Check    string `json:"check"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+func (li LintIssue) String() string {
+	if li.Line == 0 {
+		return fmt.Sprintf("%s: %s: %s (%s)", li.Script, li.Severity, li.Message, li.Check)
+	}
+	return fmt.Sprintf("%s:%d: %s: %s (%s)", li.Script, li.Line, li.Severity, li.Message, li.Check)
+}
+
+// scriptFuncs contains the names of the functions LURE calls in build scripts
+var scriptFuncs = []string{"prepare", "version", "build", "package"}
+
+// linter contains the state for linting a single build script
+type linter struct {
+	script string
+	fl     *syntax.File
+	runner *interp.Runner
+	// lines contains the line of the last top-level
+	// assignment to each variable
+	lines  map[string]uint
+	issues []LintIssue
+}
+
+// Lint statically checks the build script at script for common mistakes.
+// Only the restricted first pass of the script is executed. Problems with
+// the script itself, including syntax errors, are returned as issues. An
+// error is only returned if the script couldn't be checked at all.
+func Lint(ctx context.Context, script string) ([]LintIssue, error) {
+	l := &linter{script: script, lines: map[string]uint{}}
+
+	fl, err := parseScript(script)
+	if err != nil {
+		var perr syntax.ParseError
+		if errors.As(err, &perr) {
+			l.add(perr.Pos.Line(), "syntax", SeverityError, perr.Text)
+			return l.issues, nil
+		}
+		return nil, err
+	}
+	l.fl = fl
+
+	info, err := distro.ParseOSRelease(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	l.runner, err = runFirstPass(ctx, info, cpu.Arch(), fl, script)
+	if err != nil {
+		l.add(0, "first-pass", SeverityError, "error running script: "+err.Error())
+		return l.issues, nil
+	}
+
+	for _, stmt := range fl.Stmts {
+		if call, ok := stmt.Cmd.(*syntax.CallExpr); ok && len(call.Args) == 0 {
+			for _, assign := range call.Assigns {
+				if assign.Name != nil {
+					l.lines[assign.Name.Value] = assign.Pos().Line()
+				}
+			}
+		}
+	}
+
+	l.checkRequiredVars(info)
+	l.checkChecksums()
+	l.checkArchitectures()
+	l.checkOverrideSuffixes()
+	l.checkPackageFunc()
+	l.checkCommands()
+	l.checkLicenses()
+	l.checkDeps()
+
+	sort.SliceStable(l.issues, func(i, j int) bool {
+		return l.issues[i].Line < l.issues[j].Line
+	})
+
+	return l.issues, nil
+}
+
+func (l *linter) add(line uint, check, severity, msg string) {
+	l.issues = append(l.issues, LintIssue{
+		Script:   l.script,
+		Line:     line,
+		Check:    check,
+		Severity: severity,
+		Message:  msg,
+	})
+}
+
+// variants returns the names of all the set variables that are
+// either name itself or an override of it, such as name_amd64.
+func (l *linter) variants(name string) []string {
+	var out []string
+	for varName := range l.runner.Vars {
+		if varName == name || (strings.HasPrefix(varName, name+"_") && baseName(varName) == name) {
+			out = append(out, varName)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// checkRequiredVars makes sure all the required variables are set and
+// all the variables can be decoded into the types LURE expects.
+func (l *linter) checkRequiredVars(info *distro.OSRelease) {
+	for _, name := range buildVarNames(true) {
+		if len(l.variants(name)) == 0 {
+			l.add(0, "required-var", SeverityError, fmt.Sprintf("required variable %q is not set", name))
+		}
+	}
+
+	var vars types.BuildVars
+	err := decoder.New(info, l.runner).DecodeVars(&vars)
+	if err != nil && !errors.As(err, &decoder.VarNotFoundError{}) {
+		l.add(0, "invalid-var", SeverityError, err.Error())
+	}
+}
+
+// checkChecksums makes sure every sources array has a checksums
+// array of the same length.
+func (l *linter) checkChecksums() {
+	sources, _ := findChecksumAssigns(l.fl)
+	for _, src := range sources {
+		srcName := src.assign.Name.Value
+		sumsName := "checksums" + strings.TrimPrefix(srcName, "sources")
+		line := src.assign.Pos().Line()
+
+		sums, ok := l.runner.Vars[sumsName]
+		if !ok {
+			// Builds fall back to the base checksums array
+			// if there's no override for it
+			sumsName = "checksums"
+			sums, ok = l.runner.Vars[sumsName]
+		}
+
+		if !ok {
+			l.add(line, "checksums", SeverityError, fmt.Sprintf("%s is set, but there's no checksums array", srcName))
+			continue
+		}
+
+		numSources := len(varList(l.runner.Vars[srcName]))
+		numSums := len(varList(sums))
+		if numSources != numSums {
+			if sumsLine, ok := l.lines[sumsName]; ok {
+				line = sumsLine
+			}
+			l.add(line, "checksums", SeverityError, fmt.Sprintf("%s has %d entries, but %s has %d", srcName, numSources, sumsName, numSums))
+		}
+	}
+}
+
+// checkArchitectures makes sure all the values in
+// the architectures arrays are known to LURE.
+func (l *linter) checkArchitectures() {
+	for _, name := range l.variants("architectures") {
+		for _, arch := range varList(l.runner.Vars[name]) {
+			if cpu.IsKnown(arch) {
+				continue
+			}
+
+			msg := fmt.Sprintf("unknown architecture %q in %s", arch, name)
+			if suggestion, ok := cpu.Suggest(arch); ok {
+				msg += fmt.Sprintf(", use %q instead", suggestion)
+			}
+			l.add(l.lines[name], "architecture", SeverityError, msg)
+		}
+	}
+}
+
+// checkOverrideSuffixes makes sure the suffixes of override
+// variables and functions are in the order LURE checks them in,
+// which is the architecture, then the distro, then the language.
+func (l *linter) checkOverrideSuffixes() {
+	check := func(name string, line uint) {
+		base := baseName(name)
+		if base == "" || base == name {
+			return
+		}
+
+		suffix := strings.TrimPrefix(name, base+"_")
+		parts := strings.Split(suffix, "_")
+
+		// Some architecture names, such as x86_64, contain underscores
+		if len(parts) > 1 {
+			if suggestion, ok := cpu.Suggest(parts[0] + "_" + parts[1]); ok {
+				l.add(line, "override", SeverityWarning, fmt.Sprintf("override %s uses architecture %q, which LURE calls %q", name, parts[0]+"_"+parts[1], suggestion))
+				return
+			}
+		}
+
+		for i, part := range parts {
+			if part == "" {
+				l.add(line, "override", SeverityError, fmt.Sprintf("override %s contains an empty suffix", name))
+				return
+			}
+
+			if i > 0 && cpu.IsKnown(part) {
+				l.add(line, "override", SeverityError, fmt.Sprintf("the architecture must be the first suffix of override %s", name))
+				return
+			}
+
+			if suggestion, ok := cpu.Suggest(part); ok && i == 0 {
+				l.add(line, "override", SeverityWarning, fmt.Sprintf("override %s uses architecture %q, which LURE calls %q", name, part, suggestion))
+				return
+			}
+		}
+	}
+
+	names := make([]string, 0, len(l.lines))
+	for name := range l.lines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		check(name, l.lines[name])
+	}
+
+	for name, fn := range l.runner.Funcs {
+		check(name, fn.Pos().Line())
+	}
+}
+
+// checkPackageFunc makes sure the script has a package function
+func (l *linter) checkPackageFunc() {
+	for name := range l.runner.Funcs {
+		if name == "package" || baseName(name) == "package" {
+			return
+		}
+	}
+	l.add(0, "package-func", SeverityError, "the package() function is missing")
+}
+
+// checkCommands checks every command in the script for calls to helper
+// commands that don't exist, and for unquoted uses of $pkgdir and $srcdir,
+// which break if the directories contain spaces.
+func (l *linter) checkCommands() {
+	syntax.Walk(l.fl, func(node syntax.Node) bool {
+		call, ok := node.(*syntax.CallExpr)
+		if !ok || len(call.Args) == 0 {
+			return true
+		}
+
+		l.checkHelper(call)
+
+		for _, word := range call.Args {
+			for _, part := range word.Parts {
+				pe, ok := part.(*syntax.ParamExp)
+				if !ok || pe.Param == nil {
+					continue
+				}
+
+				if pe.Param.Value == "pkgdir" || pe.Param.Value == "srcdir" {
+					l.add(word.Pos().Line(), "quoting", SeverityWarning, fmt.Sprintf("$%s should be quoted", pe.Param.Value))
+				}
+			}
+		}
+
+		return true
+	})
+}
+
+// checkHelper checks if the command called by call has a name close to
+// a helper command's, but isn't one. Commands that also start with the
+// same prefix as the helper, such as "install-", are almost certainly
+// typos, so they're reported as errors, and the others as warnings.
+// Other commands with a helper's prefix, such as install-info or
+// git-lfs, are real programs, so they aren't reported.
+func (l *linter) checkHelper(call *syntax.CallExpr) {
+	cmd := call.Args[0].Lit()
+	if cmd == "" {
+		return
+	}
+
+	_, isHelper := helpers.Helpers[cmd]
+	_, isFunc := l.runner.Funcs[cmd]
+	if isHelper || isFunc {
+		return
+	}
+
+	var closest string
+	closestDist := maxHelperTypoDistance + 1
+	for _, name := range slices.Sorted(maps.Keys(helpers.Helpers)) {
+		if dist := editDistance(cmd, name); dist < closestDist {
+			closest, closestDist = name, dist
+		}
+	}
+
+	if closest == "" {
+		return
+	}
+
+	prefix, _, _ := strings.Cut(closest, "-")
+	if strings.HasPrefix(cmd, prefix+"-") {
+		l.add(call.Pos().Line(), "helper", SeverityError, fmt.Sprintf("unknown helper command %q, did you mean %q?", cmd, closest))
+	} else {
+		l.add(call.Pos().Line(), "helper", SeverityWarning, fmt.Sprintf("command %q is not a helper command, did you mean %q?", cmd, closest))
+	}
+}
+
+// maxHelperTypoDistance is the largest edit distance between a command
+// and the name of a helper command for it to be considered a typo
+const maxHelperTypoDistance = 2
+
+// editDistance returns the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+
+	return prev[len(b)]
+}
+
+// checkLicenses makes sure all the licenses are valid SPDX
+// expressions that don't use deprecated identifiers
+func (l *linter) checkLicenses() {
+	if _, ok := l.runner.Vars["licenses"]; ok && len(l.variants("license")) == 0 {
+		l.add(l.lines["licenses"], "license", SeverityWarning, "licenses is not used by LURE, did you mean license?")
+	}
+
+	for _, name := range l.variants("license") {
+		for _, license := range varList(l.runner.Vars[name]) {
+			expr, err := spdx.Parse(license)
+			if err != nil {
+				l.add(l.lines[name], "license", SeverityError, fmt.Sprintf("invalid license %q: %s", license, err))
+				continue
+			}
+
+			for _, id := range expr.Deprecated() {
+				l.add(l.lines[name], "license", SeverityWarning, fmt.Sprintf("license identifier %q is deprecated", id))
+			}
+		}
+	}
+}
+
+// checkDeps makes sure all the package relationships are valid, that
+// only dependencies have alternatives, and that provides only use
+// exact version constraints
+func (l *linter) checkDeps() {
+	for _, base := range []string{"deps", "build_deps", "opt_deps", "provides", "conflicts", "replaces"} {
+		for _, name := range l.variants(base) {
+			for _, s := range varList(l.runner.Vars[name]) {
+				// Optional dependencies may have a description after ": "
+				if base == "opt_deps" {
+					s, _, _ = strings.Cut(s, ": ")
+				}
+
+				_, err := parseRelation(base, s)
+				if err != nil {
+					l.add(l.lines[name], "dependency", SeverityError, err.Error())
+				}
+			}
+		}
+	}
+}
+
+// baseName returns the name of the LURE variable or function that name
+// is an override of. For example, it returns "build_deps" for
+// "build_deps_amd64_arch". It returns an empty string if name
+// isn't an override of anything LURE uses.
+func baseName(name string) string {
+	var out string
+	for _, base := range slices.Concat(buildVarNames(false), scriptFuncs) {
+		if (name == base || strings.HasPrefix(name, base+"_")) && len(base) > len(out) {
+			out = base
+		}
+	}
+	return out
+}
+
+// buildVarNames returns the names of the variables in BuildVars.
+// If required is set, only the required ones are returned.
+func buildVarNames(required bool) []string {
+	var out []string
+	t := reflect.TypeOf(types.BuildVars{})
+	for i := 0; i < t.NumField(); i++ {
+		name, opts, _ := strings.Cut(t.Field(i).Tag.Get("sh"), ",")
+		if name == "" || (required && !slices.Contains(strings.Split(opts, ","), "required")) {
+			continue
+		}
+		out = append(out, name)
+	}
+	return out
+}
@@ -0,0 +1,138 @@
+/*
+ * LURE - Linux User REpository
+ * Copyright (C) 2023 Elara Musayelyan
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package build_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/sintan1729/lure/pkg/build"
+)
+
+// lintHeader sets all the required variables, so
+// that each test only has to add what it checks
+const lintHeader = `name=foo
+version=1.0
+release=1
+architectures=('all')
+license=('MIT')
+`
+
+// lintFinding is the part of a lint issue that's checked by the tests
+type lintFinding struct {
+	Line     uint
+	Check    string
+	Severity string
+}
+
+func TestLint(t *testing.T) {
+	tests := map[string]struct {
+		script   string
+		expected []lintFinding
+	}{
+		"valid": {
+			script: lintHeader + "package() {\n\tinstall-binary foo\n}\n",
+		},
+		"syntax error": {
+			script:   lintHeader + "package() {\n",
+			expected: []lintFinding{{6, "syntax", build.SeverityError}},
+		},
+		"missing required variable": {
+			script:   "name=foo\nversion=1.0\narchitectures=('all')\nlicense=('MIT')\npackage() { true; }\n",
+			expected: []lintFinding{{0, "required-var", build.SeverityError}},
+		},
+		"missing package function": {
+			script:   lintHeader + "build() { true; }\n",
+			expected: []lintFinding{{0, "package-func", build.SeverityError}},
+		},
+		"checksums length": {
+			script:   lintHeader + "sources=('a' 'b')\nchecksums=('SKIP')\npackage() { true; }\n",
+			expected: []lintFinding{{7, "checksums", build.SeverityError}},
+		},
+		"missing checksums": {
+			script:   lintHeader + "sources=('a')\npackage() { true; }\n",
+			expected: []lintFinding{{6, "checksums", build.SeverityError}},
+		},
+		"unknown architecture": {
+			script:   lintHeader + "architectures=('x86_64')\npackage() { true; }\n",
+			expected: []lintFinding{{6, "architecture", build.SeverityError}},
+		},
+		"override order": {
+			script:   lintHeader + "deps_arch_amd64=('bar')\npackage() { true; }\n",
+			expected: []lintFinding{{6, "override", build.SeverityError}},
+		},
+		"unknown helper with helper prefix": {
+			script:   lintHeader + "package() {\n\tinstall-binray foo\n\tgit-versions\n}\n",
+			expected: []lintFinding{{7, "helper", build.SeverityError}, {8, "helper", build.SeverityError}},
+		},
+		"helper typo": {
+			script:   lintHeader + "package() {\n\tinstal-binary foo\n\tmake install\n}\n",
+			expected: []lintFinding{{7, "helper", build.SeverityWarning}},
+		},
+		"program with helper prefix": {
+			script: lintHeader + "package() {\n\tinstall-info foo.info\n\tgit-lfs pull\n\tinstall -Dm755 foo \"$pkgdir/usr/bin/foo\"\n}\n",
+		},
+		"function with helper prefix": {
+			script: lintHeader + "install-extra() { true; }\npackage() {\n\tinstall-extra\n}\n",
+		},
+		"unquoted pkgdir": {
+			script:   lintHeader + "package() {\n\tmkdir -p $pkgdir/usr\n}\n",
+			expected: []lintFinding{{7, "quoting", build.SeverityWarning}},
+		},
+		"invalid license": {
+			script:   lintHeader + "license=('GPLv3')\npackage() { true; }\n",
+			expected: []lintFinding{{6, "license", build.SeverityError}},
+		},
+		"deprecated license": {
+			script:   lintHeader + "license=('GPL-3.0')\npackage() { true; }\n",
+			expected: []lintFinding{{6, "license", build.SeverityWarning}},
+		},
+		"alternatives in provides": {
+			script:   lintHeader + "provides=('a | b')\npackage() { true; }\n",
+			expected: []lintFinding{{6, "dependency", build.SeverityError}},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			script := filepath.Join(t.TempDir(), "lure.sh")
+			err := os.WriteFile(script, []byte(tc.script), 0o644)
+			if err != nil {
+				t.Fatalf("Expected no error, got %s", err)
+			}
+
+			issues, err := build.Lint(context.Background(), script)
+			if err != nil {
+				t.Fatalf("Expected no error, got %s", err)
+			}
+
+			var found []lintFinding
+			for _, issue := range issues {
+				found = append(found, lintFinding{issue.Line, issue.Check, issue.Severity})
+			}
+
+			if !reflect.DeepEqual(found, tc.expected) {
+				t.Errorf("Expected %v, got %v", tc.expected, issues)
+			}
+		})
+	}
+}
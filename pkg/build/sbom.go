@@ -0,0 +1,352 @@
+/*
+ * LURE - Linux User REpository
+ * Copyright (C) 2023 Elara Musayelyan
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package build
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/google/uuid"
+	"github.com/sintan1729/lure/internal/config"
+	"github.com/sintan1729/lure/internal/pkgdep"
+	"github.com/sintan1729/lure/internal/spdx"
+	"github.com/sintan1729/lure/internal/types"
+	"github.com/sintan1729/lure/pkg/manager"
+)
+
+// SBOM formats
+const (
+	SBOMCycloneDX = "cyclonedx"
+	SBOMSPDX      = "spdx"
+)
+
+// SBOMFormats contains all the supported SBOM formats
+var SBOMFormats = []string{SBOMCycloneDX, SBOMSPDX}
+
+// ErrUnknownSBOMFormat is returned by BuildPackage if the
+// requested SBOM format isn't supported
+var ErrUnknownSBOMFormat = errors.New("unknown SBOM format")
+
+// sbomInfo contains everything that's recorded
+// in the software bill of materials of a package
+type sbomInfo struct {
+	Vars *types.BuildVars
+	// License is nil if the package doesn't have
+	// any licenses or they aren't valid SPDX expressions
+	License *spdx.Expression
+	Arch    string
+
+	// Repo and RepoCommit are empty if the
+	// build script isn't in a LURE repo
+	Repo       string
+	RepoCommit string
+
+	Sources   []sbomSource
+	BuildDeps []sbomBuildDep
+	Files     []sbomFile
+
+	Serial  string
+	Created time.Time
+}
+
+type sbomSource struct {
+	// URL is the URL of the source, without any credentials
+	URL string
+	// Name is the name of the downloaded file or directory
+	Name string
+	// Algorithm and Checksum are empty if the checksum was skipped
+	Algorithm string
+	Checksum  string
+	// Revision is the commit that was checked out for git sources
+	Revision string
+}
+
+type sbomBuildDep struct {
+	Name    string
+	Version string
+	// Installed is set if the dependency wasn't
+	// installed before the build started
+	Installed bool
+}
+
+type sbomFile struct {
+	// Path is the absolute path of the file once the package is installed
+	Path   string
+	SHA1   string
+	SHA256 string
+}
+
+// sbomHashAlgos maps checksum algorithms to their names in
+// CycloneDX and SPDX documents. Algorithms that one of the
+// formats doesn't support have an empty name.
+var sbomHashAlgos = map[string]struct{ cdx, spdx string }{
+	"md5":         {"MD5", "MD5"},
+	"sha1":        {"SHA-1", "SHA1"},
+	"sha224":      {"", "SHA224"},
+	"sha256":      {"SHA-256", "SHA256"},
+	"sha384":      {"SHA-384", "SHA384"},
+	"sha512":      {"SHA-512", "SHA512"},
+	"blake2b-256": {"BLAKE2b-256", "BLAKE2b-256"},
+	"blake2b-512": {"BLAKE2b-512", "BLAKE2b-512"},
+}
+
+// getSBOMFormat returns the SBOM format requested in opts,
+// falling back to the one in the config. It returns an
+// empty string if no SBOM should be written.
+func getSBOMFormat(ctx context.Context, opts types.BuildOpts) (string, error) {
+	format := opts.SBOM
+	if format == "" {
+		format = config.Config(ctx).SBOM
+	}
+
+	switch format {
+	case "", SBOMCycloneDX, SBOMSPDX:
+		return format, nil
+	default:
+		return "", fmt.Errorf("%w: %s", ErrUnknownSBOMFormat, format)
+	}
+}
+
+// SBOMPath returns the path of the SBOM in the given
+// format for the package at pkgPath
+func SBOMPath(pkgPath, format string) string {
+	if format == SBOMSPDX {
+		return pkgPath + ".spdx.json"
+	}
+	return pkgPath + ".cdx.json"
+}
+
+// collectSBOM gathers the information for the SBOM of a package that's
+// just been built. srcNames contains the names returned by getSources,
+// and before and after contain the packages that were installed before
+// and after the build dependencies were installed.
+func collectSBOM(ctx context.Context, vars *types.BuildVars, dirs types.Directories, script, arch string, srcNames, buildDeps []string, before, after map[string]string, mgr manager.Manager) (*sbomInfo, error) {
+	info := &sbomInfo{
+		Vars:    vars,
+		Arch:    arch,
+		Serial:  uuid.NewString(),
+		Created: time.Now().UTC(),
+	}
+
+	// Invalid licenses are reported by lure lint,
+	// so they're just left out of the SBOM
+	info.License, _ = spdx.ParseList(vars.Licenses)
+
+	var err error
+	info.Repo, info.RepoCommit, err = scriptRepo(ctx, script)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, src := range vars.Sources {
+		source := sbomSource{
+			URL:  redactURL(src),
+			Name: srcNames[i],
+		}
+
+		if !strings.EqualFold(vars.Checksums[i], "SKIP") {
+			algo, sum, ok := strings.Cut(vars.Checksums[i], ":")
+			if !ok {
+				algo, sum = "sha256", vars.Checksums[i]
+			}
+			source.Algorithm = algo
+			source.Checksum = strings.ToLower(sum)
+		}
+
+		if strings.HasPrefix(src, "git+") {
+			source.Revision, err = gitRevision(filepath.Join(dirs.SrcDir, srcNames[i]))
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		info.Sources = append(info.Sources, source)
+	}
+
+	// Build dependencies may have version constraints and alternatives,
+	// so they're recorded by the name of the alternative that was used
+	buildDepends, err := resolveAlternatives(ctx, vars.BuildDepends, before, mgr)
+	if err != nil {
+		return nil, err
+	}
+
+	// vars.BuildDepends may contain names provided by other
+	// packages, so the names of the LURE packages that were
+	// actually installed are added as well
+	for _, dep := range slices.Concat(chosenDeps(buildDepends), buildDeps) {
+		name := pkgdep.Name(dep)
+		if slices.ContainsFunc(info.BuildDeps, func(dep sbomBuildDep) bool { return dep.Name == name }) {
+			continue
+		}
+
+		_, wasInstalled := before[name]
+		version, isInstalled := after[name]
+		info.BuildDeps = append(info.BuildDeps, sbomBuildDep{
+			Name:      name,
+			Version:   version,
+			Installed: isInstalled && !wasInstalled,
+		})
+	}
+
+	info.Files, err = hashPkgFiles(dirs.PkgDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+// writeSBOM writes the SBOM described by info to path, in the given format
+func writeSBOM(path, format string, info *sbomInfo) error {
+	var doc any
+	switch format {
+	case SBOMCycloneDX:
+		doc = cycloneDXDocument(info)
+	case SBOMSPDX:
+		doc = spdxDocument(info)
+	default:
+		return fmt.Errorf("%w: %s", ErrUnknownSBOMFormat, format)
+	}
+
+	fl, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer fl.Close()
+
+	enc := json.NewEncoder(fl)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+// scriptRepo returns the name of the LURE repo that contains the build
+// script at script, along with the commit that's checked out in it. It
+// returns empty strings if the script isn't inside a repo.
+func scriptRepo(ctx context.Context, script string) (name, commit string, err error) {
+	repoDir := config.GetPaths(ctx).RepoDir
+
+	script, err = filepath.Abs(script)
+	if err != nil {
+		return "", "", err
+	}
+
+	rel, err := filepath.Rel(repoDir, script)
+	if err != nil || !filepath.IsLocal(rel) {
+		return "", "", nil
+	}
+
+	name, _, _ = strings.Cut(filepath.ToSlash(rel), "/")
+	commit, err = gitRevision(filepath.Join(repoDir, name))
+	if errors.Is(err, git.ErrRepositoryNotExists) {
+		return name, "", nil
+	}
+	return name, commit, err
+}
+
+// gitRevision returns the commit that's checked out in the git repo at dir
+func gitRevision(dir string) (string, error) {
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return "", err
+	}
+
+	head, err := r.Head()
+	if err != nil {
+		return "", err
+	}
+
+	return head.Hash().String(), nil
+}
+
+// hashPkgFiles returns all the regular files in pkgDir along with
+// their hashes, sorted by path
+func hashPkgFiles(pkgDir string) ([]sbomFile, error) {
+	var out []sbomFile
+	err := filepath.WalkDir(pkgDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		fl, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer fl.Close()
+
+		sha1Hash, sha256Hash := sha1.New(), sha256.New()
+		_, err = io.Copy(io.MultiWriter(sha1Hash, sha256Hash), fl)
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(pkgDir, path)
+		if err != nil {
+			return err
+		}
+
+		out = append(out, sbomFile{
+			Path:   "/" + filepath.ToSlash(rel),
+			SHA1:   hex.EncodeToString(sha1Hash.Sum(nil)),
+			SHA256: hex.EncodeToString(sha256Hash.Sum(nil)),
+		})
+		return nil
+	})
+	return out, err
+}
+
+// redactURL removes any credentials from a source URL,
+// so they don't end up in the SBOM
+func redactURL(src string) string {
+	u, err := url.Parse(src)
+	if err != nil || u.User == nil {
+		return src
+	}
+	u.User = nil
+	return u.String()
+}
+
+// fullVersion returns the full version of the package, including
+// the epoch if there is one and the release
+func fullVersion(vars *types.BuildVars) string {
+	version := vars.Version + "-" + strconv.Itoa(vars.Release)
+	if vars.Epoch != 0 {
+		version = strconv.FormatUint(uint64(vars.Epoch), 10) + ":" + version
+	}
+	return version
+}
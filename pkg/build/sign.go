@@ -0,0 +1,118 @@
+/*
+ * LURE - Linux User REpository
+ * Copyright (C) 2023 Elara Musayelyan
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package build
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+
+	"github.com/goreleaser/nfpm/v2"
+	"github.com/sintan1729/lure/internal/signing"
+)
+
+// setSignature configures nfpm to sign the package with keys. Arch Linux
+// packages aren't signed by nfpm, so they're signed by signPkgFile instead.
+func setSignature(info *nfpm.Info, pkgFormat string, keys *signing.Keys) {
+	if keys == nil {
+		return
+	}
+
+	sig := nfpm.PackageSignature{
+		KeyFile:       keys.KeyFile,
+		KeyPassphrase: keys.Passphrase,
+	}
+	if keys.KeyID != "" {
+		sig.KeyID = &keys.KeyID
+	}
+
+	switch pkgFormat {
+	case "deb":
+		if keys.KeyFile != "" {
+			info.Overridables.Deb.Signature = nfpm.DebSignature{PackageSignature: sig}
+		}
+	case "rpm":
+		if keys.KeyFile != "" {
+			info.Overridables.RPM.Signature = nfpm.RPMSignature{PackageSignature: sig}
+		}
+	case "apk":
+		if keys.APKKeyFile != "" {
+			sig.KeyFile = keys.APKKeyFile
+			sig.KeyID = nil
+			info.Overridables.APK.Signature = nfpm.APKSignature{
+				PackageSignature: sig,
+				KeyName:          keys.APKKeyName + ".rsa.pub",
+			}
+		}
+	}
+}
+
+// signPkgFile writes a detached signature for the package at pkgPath
+// to SigPath(pkgPath) if pkgFormat doesn't support embedded signatures.
+// Any signature left over from a previous build is removed.
+func signPkgFile(pkgPath, pkgFormat string, keys *signing.Keys) error {
+	sigPath := SigPath(pkgPath)
+	err := os.Remove(sigPath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	if pkgFormat != "archlinux" || keys == nil || keys.KeyFile == "" {
+		return nil
+	}
+
+	pkgFile, err := os.Open(pkgPath)
+	if err != nil {
+		return err
+	}
+	defer pkgFile.Close()
+
+	sigFile, err := os.Create(sigPath)
+	if err != nil {
+		return err
+	}
+	defer sigFile.Close()
+
+	return signing.DetachSign(sigFile, pkgFile, keys.KeyFile, keys.Passphrase)
+}
+
+// SigPath returns the path of the detached signature
+// for the package at pkgPath
+func SigPath(pkgPath string) string {
+	return pkgPath + ".sig"
+}
+
+// PackageFiles returns the package at pkgPath along with any files
+// that were written next to it, such as its SBOM or signature
+func PackageFiles(pkgPath string) []string {
+	out := []string{pkgPath}
+
+	candidates := []string{SigPath(pkgPath)}
+	for _, format := range SBOMFormats {
+		candidates = append(candidates, SBOMPath(pkgPath, format))
+	}
+
+	for _, path := range candidates {
+		if _, err := os.Stat(path); err == nil {
+			out = append(out, path)
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,176 @@
+/*
+ * LURE - Linux User REpository
+ * Copyright (C) 2023 Elara Musayelyan
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package build
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/goreleaser/nfpm/v2"
+	"github.com/sintan1729/lure/internal/signing"
+)
+
+func TestSetSignature(t *testing.T) {
+	keyID := "0123456789ABCDEF"
+	keys := &signing.Keys{
+		KeyFile:    "/keys/lure.asc",
+		KeyID:      keyID,
+		APKKeyFile: "/keys/lure.rsa",
+		APKKeyName: "lure-0123",
+		Passphrase: "secret",
+	}
+	pgpSig := nfpm.PackageSignature{
+		KeyFile:       keys.KeyFile,
+		KeyID:         &keyID,
+		KeyPassphrase: keys.Passphrase,
+	}
+
+	type testCase struct {
+		name     string
+		format   string
+		keys     *signing.Keys
+		expected nfpm.Overridables
+	}
+
+	tests := []testCase{
+		{
+			name:   "no keys",
+			format: "deb",
+		},
+		{
+			name:     "deb",
+			format:   "deb",
+			keys:     keys,
+			expected: nfpm.Overridables{Deb: nfpm.Deb{Signature: nfpm.DebSignature{PackageSignature: pgpSig}}},
+		},
+		{
+			name:     "rpm",
+			format:   "rpm",
+			keys:     keys,
+			expected: nfpm.Overridables{RPM: nfpm.RPM{Signature: nfpm.RPMSignature{PackageSignature: pgpSig}}},
+		},
+		{
+			name:   "apk",
+			format: "apk",
+			keys:   keys,
+			expected: nfpm.Overridables{APK: nfpm.APK{Signature: nfpm.APKSignature{
+				PackageSignature: nfpm.PackageSignature{
+					KeyFile:       keys.APKKeyFile,
+					KeyPassphrase: keys.Passphrase,
+				},
+				KeyName: "lure-0123.rsa.pub",
+			}}},
+		},
+		{
+			name:   "archlinux",
+			format: "archlinux",
+			keys:   keys,
+		},
+		{
+			name:   "deb without key ID",
+			format: "deb",
+			keys:   &signing.Keys{KeyFile: keys.KeyFile},
+			expected: nfpm.Overridables{Deb: nfpm.Deb{Signature: nfpm.DebSignature{
+				PackageSignature: nfpm.PackageSignature{KeyFile: keys.KeyFile},
+			}}},
+		},
+		{
+			name:   "deb without OpenPGP key",
+			format: "deb",
+			keys:   &signing.Keys{APKKeyFile: keys.APKKeyFile, APKKeyName: keys.APKKeyName},
+		},
+		{
+			name:   "apk without RSA key",
+			format: "apk",
+			keys:   &signing.Keys{KeyFile: keys.KeyFile, KeyID: keyID},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			info := &nfpm.Info{}
+			setSignature(info, tc.format, tc.keys)
+
+			if !reflect.DeepEqual(info.Overridables, tc.expected) {
+				t.Errorf("Expected %+v, got %+v", tc.expected, info.Overridables)
+			}
+		})
+	}
+}
+
+func TestSignPkgFile(t *testing.T) {
+	pgpKey, _, err := signing.Generate("Test", "test@example.com", "")
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	dir := t.TempDir()
+	keys := &signing.Keys{KeyFile: filepath.Join(dir, "key.asc")}
+	err = os.WriteFile(keys.KeyFile, pgpKey, 0o600)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	pkgPath := filepath.Join(dir, "test-1.0.0-1-x86_64.pkg.tar.zst")
+	err = os.WriteFile(pkgPath, []byte("package"), 0o644)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	err = signPkgFile(pkgPath, "archlinux", keys)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	entity, err := signing.ReadPGPKey(keys.KeyFile, "")
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	pkgFile, err := os.Open(pkgPath)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	defer pkgFile.Close()
+
+	sigFile, err := os.Open(SigPath(pkgPath))
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	defer sigFile.Close()
+
+	_, err = openpgp.CheckDetachedSignature(openpgp.EntityList{entity}, pkgFile, sigFile, nil)
+	if err != nil {
+		t.Errorf("Expected a valid signature, got %s", err)
+	}
+
+	// Signatures left over from a previous build must be removed
+	// when the package is rebuilt in a format that embeds them
+	err = signPkgFile(pkgPath, "deb", keys)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	if _, err := os.Stat(SigPath(pkgPath)); !os.IsNotExist(err) {
+		t.Errorf("Expected the old signature to be removed, got %v", err)
+	}
+}
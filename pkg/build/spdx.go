@@ -0,0 +1,264 @@
+/*
+ * LURE - Linux User REpository
+ * Copyright (C) 2023 Elara Musayelyan
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package build
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/mail"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sintan1729/lure/internal/config"
+)
+
+// noAssertion is used for SPDX fields whose value isn't known
+const noAssertion = "NOASSERTION"
+
+// spdxDoc is an SPDX 2.3 JSON document
+type spdxDoc struct {
+	SPDXVersion       string                 `json:"spdxVersion"`
+	DataLicense       string                 `json:"dataLicense"`
+	SPDXID            string                 `json:"SPDXID"`
+	Name              string                 `json:"name"`
+	DocumentNamespace string                 `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo       `json:"creationInfo"`
+	Packages          []spdxPackage          `json:"packages"`
+	Files             []spdxFile             `json:"files,omitempty"`
+	ExtractedLicenses []spdxExtractedLicense `json:"hasExtractedLicensingInfos,omitempty"`
+	Relationships     []spdxRelationship     `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	SPDXID           string                `json:"SPDXID"`
+	Name             string                `json:"name"`
+	VersionInfo      string                `json:"versionInfo,omitempty"`
+	Supplier         string                `json:"supplier,omitempty"`
+	DownloadLocation string                `json:"downloadLocation"`
+	FilesAnalyzed    bool                  `json:"filesAnalyzed"`
+	VerificationCode *spdxVerificationCode `json:"packageVerificationCode,omitempty"`
+	Checksums        []spdxChecksum        `json:"checksums,omitempty"`
+	Homepage         string                `json:"homepage,omitempty"`
+	SourceInfo       string                `json:"sourceInfo,omitempty"`
+	LicenseConcluded string                `json:"licenseConcluded"`
+	LicenseDeclared  string                `json:"licenseDeclared"`
+	CopyrightText    string                `json:"copyrightText"`
+	Description      string                `json:"description,omitempty"`
+	Comment          string                `json:"comment,omitempty"`
+}
+
+type spdxVerificationCode struct {
+	Value string `json:"packageVerificationCodeValue"`
+}
+
+type spdxFile struct {
+	SPDXID           string         `json:"SPDXID"`
+	FileName         string         `json:"fileName"`
+	Checksums        []spdxChecksum `json:"checksums"`
+	LicenseConcluded string         `json:"licenseConcluded"`
+	CopyrightText    string         `json:"copyrightText"`
+}
+
+type spdxChecksum struct {
+	Algorithm string `json:"algorithm"`
+	Value     string `json:"checksumValue"`
+}
+
+type spdxExtractedLicense struct {
+	LicenseID     string `json:"licenseId"`
+	ExtractedText string `json:"extractedText"`
+}
+
+type spdxRelationship struct {
+	Element string `json:"spdxElementId"`
+	Type    string `json:"relationshipType"`
+	Related string `json:"relatedSpdxElement"`
+}
+
+// spdxDocument converts info into an SPDX document. The built package
+// is described by the document, and it's generated from a package for
+// each source, contains each of its files, and depends on a package
+// for each build dependency.
+func spdxDocument(info *sbomInfo) spdxDoc {
+	vars := info.Vars
+
+	pkg := spdxPackage{
+		SPDXID:           "SPDXRef-Package",
+		Name:             vars.Name,
+		VersionInfo:      fullVersion(vars),
+		Supplier:         spdxSupplier(vars.Maintainer),
+		DownloadLocation: noAssertion,
+		FilesAnalyzed:    len(info.Files) > 0,
+		Homepage:         vars.Homepage,
+		LicenseConcluded: noAssertion,
+		LicenseDeclared:  noAssertion,
+		CopyrightText:    noAssertion,
+		Description:      vars.Description,
+		Comment:          "Architecture: " + info.Arch,
+	}
+
+	if info.Repo != "" {
+		pkg.SourceInfo = fmt.Sprintf("Built from the build script in the %s LURE repo", info.Repo)
+		if info.RepoCommit != "" {
+			pkg.SourceInfo += " at commit " + info.RepoCommit
+		}
+	}
+
+	doc := spdxDoc{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              vars.Name + "-" + fullVersion(vars),
+		DocumentNamespace: "urn:uuid:" + info.Serial,
+		CreationInfo: spdxCreationInfo{
+			Created:  info.Created.Format(time.RFC3339),
+			Creators: []string{"Tool: lure-" + config.Version},
+		},
+		Relationships: []spdxRelationship{
+			{"SPDXRef-DOCUMENT", "DESCRIBES", "SPDXRef-Package"},
+		},
+	}
+
+	if info.License != nil {
+		pkg.LicenseDeclared = info.License.ForFormat("spdx")
+
+		// Licenses that aren't in the SPDX license list
+		// have to be declared in the document
+		for _, license := range strings.Fields(strings.NewReplacer("(", " ", ")", " ").Replace(pkg.LicenseDeclared)) {
+			declared := slices.ContainsFunc(doc.ExtractedLicenses, func(el spdxExtractedLicense) bool {
+				return el.LicenseID == license
+			})
+			if strings.HasPrefix(license, "LicenseRef-") && !declared {
+				doc.ExtractedLicenses = append(doc.ExtractedLicenses, spdxExtractedLicense{
+					LicenseID:     license,
+					ExtractedText: noAssertion,
+				})
+			}
+		}
+	}
+
+	var fileSHA1s []string
+	for i, file := range info.Files {
+		id := fmt.Sprintf("SPDXRef-File-%d", i)
+		doc.Files = append(doc.Files, spdxFile{
+			SPDXID:   id,
+			FileName: "." + file.Path,
+			Checksums: []spdxChecksum{
+				{"SHA1", file.SHA1},
+				{"SHA256", file.SHA256},
+			},
+			LicenseConcluded: noAssertion,
+			CopyrightText:    noAssertion,
+		})
+		doc.Relationships = append(doc.Relationships, spdxRelationship{"SPDXRef-Package", "CONTAINS", id})
+		fileSHA1s = append(fileSHA1s, file.SHA1)
+	}
+
+	if pkg.FilesAnalyzed {
+		pkg.VerificationCode = &spdxVerificationCode{spdxVerificationCodeValue(fileSHA1s)}
+	}
+
+	doc.Packages = append(doc.Packages, pkg)
+
+	for i, src := range info.Sources {
+		id := fmt.Sprintf("SPDXRef-Source-%d", i)
+		srcPkg := spdxPackage{
+			SPDXID:           id,
+			Name:             src.Name,
+			VersionInfo:      src.Revision,
+			DownloadLocation: src.URL,
+			LicenseConcluded: noAssertion,
+			LicenseDeclared:  noAssertion,
+			CopyrightText:    noAssertion,
+		}
+
+		if src.Checksum != "" {
+			if alg := sbomHashAlgos[src.Algorithm].spdx; alg != "" {
+				srcPkg.Checksums = []spdxChecksum{{alg, src.Checksum}}
+			} else {
+				srcPkg.Comment = "Checksum: " + src.Algorithm + ":" + src.Checksum
+			}
+		}
+
+		doc.Packages = append(doc.Packages, srcPkg)
+		doc.Relationships = append(doc.Relationships, spdxRelationship{"SPDXRef-Package", "GENERATED_FROM", id})
+	}
+
+	for i, dep := range info.BuildDeps {
+		id := fmt.Sprintf("SPDXRef-BuildDep-%d", i)
+		depPkg := spdxPackage{
+			SPDXID:           id,
+			Name:             dep.Name,
+			VersionInfo:      dep.Version,
+			DownloadLocation: noAssertion,
+			LicenseConcluded: noAssertion,
+			LicenseDeclared:  noAssertion,
+			CopyrightText:    noAssertion,
+		}
+
+		if dep.Installed {
+			depPkg.Comment = "Installed for this build"
+		}
+
+		doc.Packages = append(doc.Packages, depPkg)
+		doc.Relationships = append(doc.Relationships, spdxRelationship{id, "BUILD_DEPENDENCY_OF", "SPDXRef-Package"})
+	}
+
+	return doc
+}
+
+// spdxSupplier converts a maintainer such as "Name <email>"
+// into the format SPDX uses for suppliers
+func spdxSupplier(maintainer string) string {
+	if maintainer == "" {
+		return ""
+	}
+
+	addr, err := mail.ParseAddress(maintainer)
+	if err != nil {
+		return "Person: " + maintainer
+	}
+
+	if addr.Name == "" {
+		return "Person: " + addr.Address
+	}
+	return "Person: " + addr.Name + " (" + addr.Address + ")"
+}
+
+// spdxVerificationCodeValue computes an SPDX package verification
+// code, which is the SHA1 hash of the sorted SHA1 hashes of all the
+// files in the package
+func spdxVerificationCodeValue(fileSHA1s []string) string {
+	sorted := append([]string(nil), fileSHA1s...)
+	sort.Strings(sorted)
+
+	h := sha1.New()
+	for _, sum := range sorted {
+		h.Write([]byte(sum))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
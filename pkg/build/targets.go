@@ -0,0 +1,256 @@
+/*
+ * LURE - Linux User REpository
+ * Copyright (C) 2023 Elara Musayelyan
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package build
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/goreleaser/nfpm/v2"
+	"github.com/sintan1729/lure/internal/cpu"
+	"github.com/sintan1729/lure/internal/shutils/decoder"
+	"github.com/sintan1729/lure/internal/types"
+	"github.com/sintan1729/lure/pkg/distro"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+var (
+	ErrInvalidFormat = errors.New("invalid package format")
+	ErrInvalidArch   = errors.New("invalid target architecture")
+)
+
+// defaultDistros maps package formats to the distro whose overrides
+// are used when building packages in that format on a distro that
+// uses a different one
+var defaultDistros = map[string]string{
+	"deb":       "debian",
+	"rpm":       "fedora",
+	"apk":       "alpine",
+	"archlinux": "arch",
+}
+
+// buildFuncs contains the functions that are executed to build a package
+var buildFuncs = []string{"version", "prepare", "build", "package"}
+
+// buildTarget is a package format to build, along with the
+// distro and architecture whose overrides are used for it
+type buildTarget struct {
+	format string
+	info   *distro.OSRelease
+	arch   string
+	vars   *types.BuildVars
+	// key identifies everything that affects the contents of the
+	// package. Targets with the same key can share a single build.
+	key string
+}
+
+// load executes the first pass of the script for the target's
+// distro and sets the target's variables and key
+func (t *buildTarget) load(ctx context.Context, fl *syntax.File, script string) error {
+	runner, err := runFirstPass(ctx, t.info, t.arch, fl, script)
+	if err != nil {
+		return err
+	}
+
+	dec := decoder.New(t.info, runner)
+	dec.Arch = t.arch
+
+	var vars types.BuildVars
+	err = dec.DecodeVars(&vars)
+	if err != nil {
+		return err
+	}
+	t.vars = &vars
+
+	key := []string{strings.Join(vars.Sources, " "), strings.Join(vars.Checksums, " ")}
+	for _, name := range buildFuncs {
+		fnName, _ := dec.FuncName(name)
+		key = append(key, fnName)
+	}
+	t.key = strings.Join(key, "\x00")
+
+	return nil
+}
+
+// getTargets returns the targets requested in opts, with their variables
+// loaded. Targets without a distro use the host's distro if their format
+// is the host's format, and the default distro for the format otherwise.
+// The distro may be followed by a colon and its version or codename.
+func getTargets(ctx context.Context, opts types.BuildOpts, host *buildTarget, fl *syntax.File) ([]*buildTarget, error) {
+	hostFormat := getPkgFormat(opts.Manager)
+	if len(opts.Formats) == 0 {
+		host.format = hostFormat
+		return []*buildTarget{host}, nil
+	}
+
+	var targets []*buildTarget
+	seen := map[string]bool{}
+	for _, spec := range opts.Formats {
+		format, distroID, _ := strings.Cut(strings.TrimSpace(spec), ":")
+		distroID, version, _ := strings.Cut(distroID, ":")
+		if format == "" {
+			continue
+		}
+
+		if _, err := nfpm.Get(format); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidFormat, format)
+		}
+
+		// Every target with the same format would produce
+		// a package file with the same name
+		if seen[format] {
+			return nil, fmt.Errorf("%w: %s was given more than once", ErrInvalidFormat, format)
+		}
+		seen[format] = true
+
+		if distroID == "" && format != hostFormat {
+			distroID = defaultDistros[format]
+		}
+
+		if (distroID == "" || distroID == host.info.ID) && version == "" {
+			target := *host
+			target.format = format
+			targets = append(targets, &target)
+			continue
+		}
+
+		if distroID == "" {
+			distroID = host.info.ID
+		}
+
+		target := &buildTarget{format: format, info: knownDistro(distroID, version), arch: host.arch}
+		err := target.load(ctx, fl, opts.Script)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, target)
+	}
+
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("%w: no formats given", ErrInvalidFormat)
+	}
+
+	return targets, nil
+}
+
+// knownDistro returns the information about the distro with the given ID,
+// with the given version or codename
+func knownDistro(id, version string) *distro.OSRelease {
+	info := distro.Known(id)
+	if version != "" && unicode.IsDigit(rune(version[0])) {
+		info.VersionID = version
+	} else {
+		info.VersionCodename = version
+	}
+	return info
+}
+
+// getTargetDistro returns the distro given in spec, which is a distro ID
+// optionally followed by a colon and its version or codename. If spec is
+// empty or only contains the host's distro ID, host is returned.
+func getTargetDistro(host *distro.OSRelease, spec string) *distro.OSRelease {
+	distroID, version, _ := strings.Cut(strings.TrimSpace(spec), ":")
+	if (distroID == "" || distroID == host.ID) && version == "" {
+		return host
+	}
+
+	if distroID == "" {
+		distroID = host.ID
+	}
+	return knownDistro(distroID, version)
+}
+
+// getTargetArch returns the given architecture, or the default one
+// if it's empty. Names that other tools use for architectures,
+// such as aarch64, are accepted too.
+func getTargetArch(targetArch string) (string, error) {
+	if targetArch == "" {
+		return cpu.Arch(), nil
+	}
+
+	arch := targetArch
+	if suggested, ok := cpu.Suggest(arch); ok {
+		arch = suggested
+	}
+
+	if arch == "all" || !cpu.IsKnown(arch) {
+		return "", fmt.Errorf("%w: %s", ErrInvalidArch, targetArch)
+	}
+
+	return arch, nil
+}
+
+// groupTargets groups the targets that can share a single build, in order
+func groupTargets(targets []*buildTarget) [][]*buildTarget {
+	var groups [][]*buildTarget
+	index := map[string]int{}
+	for _, target := range targets {
+		i, ok := index[target.key]
+		if !ok {
+			i = len(groups)
+			index[target.key] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], target)
+	}
+	return groups
+}
+
+// checkForBuiltPackages returns the paths of the previously-built packages
+// of all the targets and true if every one of them was found.
+func checkForBuiltPackages(targets []*buildTarget, baseDir string) ([]string, bool, error) {
+	var pkgPaths []string
+	for _, target := range targets {
+		pkgPath, ok, err := checkForBuiltPackage(target.vars, target.format, target.arch, baseDir)
+		if err != nil || !ok {
+			return nil, false, err
+		}
+		pkgPaths = append(pkgPaths, pkgPath)
+	}
+	return pkgPaths, true, nil
+}
+
+// cleanBuildDirs empties the source and package directories between
+// builds, keeping the packages that have already been built
+func cleanBuildDirs(dirs types.Directories) error {
+	for _, dir := range []string{dirs.SrcDir, dirs.PkgDir} {
+		err := os.RemoveAll(dir)
+		if err != nil {
+			return err
+		}
+		err = os.MkdirAll(dir, 0o755)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// targetFormats returns the formats of the given targets
+func targetFormats(targets []*buildTarget) []string {
+	formats := make([]string, len(targets))
+	for i, target := range targets {
+		formats[i] = target.format
+	}
+	return formats
+}
@@ -0,0 +1,54 @@
+/*
+ * LURE - Linux User REpository
+ * Copyright (C) 2023 Elara Musayelyan
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package distro
+
+// known contains the os-release information of common distros,
+// which is used when building packages for a distro other
+// than the one LURE is running on.
+var known = map[string]OSRelease{
+	"debian":              {Name: "Debian GNU/Linux"},
+	"ubuntu":              {Name: "Ubuntu", Like: []string{"debian"}},
+	"linuxmint":           {Name: "Linux Mint", Like: []string{"ubuntu", "debian"}},
+	"pop":                 {Name: "Pop!_OS", Like: []string{"ubuntu", "debian"}},
+	"fedora":              {Name: "Fedora Linux"},
+	"rhel":                {Name: "Red Hat Enterprise Linux", Like: []string{"fedora"}},
+	"centos":              {Name: "CentOS Stream", Like: []string{"rhel", "fedora"}},
+	"rocky":               {Name: "Rocky Linux", Like: []string{"rhel", "centos", "fedora"}},
+	"almalinux":           {Name: "AlmaLinux", Like: []string{"rhel", "centos", "fedora"}},
+	"opensuse-leap":       {Name: "openSUSE Leap", Like: []string{"suse", "opensuse"}},
+	"opensuse-tumbleweed": {Name: "openSUSE Tumbleweed", Like: []string{"opensuse", "suse"}},
+	"alpine":              {Name: "Alpine Linux"},
+	"arch":                {Name: "Arch Linux"},
+	"manjaro":             {Name: "Manjaro Linux", Like: []string{"arch"}},
+	"endeavouros":         {Name: "EndeavourOS", Like: []string{"arch"}},
+}
+
+// Known returns the os-release information of the distro with the given
+// ID. Distros LURE doesn't know about only have their ID set.
+func Known(id string) *OSRelease {
+	info, ok := known[id]
+	if !ok {
+		return &OSRelease{Name: id, PrettyName: id, ID: id}
+	}
+
+	info.ID = id
+	info.PrettyName = info.Name
+	info.Like = append([]string(nil), info.Like...)
+	return &info
+}
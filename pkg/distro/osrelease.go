@@ -36,6 +36,7 @@ type OSRelease struct {
 	ID               string
 	Like             []string
 	VersionID        string
+	VersionCodename  string
 	ANSIColor        string
 	HomeURL          string
 	DocumentationURL string
@@ -94,6 +95,7 @@ func ParseOSRelease(ctx context.Context) (*OSRelease, error) {
 		PrettyName:       runner.Vars["PRETTY_NAME"].Str,
 		ID:               runner.Vars["ID"].Str,
 		VersionID:        runner.Vars["VERSION_ID"].Str,
+		VersionCodename:  runner.Vars["VERSION_CODENAME"].Str,
 		ANSIColor:        runner.Vars["ANSI_COLOR"].Str,
 		HomeURL:          runner.Vars["HOME_URL"].Str,
 		DocumentationURL: runner.Vars["DOCUMENTATION_URL"].Str,
@@ -104,9 +106,23 @@ func ParseOSRelease(ctx context.Context) (*OSRelease, error) {
 
 	distroUpdated := false
 	if distID, ok := os.LookupEnv("LURE_DISTRO"); ok {
+		// The version of the system's distro doesn't
+		// apply to a different one
+		if distID != out.ID {
+			out.VersionID = ""
+			out.VersionCodename = ""
+		}
 		out.ID = distID
 	}
 
+	if distVersion, ok := os.LookupEnv("LURE_DISTRO_VERSION"); ok {
+		out.VersionID = distVersion
+	}
+
+	if distCodename, ok := os.LookupEnv("LURE_DISTRO_CODENAME"); ok {
+		out.VersionCodename = distCodename
+	}
+
 	if distLike, ok := os.LookupEnv("LURE_DISTRO_LIKE"); ok {
 		out.Like = strings.Split(distLike, " ")
 	} else if runner.Vars["ID_LIKE"].IsSet() && !distroUpdated {
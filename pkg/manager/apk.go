@@ -111,6 +111,11 @@ func (a *APK) UpgradeAll(opts *Opts) error {
 	return a.Upgrade(opts)
 }
 
+func (a *APK) IsAvailable(name string) (bool, error) {
+	cmd := exec.Command("apk", "search", "--exact", "--quiet", name)
+	return commandOutputs(cmd)
+}
+
 func (a *APK) ListInstalled(opts *Opts) (map[string]string, error) {
 	out := map[string]string{}
 	cmd := exec.Command("apk", "list", "-I")
@@ -103,6 +103,11 @@ func (a *APT) UpgradeAll(opts *Opts) error {
 	return nil
 }
 
+func (a *APT) IsAvailable(name string) (bool, error) {
+	cmd := exec.Command("apt-cache", "show", "--quiet", name)
+	return commandSucceeds(cmd)
+}
+
 func (a *APT) ListInstalled(opts *Opts) (map[string]string, error) {
 	out := map[string]string{}
 	cmd := exec.Command("dpkg-query", "-f", "${Package}\u200b${Version}\\n", "-W")
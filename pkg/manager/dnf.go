@@ -110,6 +110,11 @@ func (d *DNF) UpgradeAll(opts *Opts) error {
 	return nil
 }
 
+func (d *DNF) IsAvailable(name string) (bool, error) {
+	cmd := exec.Command("dnf", "--quiet", "info", name)
+	return commandSucceeds(cmd)
+}
+
 func (d *DNF) ListInstalled(opts *Opts) (map[string]string, error) {
 	out := map[string]string{}
 	cmd := exec.Command("rpm", "-qa", "--queryformat", "%{NAME}\u200b%|EPOCH?{%{EPOCH}:}:{}|%{VERSION}-%{RELEASE}\\n")
@@ -19,6 +19,8 @@
 package manager
 
 import (
+	"bytes"
+	"errors"
 	"os"
 	"os/exec"
 )
@@ -76,6 +78,9 @@ type Manager interface {
 	InstallLocal(*Opts, ...string) error
 	// UpgradeAll upgrades all packages
 	UpgradeAll(*Opts) error
+	// IsAvailable returns true if the package called name
+	// can be installed from the system repositories
+	IsAvailable(name string) (bool, error)
 	// ListInstalled returns all installed packages mapped to their versions
 	ListInstalled(*Opts) (map[string]string, error)
 }
@@ -122,3 +127,30 @@ func ensureOpts(opts *Opts) *Opts {
 	opts.Args = append(opts.Args, Args...)
 	return opts
 }
+
+// commandSucceeds runs a query command and returns true if it exits
+// successfully. Query commands exit unsuccessfully when nothing matches,
+// so that isn't an error, but failing to run the command is.
+func commandSucceeds(cmd *exec.Cmd) (bool, error) {
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// commandOutputs runs a query command and returns true
+// if it exits successfully and prints anything
+func commandOutputs(cmd *exec.Cmd) (bool, error) {
+	out, err := cmd.Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return len(bytes.TrimSpace(out)) > 0, nil
+}
@@ -110,6 +110,11 @@ func (p *Pacman) UpgradeAll(opts *Opts) error {
 	return nil
 }
 
+func (p *Pacman) IsAvailable(name string) (bool, error) {
+	cmd := exec.Command("pacman", "-Si", name)
+	return commandSucceeds(cmd)
+}
+
 func (p *Pacman) ListInstalled(opts *Opts) (map[string]string, error) {
 	out := map[string]string{}
 	cmd := exec.Command("pacman", "-Q")
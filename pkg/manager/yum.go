@@ -110,6 +110,11 @@ func (y *YUM) UpgradeAll(opts *Opts) error {
 	return nil
 }
 
+func (y *YUM) IsAvailable(name string) (bool, error) {
+	cmd := exec.Command("yum", "--quiet", "info", name)
+	return commandSucceeds(cmd)
+}
+
 func (y *YUM) ListInstalled(opts *Opts) (map[string]string, error) {
 	out := map[string]string{}
 	cmd := exec.Command("rpm", "-qa", "--queryformat", "%{NAME}\u200b%|EPOCH?{%{EPOCH}:}:{}|%{VERSION}-%{RELEASE}\\n")
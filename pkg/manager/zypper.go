@@ -110,6 +110,11 @@ func (z *Zypper) UpgradeAll(opts *Opts) error {
 	return nil
 }
 
+func (z *Zypper) IsAvailable(name string) (bool, error) {
+	cmd := exec.Command("zypper", "--quiet", "--non-interactive", "search", "--match-exact", name)
+	return commandSucceeds(cmd)
+}
+
 func (z *Zypper) ListInstalled(opts *Opts) (map[string]string, error) {
 	out := map[string]string{}
 	cmd := exec.Command("rpm", "-qa", "--queryformat", "%{NAME}\u200b%|EPOCH?{%{EPOCH}:}:{}|%{VERSION}-%{RELEASE}\\n")
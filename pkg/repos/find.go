@@ -22,12 +22,20 @@ import (
 	"context"
 
 	"github.com/sintan1729/lure/internal/db"
+	"github.com/sintan1729/lure/internal/pkgdep"
+	"github.com/sintan1729/lure/pkg/loggerctx"
 )
 
 // FindPkgs looks for packages matching the inputs inside the database.
+// Inputs may have version constraints, such as foo>=1.2, in which case
+// only packages whose versions satisfy them are returned. Inputs with
+// alternatives, such as foo | bar, are looked up using the first
+// alternative that has a matching package.
 // It returns a map that maps the package name input to any packages found for it.
 // It also returns a slice that contains the names of all packages that were not found.
 func FindPkgs(ctx context.Context, pkgs []string) (map[string][]db.Package, []string, error) {
+	log := loggerctx.From(ctx)
+
 	found := map[string][]db.Package{}
 	notFound := []string(nil)
 
@@ -36,48 +44,92 @@ func FindPkgs(ctx context.Context, pkgs []string) (map[string][]db.Package, []st
 			continue
 		}
 
-		result, err := db.GetPkgs(ctx, "json_array_contains(provides, ?)", pkgName)
+		alts, err := pkgdep.ParseAlternatives(pkgName)
 		if err != nil {
 			return nil, nil, err
 		}
 
-		added := 0
-		for result.Next() {
-			var pkg db.Package
-			err = result.StructScan(&pkg)
+		var unsatisfied bool
+		for _, dep := range alts {
+			matches, hasCandidates, err := findDep(ctx, dep)
 			if err != nil {
 				return nil, nil, err
 			}
 
-			added++
-			found[pkgName] = append(found[pkgName], pkg)
+			if len(matches) > 0 {
+				found[pkgName] = matches
+				break
+			}
+			unsatisfied = unsatisfied || hasCandidates
 		}
-		result.Close()
 
-		if added == 0 {
-			result, err := db.GetPkgs(ctx, "name LIKE ?", pkgName)
-			if err != nil {
-				return nil, nil, err
+		if len(found[pkgName]) == 0 {
+			if unsatisfied {
+				log.Warn("No LURE package satisfies the version constraint, looking in system repositories").
+					Str("name", pkgName).
+					Send()
 			}
+			notFound = append(notFound, pkgName)
+		}
+	}
 
-			for result.Next() {
-				var pkg db.Package
-				err = result.StructScan(&pkg)
-				if err != nil {
-					return nil, nil, err
-				}
+	return found, notFound, nil
+}
 
-				added++
-				found[pkgName] = append(found[pkgName], pkg)
-			}
+// findDep returns the packages that satisfy dep. It also returns
+// true if there are packages for dep whose versions don't satisfy it.
+func findDep(ctx context.Context, dep pkgdep.Dep) ([]db.Package, bool, error) {
+	candidates, err := findCandidates(ctx, dep.Name)
+	if err != nil {
+		return nil, false, err
+	}
 
-			result.Close()
+	var out []db.Package
+	for _, pkg := range candidates {
+		if dep.SatisfiedBy(providedVersion(pkg, dep.Name)) {
+			out = append(out, pkg)
 		}
+	}
+	return out, len(candidates) > 0, nil
+}
 
-		if added == 0 {
-			notFound = append(notFound, pkgName)
+// findCandidates returns the packages that provide name or, if there
+// aren't any, the packages called name
+func findCandidates(ctx context.Context, name string) ([]db.Package, error) {
+	var out []db.Package
+	for _, where := range []string{"provides_contains(provides, ?)", "name LIKE ?"} {
+		result, err := db.GetPkgs(ctx, where, name)
+		if err != nil {
+			return nil, err
+		}
+
+		for result.Next() {
+			var pkg db.Package
+			err = result.StructScan(&pkg)
+			if err != nil {
+				result.Close()
+				return nil, err
+			}
+			out = append(out, pkg)
+		}
+		result.Close()
+
+		if len(out) > 0 {
+			break
 		}
 	}
+	return out, nil
+}
 
-	return found, notFound, nil
+// providedVersion returns the version of name provided by pkg. This is
+// the version in pkg's provides if it has one, such as 1.2 for foo=1.2,
+// and pkg's own version otherwise.
+func providedVersion(pkg db.Package, name string) (epoch uint, version string, release int) {
+	for _, provide := range pkg.Provides.Val {
+		dep, err := pkgdep.Parse(provide)
+		if err == nil && dep.Name == name && dep.Op == "=" {
+			return pkgdep.ParseVersion(dep.Version)
+		}
+	}
+	return pkg.Epoch, pkg.Version, pkg.Release
 }
@@ -37,8 +37,10 @@ import (
 	"go.elara.ws/vercmp"
 	"github.com/sintan1729/lure/internal/config"
 	"github.com/sintan1729/lure/internal/db"
+	"github.com/sintan1729/lure/internal/flock"
 	"github.com/sintan1729/lure/internal/shutils/decoder"
 	"github.com/sintan1729/lure/internal/shutils/handlers"
+	"github.com/sintan1729/lure/internal/spdx"
 	"github.com/sintan1729/lure/internal/types"
 	"github.com/sintan1729/lure/pkg/distro"
 	"github.com/sintan1729/lure/pkg/loggerctx"
@@ -51,13 +53,27 @@ import (
 // and its packages will be written to the DB. If it does exist, it will be pulled.
 // In this case, only changed packages will be processed if possible.
 // If repos is set to nil, the repos in the LURE config will be used.
+// In offline mode, Pull does nothing.
 func Pull(ctx context.Context, repos []types.Repo) error {
 	log := loggerctx.From(ctx)
 
+	if config.Config(ctx).Offline {
+		log.Info("Offline mode is enabled, not pulling repos").Send()
+		return nil
+	}
+
 	if repos == nil {
 		repos = config.Config(ctx).Repos
 	}
 
+	// Make sure no other LURE process is pulling or
+	// removing repos while we're working on them
+	lock, err := LockRepos(ctx)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
 	for _, repo := range repos {
 		repoURL, err := url.Parse(repo.URL)
 		if err != nil {
@@ -169,6 +185,12 @@ func Pull(ctx context.Context, repos []types.Repo) error {
 	return nil
 }
 
+// LockRepos takes an exclusive lock on the repo directory, waiting
+// for any other LURE process that's pulling repos to finish first.
+func LockRepos(ctx context.Context) (*flock.Lock, error) {
+	return flock.Acquire(ctx, filepath.Join(config.GetPaths(ctx).RepoDir, ".lock"))
+}
+
 type actionType uint8
 
 const (
@@ -409,7 +431,18 @@ func parseScript(ctx context.Context, parser *syntax.Parser, runner *interp.Runn
 	d := decoder.New(&distro.OSRelease{}, runner)
 	d.Overrides = false
 	d.LikeDistros = false
-	return d.DecodeVars(pkg)
+	err = d.DecodeVars(pkg)
+	if err != nil {
+		return err
+	}
+
+	// Invalid licenses are left out of the normalized expression,
+	// so that one bad script doesn't prevent pulling the repo
+	pkg.License, err = spdx.Normalize(pkg.Licenses.Val)
+	if err != nil {
+		loggerctx.From(ctx).Debug("Invalid license in build script").Str("name", pkg.Name).Err(err).Send()
+	}
+	return nil
 }
 
 var overridable = map[string]string{
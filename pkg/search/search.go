@@ -22,6 +22,7 @@ const (
 	FilterNone Filter = iota
 	FilterInRepo
 	FilterSupportsArch
+	FilterLicense
 )
 
 // SoryBy represents a value that packages can be sorted by.
@@ -46,6 +47,7 @@ type Package struct {
 	Maintainer    map[string]string
 	Architectures []string
 	Licenses      []string
+	License       string
 	Provides      []string
 	Conflicts     []string
 	Replaces      []string
@@ -66,6 +68,7 @@ func convertPkg(p db.Package) Package {
 		Maintainer:    p.Maintainer.Val,
 		Architectures: p.Architectures.Val,
 		Licenses:      p.Licenses.Val,
+		License:       p.License,
 		Provides:      p.Provides.Val,
 		Conflicts:     p.Conflicts.Val,
 		Replaces:      p.Replaces.Val,
@@ -87,7 +90,7 @@ type Options struct {
 
 // Search searches for packages in the database based on the given options.
 func Search(ctx context.Context, opts Options) ([]Package, error) {
-	query := "(name LIKE ? OR description LIKE ? OR json_array_contains(provides, ?))"
+	query := "(name LIKE ? OR description LIKE ? OR provides_contains(provides, ?))"
 	args := []any{"%" + opts.Query + "%", "%" + opts.Query + "%", opts.Query}
 
 	if opts.Filter != FilterNone {
@@ -96,6 +99,8 @@ func Search(ctx context.Context, opts Options) ([]Package, error) {
 			query += " AND repository = ?"
 		case FilterSupportsArch:
 			query += " AND json_array_contains(architectures, ?)"
+		case FilterLicense:
+			query += " AND license_contains(license, ?)"
 		}
 		args = append(args, opts.FilterValue)
 	}
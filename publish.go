@@ -0,0 +1,99 @@
+/*
+ * LURE - Linux User REpository
+ * Copyright (C) 2023 Elara Musayelyan
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"context"
+	"io/fs"
+	"path/filepath"
+
+	"github.com/sintan1729/lure/internal/config"
+	"github.com/sintan1729/lure/internal/publish"
+	"github.com/sintan1729/lure/internal/signing"
+	"github.com/sintan1729/lure/pkg/build"
+	"github.com/sintan1729/lure/pkg/loggerctx"
+	"github.com/urfave/cli/v3"
+)
+
+var publishCmd = &cli.Command{
+	Name:      "publish",
+	Usage:     "Copy built packages into a local repository that the system package manager can install from",
+	ArgsUsage: "[package file...]",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:    "dir",
+			Aliases: []string{"d"},
+			Usage:   "Directory of the repository, instead of the one in the config",
+		},
+	},
+	Action: func(ctx context.Context, c *cli.Command) error {
+		log := loggerctx.From(ctx)
+
+		keys, err := signing.Load(config.Config(ctx).Signing)
+		if err != nil {
+			log.Fatal("Error loading signing keys").Err(err).Send()
+		}
+
+		opts, err := publish.OptionsFromConfig(ctx, c.String("dir"), keys)
+		if err != nil {
+			log.Fatal("Error getting repository options").Err(err).Send()
+		}
+
+		pkgs := c.Args().Slice()
+
+		// Without any arguments, every package LURE has built is published
+		if len(pkgs) == 0 {
+			err = filepath.WalkDir(config.GetPaths(ctx).PkgsDir, func(path string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if d.Type().IsRegular() && publish.Format(path) != "" {
+					pkgs = append(pkgs, path)
+				}
+				return nil
+			})
+			if err != nil {
+				log.Fatal("Error finding built packages").Err(err).Send()
+			}
+
+			if len(pkgs) == 0 {
+				log.Fatal("No built packages found").Send()
+			}
+		}
+
+		var files []string
+		for _, pkg := range pkgs {
+			if publish.Format(pkg) == "" {
+				log.Fatal("Not a package file").Str("path", pkg).Send()
+			}
+			files = append(files, build.PackageFiles(pkg)...)
+		}
+
+		published, err := publish.Publish(ctx, opts, files)
+		if err != nil {
+			log.Fatal("Error publishing packages").Err(err).Send()
+		}
+
+		for _, path := range published {
+			log.Info("Published package").Str("path", path).Send()
+		}
+
+		return nil
+	},
+}
@@ -0,0 +1,425 @@
+/*
+ * LURE - Linux User REpository
+ * Copyright (C) 2023 Elara Musayelyan
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/sintan1729/lure/internal/cliutils"
+	"github.com/sintan1729/lure/internal/db"
+	"github.com/sintan1729/lure/internal/installed"
+	"github.com/sintan1729/lure/internal/overrides"
+	"github.com/sintan1729/lure/internal/pkgdep"
+	"github.com/sintan1729/lure/pkg/distro"
+	"github.com/sintan1729/lure/pkg/loggerctx"
+	"github.com/sintan1729/lure/pkg/manager"
+	"github.com/urfave/cli/v3"
+)
+
+var removeCmd = &cli.Command{
+	Name:    "remove",
+	Usage:   "Remove an installed package",
+	Aliases: []string{"rm"},
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:    "recursive",
+			Aliases: []string{"r"},
+			Usage:   "Also remove the LURE dependencies of the packages that aren't needed by anything else",
+		},
+		&cli.BoolFlag{
+			Name:  "noconfirm",
+			Usage: "Don't ask before removing dependencies that are no longer needed",
+		},
+	},
+	Action: func(ctx context.Context, c *cli.Command) error {
+		log := loggerctx.From(ctx)
+
+		args := c.Args()
+		if args.Len() < 1 {
+			log.Fatalf("Command remove expected at least 1 argument, got %d", args.Len()).Send()
+		}
+
+		mgr := manager.Detect()
+		if mgr == nil {
+			log.Fatal("Unable to detect a supported package manager on the system").Send()
+		}
+
+		graph, err := loadDepGraph(ctx, mgr)
+		if err != nil {
+			log.Fatal("Error getting installed packages").Err(err).Send()
+		}
+
+		var names []string
+		removing := map[string]bool{}
+		for _, name := range args.Slice() {
+			if _, ok := graph.installed[name]; !ok {
+				log.Warn("Package is not installed").Str("name", name).Send()
+				continue
+			}
+			if !graph.managed(name) {
+				log.Warn("Package was not installed by LURE, use your package manager to remove it").Str("name", name).Send()
+				continue
+			}
+			names = append(names, name)
+			removing[name] = true
+		}
+
+		if len(names) == 0 {
+			log.Info("There is nothing to do.").Send()
+			return nil
+		}
+
+		dependents := graph.dependents(removing)
+		if len(dependents) > 0 {
+			for _, name := range names {
+				if len(dependents[name]) > 0 {
+					log.Warn("Other LURE packages depend on this package").
+						Str("name", name).
+						Str("dependents", strings.Join(dependents[name], ", ")).
+						Send()
+				}
+			}
+
+			remove, err := cliutils.YesNoPrompt(ctx, "Remove the packages anyway?", c.Bool("interactive"), false)
+			if err != nil {
+				log.Fatal("Error prompting the user").Err(err).Send()
+			}
+
+			if !remove {
+				log.Fatal("Not removing packages that other packages depend on").Send()
+			}
+		}
+
+		if c.Bool("recursive") {
+			orphans := graph.orphanedDeps(removing)
+			if len(orphans) > 0 && confirmUnneeded(ctx, c, orphans) {
+				names = append(names, orphans...)
+			}
+		}
+
+		removePkgs(ctx, mgr, names)
+		return nil
+	},
+}
+
+var autoremoveCmd = &cli.Command{
+	Name:  "autoremove",
+	Usage: "Remove LURE packages that were installed as dependencies and are no longer needed",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "noconfirm",
+			Usage: "Don't ask before removing dependencies that are no longer needed",
+		},
+	},
+	Action: func(ctx context.Context, c *cli.Command) error {
+		log := loggerctx.From(ctx)
+
+		mgr := manager.Detect()
+		if mgr == nil {
+			log.Fatal("Unable to detect a supported package manager on the system").Send()
+		}
+
+		graph, err := loadDepGraph(ctx, mgr)
+		if err != nil {
+			log.Fatal("Error getting installed packages").Err(err).Send()
+		}
+
+		names := graph.unneeded(nil)
+		if len(names) == 0 {
+			log.Info("There is nothing to do.").Send()
+			return nil
+		}
+
+		if confirmUnneeded(ctx, c, names) {
+			removePkgs(ctx, mgr, names)
+		}
+		return nil
+	},
+}
+
+// confirmUnneeded lists the dependencies that are no longer needed
+// and asks the user whether they should be removed, unless the
+// noconfirm flag is set
+func confirmUnneeded(ctx context.Context, c *cli.Command, names []string) bool {
+	log := loggerctx.From(ctx)
+
+	log.Info("These dependencies are no longer needed").
+		Str("names", strings.Join(names, ", ")).
+		Send()
+
+	remove, err := cliutils.YesNoPrompt(ctx, "Remove them?", c.Bool("interactive") && !c.Bool("noconfirm"), true)
+	if err != nil {
+		log.Fatal("Error prompting the user").Err(err).Send()
+	}
+	return remove
+}
+
+// removePkgs removes the given packages and deletes them from
+// the record of installed LURE packages
+func removePkgs(ctx context.Context, mgr manager.Manager, names []string) {
+	log := loggerctx.From(ctx)
+
+	err := mgr.Remove(nil, names...)
+	if err != nil {
+		log.Fatal("Error removing packages").Err(err).Send()
+	}
+
+	err = installed.Remove(ctx, names...)
+	if err != nil {
+		log.Fatal("Error recording removed packages").Err(err).Send()
+	}
+}
+
+// lurePkg is an installed LURE package, with
+// its overrides resolved for the current system
+type lurePkg struct {
+	provides   []string
+	depends    []string
+	optDepends []string
+}
+
+// depGraph contains the dependencies of the installed LURE packages
+type depGraph struct {
+	pkgs      map[string]lurePkg
+	installed map[string]string
+	record    map[string]installed.Package
+}
+
+// loadDepGraph finds the installed LURE packages and their dependencies.
+// Packages that aren't in the record of installed packages, such as the
+// ones installed before it existed, are treated as explicitly installed.
+func loadDepGraph(ctx context.Context, mgr manager.Manager) (*depGraph, error) {
+	installedPkgs, err := mgr.ListInstalled(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	record, err := installed.Packages(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := distro.ParseOSRelease(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	names, err := overrides.Resolve(info, overrides.DefaultOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := db.GetPkgs(ctx, "true")
+	if err != nil {
+		return nil, err
+	}
+	defer result.Close()
+
+	graph := &depGraph{pkgs: map[string]lurePkg{}, installed: installedPkgs, record: record}
+	for result.Next() {
+		var pkg db.Package
+		err = result.StructScan(&pkg)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := installedPkgs[pkg.Name]; !ok {
+			continue
+		}
+
+		// If several repos have a package with the same name,
+		// the one that's found first is used
+		if _, ok := graph.pkgs[pkg.Name]; ok {
+			continue
+		}
+
+		resolved := overrides.ResolvePackage(&pkg, names)
+
+		optDepends := make([]string, len(resolved.OptDepends))
+		for i, dep := range resolved.OptDepends {
+			optDepends[i], _, _ = strings.Cut(dep, ": ")
+		}
+
+		provides := make([]string, len(resolved.Provides))
+		for i, provide := range resolved.Provides {
+			provides[i] = pkgdep.Name(provide)
+		}
+
+		graph.pkgs[pkg.Name] = lurePkg{
+			provides:   provides,
+			depends:    resolved.Depends,
+			optDepends: optDepends,
+		}
+	}
+
+	return graph, nil
+}
+
+// managed returns true if the installed package called name was installed
+// by LURE. That's the case if it's in the record of installed packages or,
+// for packages installed before the record existed, if it's in a LURE repo.
+func (g *depGraph) managed(name string) bool {
+	if _, ok := g.record[name]; ok {
+		return true
+	}
+	_, ok := g.pkgs[name]
+	return ok
+}
+
+// isDependency returns true if LURE installed the package called
+// name only as a dependency. Packages that aren't in the record of
+// installed packages weren't installed by LURE as dependencies, so
+// they're never treated as unneeded.
+func (g *depGraph) isDependency(name string) bool {
+	pkg, ok := g.record[name]
+	return ok && pkg.Dependency
+}
+
+// providers returns the names of the installed packages that are
+// called name or, in the case of LURE packages, provide it. The
+// packages in removing are ignored.
+func (g *depGraph) providers(name string, removing map[string]bool) []string {
+	var out []string
+	if _, ok := g.installed[name]; ok && !removing[name] {
+		out = append(out, name)
+	}
+
+	for pkgName, pkg := range g.pkgs {
+		if pkgName != name && !removing[pkgName] && slices.Contains(pkg.provides, name) {
+			out = append(out, pkgName)
+		}
+	}
+	return out
+}
+
+// satisfies returns the names of the installed packages that satisfy
+// any alternative of the dependency dep, ignoring those in removing
+func (g *depGraph) satisfies(dep string, removing map[string]bool) []string {
+	alts, err := pkgdep.ParseAlternatives(dep)
+	if err != nil {
+		return nil
+	}
+
+	var out []string
+	for _, alt := range alts {
+		out = append(out, g.providers(alt.Name, removing)...)
+	}
+	return out
+}
+
+// dependents returns the LURE packages whose dependencies would no longer
+// be satisfied if the packages in removing were removed, mapped by the
+// name of the package they depend on.
+func (g *depGraph) dependents(removing map[string]bool) map[string][]string {
+	out := map[string][]string{}
+	for pkgName, pkg := range g.pkgs {
+		if removing[pkgName] {
+			continue
+		}
+
+		for _, dep := range pkg.depends {
+			if len(g.satisfies(dep, removing)) > 0 {
+				continue
+			}
+
+			for _, name := range g.satisfies(dep, nil) {
+				if removing[name] && !slices.Contains(out[name], pkgName) {
+					out[name] = append(out[name], pkgName)
+				}
+			}
+		}
+	}
+
+	for _, names := range out {
+		sort.Strings(names)
+	}
+	return out
+}
+
+// unneeded returns the LURE packages that were installed as dependencies,
+// but aren't needed by any explicitly installed package, either directly
+// or through other dependencies. The packages in removing are treated as
+// if they weren't installed.
+func (g *depGraph) unneeded(removing map[string]bool) []string {
+	var roots []string
+	for pkgName := range g.pkgs {
+		if !g.isDependency(pkgName) && !removing[pkgName] {
+			roots = append(roots, pkgName)
+		}
+	}
+
+	needed := g.reachable(roots, removing)
+
+	var out []string
+	for pkgName := range g.pkgs {
+		if g.isDependency(pkgName) && !needed[pkgName] && !removing[pkgName] {
+			out = append(out, pkgName)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// orphanedDeps returns the LURE dependencies of the packages in removing
+// that wouldn't be needed by anything else once they're removed
+func (g *depGraph) orphanedDeps(removing map[string]bool) []string {
+	var roots []string
+	for name := range removing {
+		roots = append(roots, name)
+	}
+	deps := g.reachable(roots, nil)
+
+	var out []string
+	for _, name := range g.unneeded(removing) {
+		if deps[name] {
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+// reachable returns the names of the given packages and all the installed
+// packages they depend on, directly or indirectly. Optional dependencies
+// are included, since they were installed because the user wanted them.
+func (g *depGraph) reachable(roots []string, removing map[string]bool) map[string]bool {
+	out := map[string]bool{}
+	queue := roots
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+
+		if out[name] {
+			continue
+		}
+		out[name] = true
+
+		pkg, ok := g.pkgs[name]
+		if !ok {
+			continue
+		}
+
+		for _, dep := range slices.Concat(pkg.depends, pkg.optDepends) {
+			queue = append(queue, g.satisfies(dep, removing)...)
+		}
+	}
+	return out
+}
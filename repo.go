@@ -131,6 +131,12 @@ var removerepoCmd = &cli.Command{
 			log.Fatal("Error encoding config").Err(err).Send()
 		}
 
+		lock, err := repos.LockRepos(ctx)
+		if err != nil {
+			log.Fatal("Error locking repo directory").Err(err).Send()
+		}
+		defer lock.Release()
+
 		err = os.RemoveAll(filepath.Join(config.GetPaths(ctx).RepoDir, name))
 		if err != nil {
 			log.Fatal("Error removing repo directory").Err(err).Send()
@@ -0,0 +1,77 @@
+/*
+ * LURE - Linux User REpository
+ * Copyright (C) 2023 Elara Musayelyan
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sintan1729/lure/pkg/build"
+	"github.com/sintan1729/lure/pkg/loggerctx"
+	"github.com/urfave/cli/v3"
+)
+
+var updsumsCmd = &cli.Command{
+	Name:  "updsums",
+	Usage: "Download the sources of a build script and update its checksums",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:    "script",
+			Aliases: []string{"s"},
+			Value:   "lure.sh",
+			Usage:   "Path to the build script",
+		},
+		&cli.BoolFlag{
+			Name:  "check",
+			Usage: "Only check that the checksums are correct, without updating them",
+		},
+	},
+	Action: func(ctx context.Context, c *cli.Command) error {
+		log := loggerctx.From(ctx)
+
+		mismatches, err := build.UpdateChecksums(ctx, c.String("script"), c.Bool("check"))
+		if err != nil {
+			log.Fatal("Error updating checksums").Err(err).Send()
+		}
+
+		if len(mismatches) == 0 {
+			log.Info("All checksums are up to date").Send()
+			return nil
+		}
+
+		for _, m := range mismatches {
+			entry := fmt.Sprintf("%s[%d]", m.Var, m.Index)
+			switch {
+			case m.Source == "":
+				log.Warn("Extra checksum without a source").Str("entry", entry).Send()
+			case m.Expected == "":
+				log.Warn("Missing checksum").Str("entry", entry).Str("source", m.Source).Str("actual", m.Actual).Send()
+			default:
+				log.Warn("Checksum mismatch").Str("entry", entry).Str("source", m.Source).Str("expected", m.Expected).Str("actual", m.Actual).Send()
+			}
+		}
+
+		if c.Bool("check") {
+			log.Fatal("Checksums don't match the sources").Int("count", len(mismatches)).Send()
+		}
+
+		log.Info("Updated checksums").Str("script", c.String("script")).Int("count", len(mismatches)).Send()
+		return nil
+	},
+}
@@ -20,10 +20,12 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"github.com/sintan1729/lure/internal/config"
 	"github.com/sintan1729/lure/internal/db"
+	"github.com/sintan1729/lure/internal/installed"
 	"github.com/sintan1729/lure/internal/types"
 	"github.com/sintan1729/lure/pkg/build"
 	"github.com/sintan1729/lure/pkg/distro"
@@ -70,16 +72,48 @@ var upgradeCmd = &cli.Command{
 			log.Fatal("Error checking for updates").Err(err).Send()
 		}
 
-		if len(updates) > 0 {
-			build.InstallPkgs(ctx, updates, nil, types.BuildOpts{
+		if len(updates) == 0 {
+			log.Info("There is nothing to do.").Send()
+			return nil
+		}
+
+		record, err := installed.Packages(ctx)
+		if err != nil {
+			log.Fatal("Error reading installed packages").Err(err).Send()
+		}
+
+		// Packages that were installed as dependencies are upgraded
+		// separately, so that they're still recorded as dependencies
+		var deps, explicit []db.Package
+		for _, pkg := range updates {
+			if record[pkg.Name].Dependency {
+				deps = append(deps, pkg)
+			} else {
+				explicit = append(explicit, pkg)
+			}
+		}
+
+		install := func(pkgs []db.Package, asDeps bool) {
+			if len(pkgs) == 0 {
+				return
+			}
+
+			err := build.InstallPkgs(ctx, pkgs, nil, types.BuildOpts{
 				Manager:     mgr,
 				Clean:       c.Bool("clean"),
 				Interactive: c.Bool("interactive"),
+				AsDeps:      asDeps,
 			})
-		} else {
-			log.Info("There is nothing to do.").Send()
+			if errors.Is(err, build.ErrUserAborted) {
+				log.Fatal("User chose not to continue after reading script").Send()
+			} else if err != nil {
+				log.Fatal("Error installing packages").Err(err).Send()
+			}
 		}
 
+		install(deps, true)
+		install(explicit, false)
+
 		return nil
 	},
 }